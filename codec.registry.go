@@ -0,0 +1,246 @@
+package model
+
+import (
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bdlm/errors/v2"
+	"gopkg.in/yaml.v3"
+)
+
+/*
+registry maps format names and content types to codecs.
+*/
+var registry = struct {
+	mux          sync.RWMutex
+	codecs       map[Format]Codec
+	contentTypes map[string]Format // content type -> format
+	formatTypes  map[Format]string // format -> preferred content type
+}{
+	codecs:       map[Format]Codec{},
+	contentTypes: map[string]Format{},
+	formatTypes:  map[Format]string{},
+}
+
+func init() {
+	RegisterCodec(FormatJSON, codecFuncs{
+		encode: func(mdl *Model) ([]byte, error) { return mdl.MarshalJSON() },
+		decode: func(data []byte, mdl *Model) error { return mdl.UnmarshalJSON(data) },
+	}, "application/json", "text/json")
+	RegisterCodec(FormatYAML, codecFuncs{
+		encode: func(mdl *Model) ([]byte, error) { return yaml.Marshal(mdl) },
+		decode: func(data []byte, mdl *Model) error { return yaml.Unmarshal(data, mdl) },
+	}, "application/yaml", "application/x-yaml", "text/yaml")
+	RegisterCodec(FormatTOML, codecFuncs{
+		encode: marshalTOML,
+		decode: unmarshalTOML,
+	}, "application/toml")
+	RegisterCodec(FormatCBOR, codecFuncs{
+		encode: marshalCBOR,
+		decode: unmarshalCBOR,
+	}, "application/cbor")
+	RegisterCodec(FormatMsgPack, codecFuncs{
+		encode: marshalMsgPack,
+		decode: unmarshalMsgPack,
+	}, "application/msgpack", "application/x-msgpack", "application/vnd.msgpack")
+}
+
+/*
+codecFuncs adapts a pair of functions to the Codec interface.
+*/
+type codecFuncs struct {
+	encode func(*Model) ([]byte, error)
+	decode func([]byte, *Model) error
+}
+
+/*
+Encode implements Codec.
+*/
+func (c codecFuncs) Encode(mdl *Model) ([]byte, error) {
+	return c.encode(mdl)
+}
+
+/*
+Decode implements Codec.
+*/
+func (c codecFuncs) Decode(data []byte, mdl *Model) error {
+	return c.decode(data, mdl)
+}
+
+/*
+RegisterCodec registers a codec for the named format, replacing any codec
+and content types previously registered under that name. contentTypes lists
+the media types the codec handles, the first being its preferred type.
+*/
+func RegisterCodec(name Format, codec Codec, contentTypes ...string) {
+	registry.mux.Lock()
+	defer registry.mux.Unlock()
+	registry.codecs[name] = codec
+	for ct, format := range registry.contentTypes {
+		if name == format {
+			delete(registry.contentTypes, ct)
+		}
+	}
+	delete(registry.formatTypes, name)
+	for k, ct := range contentTypes {
+		ct = strings.ToLower(ct)
+		registry.contentTypes[ct] = name
+		if 0 == k {
+			registry.formatTypes[name] = ct
+		}
+	}
+}
+
+/*
+LookupCodec returns the codec registered for the named format.
+*/
+func LookupCodec(name Format) (Codec, bool) {
+	registry.mux.RLock()
+	defer registry.mux.RUnlock()
+	codec, ok := registry.codecs[name]
+	return codec, ok
+}
+
+/*
+Formats returns the names of all registered formats, sorted.
+*/
+func Formats() []Format {
+	registry.mux.RLock()
+	defer registry.mux.RUnlock()
+	formats := make([]Format, 0, len(registry.codecs))
+	for name := range registry.codecs {
+		formats = append(formats, name)
+	}
+	sort.Slice(formats, func(a, b int) bool { return formats[a] < formats[b] })
+	return formats
+}
+
+/*
+EncodeAs serializes mdl using the codec registered for the named format.
+*/
+func EncodeAs(mdl *Model, name Format) ([]byte, error) {
+	codec, ok := LookupCodec(name)
+	if !ok {
+		return nil, errors.WrapE(InvalidFormat, errors.Errorf("cannot marshal format '%s'", name))
+	}
+	return codec.Encode(mdl)
+}
+
+/*
+DecodeAs parses data into mdl using the codec registered for the named
+format.
+*/
+func DecodeAs(data []byte, mdl *Model, name Format) error {
+	codec, ok := LookupCodec(name)
+	if !ok {
+		return errors.WrapE(InvalidFormat, errors.Errorf("cannot unmarshal format '%s'", name))
+	}
+	return codec.Decode(data, mdl)
+}
+
+/*
+ContentType returns the preferred content type of the named format.
+*/
+func ContentType(name Format) (string, bool) {
+	registry.mux.RLock()
+	defer registry.mux.RUnlock()
+	ct, ok := registry.formatTypes[name]
+	return ct, ok
+}
+
+/*
+FormatForContentType returns the format registered for a content type.
+Media type parameters, such as "; charset=utf-8", are ignored.
+*/
+func FormatForContentType(contentType string) (Format, bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if nil != err {
+		return "", false
+	}
+	registry.mux.RLock()
+	defer registry.mux.RUnlock()
+	name, ok := registry.contentTypes[mediaType]
+	return name, ok
+}
+
+/*
+Negotiate selects a format for an HTTP Accept header. Media ranges are
+considered in order of their quality values, ties going to the earlier
+range. Wildcard ranges, such as "application/*" or the full wildcard, match
+registered content types, preferring JSON. A content type whose most
+specific matching range has a quality of 0 is not acceptable. It returns
+the format and the content type to respond with, or false if no registered
+format is acceptable. An empty header accepts JSON.
+*/
+func Negotiate(accept string) (Format, string, bool) {
+	if "" == strings.TrimSpace(accept) {
+		accept = "*/*"
+	}
+
+	type mediaRange struct {
+		typ string
+		q   float64
+	}
+	ranges := []mediaRange{}
+	quality := map[string]float64{}
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if nil != err {
+			continue
+		}
+		q := 1.0
+		if qStr, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(qStr, 64); nil != err {
+				continue
+			}
+		}
+		if _, ok := quality[mediaType]; !ok || 0 == q {
+			quality[mediaType] = q
+		}
+		if q > 0 {
+			ranges = append(ranges, mediaRange{typ: mediaType, q: q})
+		}
+	}
+	sort.SliceStable(ranges, func(a, b int) bool { return ranges[a].q > ranges[b].q })
+
+	// acceptable reports whether the most specific range matching ct allows it.
+	acceptable := func(ct string) bool {
+		for _, rng := range []string{ct, strings.SplitN(ct, "/", 2)[0] + "/*", "*/*"} {
+			if q, ok := quality[rng]; ok {
+				return q > 0
+			}
+		}
+		return false
+	}
+
+	registry.mux.RLock()
+	defer registry.mux.RUnlock()
+	for _, rng := range ranges {
+		if name, ok := registry.contentTypes[rng.typ]; ok && acceptable(rng.typ) {
+			return name, rng.typ, true
+		}
+		prefix, ok := strings.CutSuffix(rng.typ, "/*")
+		if !ok {
+			continue
+		}
+		if ct := registry.formatTypes[FormatJSON]; acceptable(ct) && ("*" == prefix || strings.HasPrefix(ct, prefix+"/")) {
+			if _, ok := registry.codecs[FormatJSON]; ok {
+				return FormatJSON, ct, true
+			}
+		}
+		matches := []string{}
+		for ct := range registry.contentTypes {
+			if acceptable(ct) && ("*" == prefix || strings.HasPrefix(ct, prefix+"/")) {
+				matches = append(matches, ct)
+			}
+		}
+		if len(matches) > 0 {
+			sort.Strings(matches)
+			return registry.contentTypes[matches[0]], matches[0], true
+		}
+	}
+	return "", "", false
+}
@@ -0,0 +1,91 @@
+package model_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bdlm/model"
+	stdModel "github.com/bdlm/std/v2/model"
+)
+
+// lines is a toy codec storing list models as newline separated strings.
+type lines struct{}
+
+func (lines) Encode(mdl *model.Model) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	var key, val interface{}
+	for mdl.Next(&key, &val) {
+		str, _ := val.(stdModel.Value).String()
+		buf.WriteString(str + "\n")
+	}
+	return buf.Bytes(), nil
+}
+
+func (lines) Decode(data []byte, mdl *model.Model) error {
+	for _, line := range bytes.Split(bytes.TrimSpace(data), []byte("\n")) {
+		mdl.Push(string(line))
+	}
+	return nil
+}
+
+func TestCodecRegistry(t *testing.T) {
+	model.RegisterCodec("lines", lines{}, "text/x-lines")
+
+	mdl := model.New(stdModel.ModelTypeList)
+	if err := model.DecodeAs([]byte("a\nb\n"), mdl, "lines"); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := model.EncodeAs(mdl, model.FormatJSON)
+	if nil != err || `["a","b"]` != string(out) {
+		t.Errorf("unexpected output %s (%v)", out, err)
+	}
+
+	mdl.SetFormat("lines")
+	if out, _ := mdl.MarshalModel(); "a\nb\n" != string(out) {
+		t.Errorf("expected MarshalModel to use the registered codec, received %q", out)
+	}
+
+	if _, err := model.EncodeAs(mdl, "missing"); nil == err {
+		t.Errorf("expected an error for an unregistered format")
+	}
+	if format, ok := model.FormatForContentType("Application/CBOR; charset=binary"); !ok || model.FormatCBOR != format {
+		t.Errorf("expected cbor, received '%s'", format)
+	}
+	if ct, _ := model.ContentType(model.FormatYAML); "application/yaml" != ct {
+		t.Errorf("expected application/yaml, received '%s'", ct)
+	}
+
+	model.RegisterCodec("lines", lines{}, "text/x-line-list")
+	if _, ok := model.FormatForContentType("text/x-lines"); ok {
+		t.Errorf("expected the replaced content type to be removed")
+	}
+	if ct, _ := model.ContentType("lines"); "text/x-line-list" != ct {
+		t.Errorf("expected text/x-line-list, received '%s'", ct)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept string
+		format model.Format
+		ct     string
+		ok     bool
+	}{
+		{"", model.FormatJSON, "application/json", true},
+		{"application/cbor", model.FormatCBOR, "application/cbor", true},
+		{"text/html, application/yaml;q=0.5, application/cbor;q=0.9", model.FormatCBOR, "application/cbor", true},
+		{"text/html, */*;q=0.1", model.FormatJSON, "application/json", true},
+		{"application/*", model.FormatJSON, "application/json", true},
+		{"application/json;q=0, application/msgpack", model.FormatMsgPack, "application/msgpack", true},
+		{"application/json;q=0, */*", model.FormatCBOR, "application/cbor", true},
+		{"application/*;q=0, */*", model.FormatJSON, "text/json", true},
+		{"application/cbor, application/cbor;q=0", "", "", false},
+		{"text/html", "", "", false},
+	}
+	for _, test := range tests {
+		format, ct, ok := model.Negotiate(test.accept)
+		if test.format != format || test.ct != ct || test.ok != ok {
+			t.Errorf("%q: expected (%s, %s, %v), received (%s, %s, %v)", test.accept, test.format, test.ct, test.ok, format, ct, ok)
+		}
+	}
+}
@@ -26,6 +26,25 @@ var (
 	// InvalidDataSet - An attempt was made to store a data set that is
 	// with the model type
 	InvalidDataSet stdErrors.Error
+
+	// InvalidTarget - The target value cannot receive decoded model data.
+	// E.g. a nil or non-pointer value passed to Decode().
+	InvalidTarget stdErrors.Error
+
+	// CircularReference - A value contains a reference to itself.
+	CircularReference stdErrors.Error
+
+	// InvalidFormat - The requested serialization format is not supported.
+	InvalidFormat stdErrors.Error
+
+	// InvalidQuery - A query or expression could not be parsed.
+	InvalidQuery stdErrors.Error
+
+	// DuplicateValue - A value violates a unique index.
+	DuplicateValue stdErrors.Error
+
+	// NullValue - A null value cannot be converted to the requested type.
+	NullValue stdErrors.Error
 )
 
 func init() {
@@ -33,4 +52,11 @@ func init() {
 	InvalidIndexType = errors.New("an invalid index datatype was used")
 	InvalidMethodContext = errors.New("a method was used in an invalid context")
 	ReadOnlyProperty = errors.New("cannot update a read-only property")
+	InvalidDataSet = errors.New("invalid data set for the model type")
+	InvalidTarget = errors.New("invalid decode target")
+	CircularReference = errors.New("circular reference detected")
+	InvalidFormat = errors.New("unsupported serialization format")
+	InvalidQuery = errors.New("invalid query")
+	DuplicateValue = errors.New("duplicate value in unique index")
+	NullValue = errors.New("value is null")
 }
@@ -3,10 +3,12 @@ module github.com/bdlm/model
 go 1.26.2
 
 require (
+	github.com/BurntSushi/toml v1.6.0
 	github.com/bdlm/cast/v2 v2.1.0
 	github.com/bdlm/errors/v2 v2.1.2
 	github.com/bdlm/log/v2 v2.0.7
 	github.com/bdlm/std/v2 v2.1.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -0,0 +1,13 @@
+package model
+
+/*
+Codec is the interface implemented by serialization formats. Codecs are
+registered by name with RegisterCodec and selected with Model.SetFormat,
+EncodeAs and DecodeAs.
+*/
+type Codec interface {
+	// Encode returns the serialized form of mdl.
+	Encode(mdl *Model) ([]byte, error)
+	// Decode parses data and stores the result in mdl.
+	Decode(data []byte, mdl *Model) error
+}
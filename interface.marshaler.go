@@ -1,5 +1,34 @@
 package model
 
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+
+	"github.com/bdlm/errors/v2"
+	stdModel "github.com/bdlm/std/v2/model"
+)
+
+/*
+Format identifies a serialization format by the name of its registered
+Codec.
+*/
+type Format string
+
+const (
+	// FormatJSON selects JSON serialization. This is the default format.
+	FormatJSON Format = "json"
+	// FormatYAML selects YAML serialization.
+	FormatYAML Format = "yaml"
+	// FormatTOML selects TOML serialization. Only hash models can be
+	// serialized as TOML documents.
+	FormatTOML Format = "toml"
+	// FormatCBOR selects CBOR (RFC 8949) serialization.
+	FormatCBOR Format = "cbor"
+	// FormatMsgPack selects MessagePack serialization.
+	FormatMsgPack Format = "msgpack"
+)
+
 /*
 Marshaler is the interface implemented by types that can serialize
 themselves into a static byte array.
@@ -20,3 +49,58 @@ packges, Unmarshalers implement UnmarshalModel([]byte("null")) as a no-op.
 type Unmarshaler interface {
 	UnmarshalModel(bytes []byte) error
 }
+
+var (
+	marshalerType   = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	unmarshalerType = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+)
+
+/*
+Marshal returns the serialized form of v. Values implementing Marshaler are
+serialized with MarshalModel, all other values are encoded as JSON. Models
+and Marshalers nested within v are encoded with their MarshalJSON and
+MarshalModel methods respectively.
+*/
+func Marshal(v any) ([]byte, error) {
+	if m, ok := v.(Marshaler); ok {
+		return m.MarshalModel()
+	}
+	buf := &bytes.Buffer{}
+	if err := writeJSON(buf, v); nil != err {
+		return nil, errors.Wrap(err, "marshaling failed")
+	}
+	return buf.Bytes(), nil
+}
+
+/*
+Unmarshal parses the serialized data and stores the result in the value
+pointed to by v. Values implementing Unmarshaler are unmarshaled with
+UnmarshalModel. Otherwise data is parsed as JSON into a model and decoded
+into v with Decode, so Unmarshalers nested within v receive the JSON
+encoding of their portion of the data.
+*/
+func Unmarshal(data []byte, v any) error {
+	if u, ok := v.(Unmarshaler); ok {
+		return u.UnmarshalModel(data)
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	var typ stdModel.ModelType
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		typ = stdModel.ModelTypeHash
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		typ = stdModel.ModelTypeList
+	default:
+		if err := json.Unmarshal(data, v); nil != err {
+			return errors.Wrap(err, "unmarshaling failed")
+		}
+		return nil
+	}
+
+	mdl := New(typ)
+	if err := mdl.UnmarshalJSON(data); nil != err {
+		return err
+	}
+	return Decode(mdl, v)
+}
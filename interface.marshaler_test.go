@@ -0,0 +1,78 @@
+package model_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/bdlm/model"
+	stdModel "github.com/bdlm/std/v2/model"
+)
+
+// point serializes itself as a "x,y" JSON string.
+type point struct {
+	X, Y int
+}
+
+func (p point) MarshalModel() ([]byte, error) {
+	return []byte(fmt.Sprintf(`"%d,%d"`, p.X, p.Y)), nil
+}
+
+func (p *point) UnmarshalModel(b []byte) error {
+	_, err := fmt.Sscanf(strings.Trim(string(b), `"`), "%d,%d", &p.X, &p.Y)
+	return err
+}
+
+type shape struct {
+	Name   string  `model:"name"`
+	Points []point `model:"points"`
+}
+
+func TestMarshalUnmarshal(t *testing.T) {
+	var _ model.Unmarshaler = model.New(stdModel.ModelTypeHash)
+
+	src := shape{Name: "line", Points: []point{{1, 2}, {3, 4}}}
+	mdl, err := model.FromStruct(src)
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b, err := model.Marshal(mdl)
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if `{"name":"line","points":["1,2","3,4"]}` != string(b) {
+		t.Errorf("unexpected output %s", b)
+	}
+
+	dst := shape{}
+	if err := model.Unmarshal(b, &dst); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if "line" != dst.Name || 2 != len(dst.Points) || 4 != dst.Points[1].Y {
+		t.Errorf("unexpected result %+v", dst)
+	}
+
+	p := point{}
+	if err := model.Unmarshal([]byte(`"5,6"`), &p); nil != err || 6 != p.Y {
+		t.Errorf("expected Unmarshaler to be used, received %+v (%v)", p, err)
+	}
+}
+
+func TestUnmarshalModelNull(t *testing.T) {
+	mdl := model.New(stdModel.ModelTypeHash)
+	mdl.Set("key", "value")
+	for _, format := range []model.Format{model.FormatJSON, model.FormatYAML, model.FormatCBOR} {
+		mdl.SetFormat(format)
+		if err := mdl.UnmarshalModel([]byte(" null ")); nil != err {
+			t.Errorf("%s: unexpected error: %v", format, err)
+		}
+	}
+	if !mdl.Has("key") {
+		t.Errorf("expected null to be a no-op")
+	}
+
+	mdl.SetFormat(model.Format("xml"))
+	if _, err := mdl.MarshalModel(); nil == err {
+		t.Errorf("expected an error for an unsupported format")
+	}
+}
@@ -0,0 +1,229 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bdlm/cast/v2"
+	"github.com/bdlm/errors/v2"
+	stdModel "github.com/bdlm/std/v2/model"
+)
+
+/*
+GroupBy groups the rows of this list model by the value of a field. It
+returns a hash model, keyed by the string cast of each value in the order
+first seen, of list models holding the matching rows. Nested fields are
+addressed with dotted paths; rows where the field is missing or null are
+grouped under "".
+*/
+func (mdl *Model) GroupBy(field string) (*Model, error) {
+	path := strings.Split(field, ".")
+	return mdl.GroupByFunc(func(val stdModel.Value) string {
+		return groupKey(lookupPath(unwrap(val), path))
+	})
+}
+
+/*
+GroupByFunc groups the rows of this list model by the key returned by fn.
+See GroupBy.
+*/
+func (mdl *Model) GroupByFunc(fn func(stdModel.Value) string) (*Model, error) {
+	if err := mdl.requireList("GroupBy"); nil != err {
+		return nil, err
+	}
+	_, values := mdl.entries()
+	groups := New(stdModel.ModelTypeHash)
+	for _, val := range values {
+		key := fn(&Value{val})
+		group, err := groups.Get(key)
+		if nil != err {
+			list := New(stdModel.ModelTypeList)
+			groups.Set(key, list)
+			group = &Value{list}
+		}
+		list, _ := group.Model()
+		list.Push(val)
+	}
+	return groups, nil
+}
+
+/*
+Partition splits this list model into the elements for which pred returns
+true and the rest, preserving order.
+*/
+func (mdl *Model) Partition(pred func(stdModel.Value) bool) (*Model, *Model, error) {
+	if err := mdl.requireList("Partition"); nil != err {
+		return nil, nil, err
+	}
+	_, values := mdl.entries()
+	matched := New(stdModel.ModelTypeList)
+	rest := New(stdModel.ModelTypeList)
+	for _, val := range values {
+		if pred(&Value{val}) {
+			matched.Push(val)
+		} else {
+			rest.Push(val)
+		}
+	}
+	return matched, rest, nil
+}
+
+/*
+CountBy counts the rows of this list model by the value of a field. It
+returns a hash model of int counts keyed like GroupBy.
+*/
+func (mdl *Model) CountBy(field string) (*Model, error) {
+	if err := mdl.requireList("CountBy"); nil != err {
+		return nil, err
+	}
+	path := strings.Split(field, ".")
+	_, values := mdl.entries()
+	counts := map[string]int{}
+	order := []string{}
+	for _, val := range values {
+		key := groupKey(lookupPath(val, path))
+		if _, ok := counts[key]; !ok {
+			order = append(order, key)
+		}
+		counts[key]++
+	}
+	result := New(stdModel.ModelTypeHash)
+	for _, key := range order {
+		result.Set(key, counts[key])
+	}
+	return result, nil
+}
+
+/*
+SumBy returns the sum of a numeric field over the rows of this list model.
+Rows where the field is missing or null are skipped; an error is returned
+if a value cannot be cast to a float64.
+*/
+func (mdl *Model) SumBy(field string) (float64, error) {
+	if err := mdl.requireList("SumBy"); nil != err {
+		return 0, err
+	}
+	path := strings.Split(field, ".")
+	_, values := mdl.entries()
+	sum := 0.0
+	for k, val := range values {
+		fieldVal, ok := lookupPath(val, path)
+		if !ok || nil == fieldVal {
+			continue
+		}
+		num, err := cast.ToE[float64](fieldVal)
+		if nil != err {
+			return 0, errors.Wrap(err, "could not convert '%s' of row %d to a float64", field, k)
+		}
+		sum += num
+	}
+	return sum, nil
+}
+
+/*
+Distinct returns a list model holding the first of each distinct element of
+this list model. If fields are given, rows are compared by the values of
+those fields only; otherwise whole elements are compared. Scalars are
+compared by their string cast, so 1 and "1" are not distinct.
+*/
+func (mdl *Model) Distinct(fields ...string) (*Model, error) {
+	if err := mdl.requireList("Distinct"); nil != err {
+		return nil, err
+	}
+	paths := splitPaths(fields)
+	_, values := mdl.entries()
+	result := New(stdModel.ModelTypeList)
+	seen := map[string]bool{}
+	for _, val := range values {
+		key := distinctKey(val)
+		if 0 < len(paths) {
+			parts := make([]string, len(paths))
+			for k, path := range paths {
+				fieldVal, _ := lookupPath(val, path)
+				parts[k] = distinctKey(fieldVal)
+			}
+			key = strings.Join(parts, "\x00")
+		}
+		if !seen[key] {
+			seen[key] = true
+			result.Push(val)
+		}
+	}
+	return result, nil
+}
+
+/*
+distinctKey returns a key identifying a value for Distinct. Scalars are
+compared by their string cast and models by their JSON encoding.
+*/
+func distinctKey(val any) string {
+	if nil == val {
+		return "\x01null"
+	}
+	if key, ok := indexKey(val); ok {
+		return key
+	}
+	if mdl, ok := val.(*Model); ok {
+		if data, err := mdl.MarshalJSON(); nil == err {
+			return "\x01" + string(data)
+		}
+	}
+	return fmt.Sprintf("\x01%#v", val)
+}
+
+/*
+Chunk splits this list model into list models of at most size elements.
+*/
+func (mdl *Model) Chunk(size int) (*Model, error) {
+	if err := mdl.requireList("Chunk"); nil != err {
+		return nil, err
+	}
+	if size < 1 {
+		return nil, errors.WrapE(InvalidIndex, errors.Errorf("invalid chunk size '%d'", size))
+	}
+	_, values := mdl.entries()
+	result := New(stdModel.ModelTypeList)
+	for start := 0; start < len(values); start += size {
+		chunk := New(stdModel.ModelTypeList)
+		for _, val := range values[start:min(start+size, len(values))] {
+			chunk.Push(val)
+		}
+		result.Push(chunk)
+	}
+	return result, nil
+}
+
+/*
+requireList returns an InvalidMethodContext error if this is not a list
+model.
+*/
+func (mdl *Model) requireList(method string) error {
+	if stdModel.ModelTypeList != mdl.GetType() {
+		return errors.WrapE(InvalidMethodContext, errors.Errorf("%s() is only valid for stdModel.ModelTypeList model types", method))
+	}
+	return nil
+}
+
+/*
+lookupPath returns the value at a field path within nested hash models.
+*/
+func lookupPath(v any, path []string) (any, bool) {
+	for _, name := range path {
+		var ok bool
+		if v, ok = jpMember(v, name); !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+/*
+groupKey returns the group key of a field value.
+*/
+func groupKey(val any, ok bool) string {
+	if !ok {
+		return ""
+	}
+	key, _ := indexKey(val)
+	return key
+}
@@ -0,0 +1,117 @@
+package model_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bdlm/model"
+	stdModel "github.com/bdlm/std/v2/model"
+)
+
+const aggregateRows = `[
+	{"team": "red", "name": "a", "score": 10, "meta": {"region": "eu"}},
+	{"team": "blue", "name": "b", "score": "2.5", "meta": {"region": "us"}},
+	{"team": "red", "name": "c", "score": 5, "meta": {"region": "eu"}},
+	{"name": "d"},
+	{"team": "blue", "name": "b", "score": null, "meta": {"region": "us"}}
+]`
+
+func aggregateModel(t *testing.T) *model.Model {
+	t.Helper()
+	mdl := model.New(stdModel.ModelTypeList)
+	if err := mdl.UnmarshalJSON([]byte(aggregateRows)); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return mdl
+}
+
+func TestGroupBy(t *testing.T) {
+	mdl := aggregateModel(t)
+	groups, err := mdl.GroupBy("team")
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if data, err := groups.MarshalJSON(); nil != err || `{"red":[{"meta":{"region":"eu"},"name":"a","score":10,"team":"red"},{"meta":{"region":"eu"},"name":"c","score":5,"team":"red"}],"blue":[{"meta":{"region":"us"},"name":"b","score":"2.5","team":"blue"},{"meta":{"region":"us"},"name":"b","score":null,"team":"blue"}],"":[{"name":"d"}]}` != string(data) {
+		t.Errorf("unexpected groups %s (%v)", data, err)
+	}
+
+	groups, _ = mdl.GroupByFunc(func(val stdModel.Value) string {
+		row, _ := val.Model()
+		name, _ := row.Get("name")
+		if "a" == name.Value() {
+			return "first"
+		}
+		return "other"
+	})
+	if val, _ := groups.Get("other"); nil == val {
+		t.Fatalf("expected group 'other'")
+	} else if list, _ := val.Model(); nil == list {
+		t.Errorf("expected a list model")
+	}
+
+	counts, _ := mdl.CountBy("meta.region")
+	if data, _ := counts.MarshalJSON(); `{"eu":2,"us":2,"":1}` != string(data) {
+		t.Errorf("unexpected counts %s", data)
+	}
+
+	if _, err := model.New(stdModel.ModelTypeHash).GroupBy("team"); !errors.Is(err, model.InvalidMethodContext) {
+		t.Errorf("expected InvalidMethodContext, received %v", err)
+	}
+}
+
+func TestPartitionSumBy(t *testing.T) {
+	mdl := aggregateModel(t)
+	red, rest, err := mdl.Partition(func(val stdModel.Value) bool {
+		row, _ := val.Model()
+		team, _ := row.Get("team")
+		return nil != team && "red" == team.Value()
+	})
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if data, _, _ := red.Data(); 2 != len(data) {
+		t.Errorf("expected 2 red rows, received %d", len(data))
+	}
+	if data, _, _ := rest.Data(); 3 != len(data) {
+		t.Errorf("expected 3 other rows, received %d", len(data))
+	}
+
+	sum, err := mdl.SumBy("score")
+	if nil != err || 17.5 != sum {
+		t.Errorf("expected 17.5, received %v (%v)", sum, err)
+	}
+	if _, err := mdl.SumBy("name"); nil == err {
+		t.Errorf("expected an error for a non-numeric field")
+	}
+}
+
+func TestDistinctChunk(t *testing.T) {
+	mdl := aggregateModel(t)
+	distinct, err := mdl.Distinct("team", "name")
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if data, _, _ := distinct.Data(); 4 != len(data) {
+		t.Errorf("expected 4 distinct rows, received %d", len(data))
+	}
+
+	list := model.New(stdModel.ModelTypeList)
+	for _, val := range []any{1, "1", 2, nil, nil, 3} {
+		list.Push(val)
+	}
+	distinct, _ = list.Distinct()
+	if data, _ := distinct.MarshalJSON(); `[1,2,null,3]` != string(data) {
+		t.Errorf("unexpected distinct values %s", data)
+	}
+
+	chunks, err := list.Chunk(4)
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if data, _ := chunks.MarshalJSON(); `[[1,"1",2,null],[null,3]]` != string(data) {
+		t.Errorf("unexpected chunks %s", data)
+	}
+	if _, err := list.Chunk(0); !errors.Is(err, model.InvalidIndex) {
+		t.Errorf("expected InvalidIndex, received %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package model_test
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/bdlm/model"
+	stdModel "github.com/bdlm/std/v2/model"
+)
+
+func binaryFixture() *model.Model {
+	nested := model.New(stdModel.ModelTypeList)
+	nested.Push(int64(-200))
+	nested.Push(float32(1.5))
+	nested.Push(nil)
+	nested.Push("x")
+
+	mdl := model.New(stdModel.ModelTypeHash)
+	mdl.Set("zeta", "first")
+	mdl.Set("big", int64(math.MaxInt64))
+	mdl.Set("huge", uint64(math.MaxUint64))
+	mdl.Set("whole", 2.0)
+	mdl.Set("raw", []byte{0, 1, 2})
+	mdl.Set("at", time.Date(2024, 1, 2, 3, 4, 5, 600, time.UTC))
+	mdl.Set("ok", true)
+	mdl.Set("list", nested)
+	return mdl
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	for _, format := range []model.Format{model.FormatCBOR, model.FormatMsgPack} {
+		src := binaryFixture()
+		src.SetFormat(format)
+		data, err := src.MarshalModel()
+		if nil != err {
+			t.Fatalf("%s: unexpected error: %v", format, err)
+		}
+
+		dst := model.New(stdModel.ModelTypeHash)
+		dst.SetFormat(format)
+		if err := dst.UnmarshalModel(data); nil != err {
+			t.Fatalf("%s: unexpected error: %v", format, err)
+		}
+
+		var key, val interface{}
+		if dst.Next(&key, &val); "zeta" != key {
+			t.Errorf("%s: expected hash order to be preserved, received '%v' first", format, key)
+		}
+		dst.Reset()
+
+		expect := map[string]any{
+			"zeta":  "first",
+			"big":   int64(math.MaxInt64),
+			"huge":  uint64(math.MaxUint64),
+			"whole": 2.0,
+			"ok":    true,
+		}
+		for k, v := range expect {
+			got, err := dst.Get(k)
+			if nil != err || v != got.Value() {
+				t.Errorf("%s: expected %s to be %#v, received %#v (%v)", format, k, v, got.Value(), err)
+			}
+		}
+		raw, _ := dst.Get("raw")
+		if !bytes.Equal([]byte{0, 1, 2}, raw.Value().([]byte)) {
+			t.Errorf("%s: expected byte string, received %#v", format, raw.Value())
+		}
+		at, _ := dst.Get("at")
+		if !at.Value().(time.Time).Equal(time.Date(2024, 1, 2, 3, 4, 5, 600, time.UTC)) {
+			t.Errorf("%s: unexpected time %v", format, at.Value())
+		}
+		val2, _ := dst.Get("list")
+		list, _ := val2.Model()
+		for k, v := range []any{int64(-200), float32(1.5), nil, "x"} {
+			got, _ := list.Get(k)
+			if v != got.Value() {
+				t.Errorf("%s: expected list[%d] to be %#v, received %#v", format, k, v, got.Value())
+			}
+		}
+
+		if err := dst.UnmarshalModel(data[:len(data)-1]); nil == err {
+			t.Errorf("%s: expected an error for truncated data", format)
+		}
+	}
+}
+
+func TestCBORKnownEncoding(t *testing.T) {
+	// RFC 8949 appendix A: {"a": 1, "b": [2, 3]}
+	mdl := model.New(stdModel.ModelTypeHash)
+	mdl.SetFormat(model.FormatCBOR)
+	if err := mdl.UnmarshalModel([]byte{0xa2, 0x61, 0x61, 0x01, 0x61, 0x62, 0x82, 0x02, 0x03}); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, _ := mdl.MarshalModel()
+	if !bytes.Equal([]byte{0xa2, 0x61, 0x61, 0x01, 0x61, 0x62, 0x82, 0x02, 0x03}, out) {
+		t.Errorf("unexpected encoding % x", out)
+	}
+
+	// Indefinite-length array and half-precision float: [_ 1.5]
+	list := model.New(stdModel.ModelTypeList)
+	list.SetFormat(model.FormatCBOR)
+	if err := list.UnmarshalModel([]byte{0x9f, 0xf9, 0x3e, 0x00, 0xff}); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if val, _ := list.Get(0); 1.5 != val.Value() {
+		t.Errorf("expected 1.5, received %#v", val.Value())
+	}
+}
+
+func TestCBORSelfDescribed(t *testing.T) {
+	// Self-describe tag 55799 wrapping {"a": 1}.
+	mdl := model.New(stdModel.ModelTypeList)
+	mdl.SetFormat(model.FormatCBOR)
+	if err := mdl.UnmarshalModel([]byte{0xd9, 0xd9, 0xf7, 0xa1, 0x61, 0x61, 0x01}); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stdModel.ModelTypeHash != mdl.GetType() {
+		t.Fatalf("expected a hash model")
+	}
+	if val, err := mdl.Get("a"); nil != err || int64(1) != val.Value() {
+		t.Errorf("expected 1, received %v (%v)", val, err)
+	}
+
+	// A tagged scalar is not a model.
+	if err := mdl.UnmarshalModel([]byte{0xd9, 0xd9, 0xf7, 0x01}); !errors.Is(err, model.InvalidDataSet) {
+		t.Errorf("expected an InvalidDataSet error, received %v", err)
+	}
+}
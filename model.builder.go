@@ -0,0 +1,270 @@
+package model
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/bdlm/cast/v2"
+	"github.com/bdlm/errors/v2"
+	stdModel "github.com/bdlm/std/v2/model"
+)
+
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+/*
+FromStruct returns a new hash model populated from the exported fields of
+the struct, or pointer to struct, v.
+
+Fields are keyed by their `model` tag, falling back to the `json` tag and
+then the field name, and are stored in declaration order. Fields tagged
+`omitempty` are skipped when they hold a zero value. See FromValue.
+*/
+func FromStruct(v any) (*Model, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, errors.WrapE(InvalidDataSet, errors.Errorf("FromStruct() requires a struct, received %T", v))
+	}
+	return FromValue(v)
+}
+
+/*
+FromValue returns a new model populated from v. Structs and maps become
+hash models, slices and arrays become list models, and pointers and
+interfaces are followed. Nested values are converted recursively.
+
+Values implementing Marshaler are stored unchanged, values implementing
+encoding.TextMarshaler are stored as strings, []byte values are stored as-is
+and all other scalars are stored unchanged. Map keys are converted to
+strings and sorted. An error is returned if v contains a reference cycle.
+*/
+func FromValue(v any) (*Model, error) {
+	bld := &builder{visited: map[uintptr]bool{}}
+	data, err := bld.build("", reflect.ValueOf(v))
+	if nil != err {
+		return nil, err
+	}
+	mdl, ok := data.(*Model)
+	if !ok {
+		return nil, errors.WrapE(InvalidDataSet, errors.Errorf("cannot build a model from %T", v))
+	}
+	return mdl, nil
+}
+
+/*
+builder holds the state of a single FromValue call.
+*/
+type builder struct {
+	visited map[uintptr]bool // pointers on the current path, for cycle detection
+}
+
+/*
+enter marks the pointer p as being on the current path. It returns an error
+if p has already been visited.
+*/
+func (bld *builder) enter(path string, p uintptr) error {
+	if bld.visited[p] {
+		return errors.WrapE(CircularReference, errors.Errorf("cycle detected at '%s'", path))
+	}
+	bld.visited[p] = true
+	return nil
+}
+
+/*
+build converts rv into a value suitable for storage in a model.
+*/
+func (bld *builder) build(path string, rv reflect.Value) (any, error) {
+	if !rv.IsValid() {
+		return nil, nil
+	}
+
+	if mdl, ok := rv.Interface().(*Model); ok {
+		return mdl, nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return nil, nil
+		}
+	}
+
+	// Marshalers are stored as-is and serialize themselves.
+	if rv.Type().Implements(marshalerType) {
+		return rv.Interface(), nil
+	}
+
+	if rv.Type().Implements(textMarshalerType) {
+		text, err := rv.Interface().(encoding.TextMarshaler).MarshalText()
+		if nil != err {
+			return nil, errors.Wrap(err, "could not marshal '%s'", path)
+		}
+		return string(text), nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Pointer:
+		if err := bld.enter(path, rv.Pointer()); nil != err {
+			return nil, err
+		}
+		defer delete(bld.visited, rv.Pointer())
+		return bld.build(path, rv.Elem())
+
+	case reflect.Interface:
+		return bld.build(path, rv.Elem())
+
+	case reflect.Struct:
+		return bld.buildStruct(path, rv)
+
+	case reflect.Map:
+		if rv.IsNil() {
+			return nil, nil
+		}
+		if err := bld.enter(path, rv.Pointer()); nil != err {
+			return nil, err
+		}
+		defer delete(bld.visited, rv.Pointer())
+		return bld.buildMap(path, rv)
+
+	case reflect.Slice:
+		if rv.IsNil() {
+			return nil, nil
+		}
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return rv.Bytes(), nil
+		}
+		if err := bld.enter(path, rv.Pointer()); nil != err {
+			return nil, err
+		}
+		defer delete(bld.visited, rv.Pointer())
+		return bld.buildList(path, rv)
+
+	case reflect.Array:
+		return bld.buildList(path, rv)
+
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return nil, errors.WrapE(InvalidDataSet, errors.Errorf("unsupported type %s at '%s'", rv.Type(), path))
+	}
+
+	return rv.Interface(), nil
+}
+
+/*
+buildStruct converts a struct into a hash model.
+*/
+func (bld *builder) buildStruct(path string, rv reflect.Value) (*Model, error) {
+	mdl := New(stdModel.ModelTypeHash)
+	for _, fld := range structFields(rv.Type()) {
+		fv, ok := fieldByIndexRead(rv, fld.index)
+		if !ok {
+			continue
+		}
+		if fld.omitEmpty && isEmptyValue(fv) {
+			continue
+		}
+		val, err := bld.build(joinPath(path, fld.name), fv)
+		if nil != err {
+			return nil, err
+		}
+		mdl.Set(fld.name, val)
+	}
+	return mdl, nil
+}
+
+/*
+buildMap converts a map into a hash model with sorted keys.
+*/
+func (bld *builder) buildMap(path string, rv reflect.Value) (*Model, error) {
+	keys := make([]string, 0, rv.Len())
+	values := make(map[string]reflect.Value, rv.Len())
+	iter := rv.MapRange()
+	for iter.Next() {
+		key, err := mapKey(iter.Key())
+		if nil != err {
+			return nil, errors.Wrap(err, "invalid map key at '%s'", path)
+		}
+		keys = append(keys, key)
+		values[key] = iter.Value()
+	}
+	sort.Strings(keys)
+
+	mdl := New(stdModel.ModelTypeHash)
+	for _, key := range keys {
+		val, err := bld.build(joinPath(path, key), values[key])
+		if nil != err {
+			return nil, err
+		}
+		mdl.Set(key, val)
+	}
+	return mdl, nil
+}
+
+/*
+buildList converts a slice or array into a list model.
+*/
+func (bld *builder) buildList(path string, rv reflect.Value) (*Model, error) {
+	mdl := New(stdModel.ModelTypeList)
+	for k := 0; k < rv.Len(); k++ {
+		val, err := bld.build(joinPath(path, k), rv.Index(k))
+		if nil != err {
+			return nil, err
+		}
+		mdl.Push(val)
+	}
+	return mdl, nil
+}
+
+/*
+mapKey converts a map key into a hash model key.
+*/
+func mapKey(key reflect.Value) (string, error) {
+	if key.Kind() == reflect.Interface && !key.IsNil() {
+		key = key.Elem()
+	}
+	if key.Type().Implements(textMarshalerType) {
+		text, err := key.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(text), err
+	}
+	if key.Kind() == reflect.String {
+		return key.String(), nil
+	}
+	str, err := cast.ToE[string](key.Interface())
+	if nil != err {
+		return fmt.Sprint(key.Interface()), nil
+	}
+	return str, nil
+}
+
+/*
+fieldByIndexRead returns the struct field at index. It returns false if a
+nil embedded struct pointer is encountered along the way.
+*/
+func fieldByIndexRead(v reflect.Value, index []int) (reflect.Value, bool) {
+	for k, idx := range index {
+		if k > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(idx)
+	}
+	return v, true
+}
+
+/*
+isEmptyValue reports whether v is empty for the purposes of omitempty.
+*/
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return 0 == v.Len()
+	case reflect.Pointer, reflect.Interface:
+		return v.IsNil()
+	}
+	return v.IsZero()
+}
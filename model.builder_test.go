@@ -0,0 +1,86 @@
+package model_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/bdlm/errors/v2"
+	"github.com/bdlm/model"
+	stdModel "github.com/bdlm/std/v2/model"
+)
+
+type buildNode struct {
+	Name string     `model:"name"`
+	Next *buildNode `model:"next,omitempty"`
+}
+
+func TestFromStruct(t *testing.T) {
+	src := decodeTarget{
+		decodeBase: decodeBase{ID: 7},
+		Count:      2,
+		Timeout:    time.Second,
+		IP:         net.ParseIP("10.0.0.1"),
+		Tags:       []string{"a", "b"},
+		Labels:     map[string]string{"z": "last", "a": "first"},
+		Items:      []*decodeItem{{Name: "one", Price: 1.5}},
+	}
+	mdl, err := model.FromStruct(&src)
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if mdl.Has("name") {
+		t.Errorf("expected omitempty field 'name' to be omitted")
+	}
+	if mdl.Has("Skipped") {
+		t.Errorf("expected '-' field to be omitted")
+	}
+	if val, err := mdl.Get("id"); nil != err || 7 != val.Value() {
+		t.Errorf("expected embedded field 'id' to be 7, received %v (%v)", val, err)
+	}
+	if val, _ := mdl.Get("ip"); "10.0.0.1" != val.Value() {
+		t.Errorf("expected TextMarshaler output, received %v", val.Value())
+	}
+	val, _ := mdl.Get("labels")
+	labels, err := val.Model()
+	if nil != err || stdModel.ModelTypeHash != labels.GetType() {
+		t.Fatalf("expected labels to be a hash model, received %v", val.Value())
+	}
+	var key, v interface{}
+	labels.(*model.Model).Next(&key, &v)
+	if "a" != key {
+		t.Errorf("expected sorted map keys, received '%v' first", key)
+	}
+
+	// Round trip back into a struct.
+	dst := decodeTarget{}
+	if err := model.Decode(mdl, &dst); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if 7 != dst.ID || time.Second != dst.Timeout || "first" != dst.Labels["a"] || 1.5 != dst.Items[0].Price {
+		t.Errorf("round trip failed: %+v", dst)
+	}
+
+	if _, err := model.FromStruct([]int{1}); !errors.Is(err, model.InvalidDataSet) {
+		t.Errorf("expected model.InvalidDataSet, received '%v'", err)
+	}
+}
+
+func TestFromValueCycle(t *testing.T) {
+	node := &buildNode{Name: "a"}
+	node.Next = &buildNode{Name: "b", Next: node}
+	if _, err := model.FromValue(node); !errors.Is(err, model.CircularReference) {
+		t.Errorf("expected model.CircularReference, received '%v'", err)
+	}
+
+	// Shared, non-cyclic references are allowed.
+	leaf := &buildNode{Name: "leaf"}
+	mdl, err := model.FromValue(map[int]*buildNode{1: leaf, 2: leaf})
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !mdl.Has("1") || !mdl.Has("2") {
+		t.Errorf("expected integer map keys to be converted to strings")
+	}
+}
@@ -0,0 +1,526 @@
+package model
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"math/big"
+	"reflect"
+	"time"
+
+	"github.com/bdlm/cast/v2"
+	"github.com/bdlm/errors/v2"
+	stdModel "github.com/bdlm/std/v2/model"
+)
+
+/*
+CBOR major types, RFC 8949 section 3.1.
+*/
+const (
+	cborUint   byte = 0 << 5
+	cborNegInt byte = 1 << 5
+	cborBytes  byte = 2 << 5
+	cborText   byte = 3 << 5
+	cborArray  byte = 4 << 5
+	cborMap    byte = 5 << 5
+	cborTag    byte = 6 << 5
+	cborSimple byte = 7 << 5
+)
+
+/*
+marshalCBOR encodes a model as CBOR (RFC 8949).
+
+Hash models are encoded as maps in model order and list models as arrays.
+Integers and floats keep their distinct major types, []byte values are
+encoded as byte strings and time.Time values as tag 0 date/time strings.
+*/
+func marshalCBOR(mdl *Model) ([]byte, error) {
+	enc := &cborEncoder{}
+	if err := enc.encode(mdl); nil != err {
+		return nil, err
+	}
+	return enc.buf.Bytes(), nil
+}
+
+/*
+unmarshalCBOR decodes a CBOR map or array into mdl. Integers are decoded as
+int64, or uint64 if they overflow int64, byte strings as []byte, tag 0 and
+tag 1 values as time.Time and bignums as *big.Int.
+*/
+func unmarshalCBOR(data []byte, mdl *Model) error {
+	dec := &cborDecoder{data: data}
+	// Skip leading tags, such as the self-describe tag 55799, so that the
+	// target type is chosen from the tagged map or array.
+	for dec.pos < len(data) && cborTag == data[dec.pos]&0xe0 {
+		if _, _, _, _, err := dec.head(); nil != err {
+			return errors.Wrap(err, "unmarshaling failed")
+		}
+	}
+	if dec.pos < len(data) {
+		switch data[dec.pos] & 0xe0 {
+		case cborMap:
+			if stdModel.ModelTypeHash != mdl.GetType() {
+				if err := mdl.SetType(stdModel.ModelTypeHash); nil != err {
+					return errors.WrapE(InvalidDataSet, errors.Errorf("cannot unmarshal a CBOR map into a list model"))
+				}
+			}
+		case cborArray:
+			if stdModel.ModelTypeList != mdl.GetType() {
+				if err := mdl.SetType(stdModel.ModelTypeList); nil != err {
+					return errors.WrapE(InvalidDataSet, errors.Errorf("cannot unmarshal a CBOR array into a hash model"))
+				}
+			}
+		}
+	}
+	val, err := dec.decode(mdl, 0)
+	if nil != err {
+		return errors.Wrap(err, "unmarshaling failed")
+	}
+	if _, ok := val.(*Model); !ok {
+		return errors.WrapE(InvalidDataSet, errors.Errorf("CBOR data must be a map or an array"))
+	}
+	if dec.pos != len(data) {
+		return errors.Errorf("unmarshaling failed: %d trailing bytes", len(data)-dec.pos)
+	}
+	return nil
+}
+
+/*
+cborEncoder writes CBOR data items.
+*/
+type cborEncoder struct {
+	buf     bytes.Buffer
+	visited []*Model
+}
+
+/*
+head writes an initial byte and argument.
+*/
+func (enc *cborEncoder) head(major byte, arg uint64) {
+	switch {
+	case arg < 24:
+		enc.buf.WriteByte(major | byte(arg))
+	case arg <= math.MaxUint8:
+		enc.buf.WriteByte(major | 24)
+		enc.buf.WriteByte(byte(arg))
+	case arg <= math.MaxUint16:
+		enc.buf.WriteByte(major | 25)
+		enc.buf.Write(binary.BigEndian.AppendUint16(nil, uint16(arg)))
+	case arg <= math.MaxUint32:
+		enc.buf.WriteByte(major | 26)
+		enc.buf.Write(binary.BigEndian.AppendUint32(nil, uint32(arg)))
+	default:
+		enc.buf.WriteByte(major | 27)
+		enc.buf.Write(binary.BigEndian.AppendUint64(nil, arg))
+	}
+}
+
+/*
+int writes a signed integer.
+*/
+func (enc *cborEncoder) int(i int64) {
+	if i < 0 {
+		enc.head(cborNegInt, uint64(-(i + 1)))
+		return
+	}
+	enc.head(cborUint, uint64(i))
+}
+
+/*
+encode writes a single value.
+*/
+func (enc *cborEncoder) encode(v any) error {
+	switch typed := unwrap(v).(type) {
+	case nil:
+		enc.buf.WriteByte(cborSimple | 22)
+	case bool:
+		if typed {
+			enc.buf.WriteByte(cborSimple | 21)
+		} else {
+			enc.buf.WriteByte(cborSimple | 20)
+		}
+	case int:
+		enc.int(int64(typed))
+	case int8:
+		enc.int(int64(typed))
+	case int16:
+		enc.int(int64(typed))
+	case int32:
+		enc.int(int64(typed))
+	case int64:
+		enc.int(typed)
+	case uint:
+		enc.head(cborUint, uint64(typed))
+	case uint8:
+		enc.head(cborUint, uint64(typed))
+	case uint16:
+		enc.head(cborUint, uint64(typed))
+	case uint32:
+		enc.head(cborUint, uint64(typed))
+	case uint64:
+		enc.head(cborUint, typed)
+	case float32:
+		enc.buf.WriteByte(cborSimple | 26)
+		enc.buf.Write(binary.BigEndian.AppendUint32(nil, math.Float32bits(typed)))
+	case float64:
+		enc.buf.WriteByte(cborSimple | 27)
+		enc.buf.Write(binary.BigEndian.AppendUint64(nil, math.Float64bits(typed)))
+	case string:
+		enc.head(cborText, uint64(len(typed)))
+		enc.buf.WriteString(typed)
+	case []byte:
+		enc.head(cborBytes, uint64(len(typed)))
+		enc.buf.Write(typed)
+	case time.Time:
+		str := typed.Format(time.RFC3339Nano)
+		enc.head(cborTag, 0)
+		enc.head(cborText, uint64(len(str)))
+		enc.buf.WriteString(str)
+	case time.Duration:
+		enc.int(int64(typed))
+	case *big.Int:
+		if typed.IsInt64() {
+			enc.int(typed.Int64())
+			return nil
+		}
+		if typed.Sign() < 0 {
+			enc.head(cborTag, 3)
+			typed = new(big.Int).Sub(new(big.Int).Neg(typed), big.NewInt(1))
+		} else {
+			enc.head(cborTag, 2)
+		}
+		b := typed.Bytes()
+		enc.head(cborBytes, uint64(len(b)))
+		enc.buf.Write(b)
+	case *Model:
+		return enc.model(typed)
+	case Ref:
+		enc.head(cborMap, 1)
+		enc.head(cborText, uint64(len(refKey)))
+		enc.buf.WriteString(refKey)
+		return enc.encode(typed.ID)
+	default:
+		return encodeOther(typed, enc.encode)
+	}
+	return nil
+}
+
+/*
+model writes a hash model as a map or a list model as an array.
+*/
+func (enc *cborEncoder) model(mdl *Model) error {
+	for _, m := range enc.visited {
+		if m == mdl {
+			return errors.WrapE(CircularReference, errors.Errorf("model contains itself"))
+		}
+	}
+	enc.visited = append(enc.visited, mdl)
+	defer func() { enc.visited = enc.visited[:len(enc.visited)-1] }()
+
+	keys, values := mdl.entries()
+	if stdModel.ModelTypeList == mdl.GetType() {
+		enc.head(cborArray, uint64(len(values)))
+	} else {
+		enc.head(cborMap, uint64(len(values)))
+	}
+	for k, v := range values {
+		if nil != keys {
+			enc.head(cborText, uint64(len(keys[k])))
+			enc.buf.WriteString(keys[k])
+		}
+		if err := enc.encode(v); nil != err {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+encodeOther converts values without a direct binary representation, such as
+named scalar types, structs and maps, and encodes the result with encode.
+*/
+func encodeOther(v any, encode func(any) error) error {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Bool:
+		return encode(rv.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return encode(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return encode(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return encode(rv.Float())
+	case reflect.String:
+		return encode(rv.String())
+	}
+
+	bld := &builder{visited: map[uintptr]bool{}}
+	val, err := bld.build("", rv)
+	if nil != err {
+		return err
+	}
+	if reflect.TypeOf(val) == rv.Type() {
+		return errors.WrapE(InvalidDataSet, errors.Errorf("cannot encode value of type %T", v))
+	}
+	return encode(val)
+}
+
+/*
+cborDecoder reads CBOR data items.
+*/
+type cborDecoder struct {
+	data []byte
+	pos  int
+}
+
+/*
+maxDecodeDepth limits the nesting depth of decoded binary data.
+*/
+const maxDecodeDepth = 10000
+
+/*
+read returns the next n bytes.
+*/
+func (dec *cborDecoder) read(n uint64) ([]byte, error) {
+	if n > uint64(len(dec.data)-dec.pos) {
+		return nil, errors.Errorf("unexpected end of data at offset %d", dec.pos)
+	}
+	b := dec.data[dec.pos : dec.pos+int(n)]
+	dec.pos += int(n)
+	return b, nil
+}
+
+/*
+head reads an initial byte and its argument. indefinite is true for
+indefinite-length items.
+*/
+func (dec *cborDecoder) head() (major, info byte, arg uint64, indefinite bool, err error) {
+	b, err := dec.read(1)
+	if nil != err {
+		return 0, 0, 0, false, err
+	}
+	major, info = b[0]&0xe0, b[0]&0x1f
+	switch {
+	case info < 24:
+		arg = uint64(info)
+	case 24 == info:
+		b, err = dec.read(1)
+		if nil == err {
+			arg = uint64(b[0])
+		}
+	case 25 == info:
+		b, err = dec.read(2)
+		if nil == err {
+			arg = uint64(binary.BigEndian.Uint16(b))
+		}
+	case 26 == info:
+		b, err = dec.read(4)
+		if nil == err {
+			arg = uint64(binary.BigEndian.Uint32(b))
+		}
+	case 27 == info:
+		b, err = dec.read(8)
+		if nil == err {
+			arg = binary.BigEndian.Uint64(b)
+		}
+	case 31 == info:
+		indefinite = true
+	default:
+		err = errors.Errorf("invalid additional information %d at offset %d", info, dec.pos-1)
+	}
+	return major, info, arg, indefinite, err
+}
+
+/*
+isBreak consumes and reports a break stop code.
+*/
+func (dec *cborDecoder) isBreak() bool {
+	if dec.pos < len(dec.data) && 0xff == dec.data[dec.pos] {
+		dec.pos++
+		return true
+	}
+	return false
+}
+
+/*
+decode reads a single data item. If into is not nil, maps and arrays are
+decoded into it instead of a new model.
+*/
+func (dec *cborDecoder) decode(into *Model, depth int) (any, error) {
+	if depth > maxDecodeDepth {
+		return nil, errors.Errorf("maximum nesting depth exceeded")
+	}
+	start := dec.pos
+	major, info, arg, indefinite, err := dec.head()
+	if nil != err {
+		return nil, err
+	}
+
+	switch major {
+	case cborUint:
+		if arg > math.MaxInt64 {
+			return arg, nil
+		}
+		return int64(arg), nil
+
+	case cborNegInt:
+		if arg > math.MaxInt64 {
+			return new(big.Int).Sub(big.NewInt(-1), new(big.Int).SetUint64(arg)), nil
+		}
+		return -1 - int64(arg), nil
+
+	case cborBytes, cborText:
+		var b []byte
+		if indefinite {
+			for !dec.isBreak() {
+				chunkMajor, _, n, chunkIndefinite, err := dec.head()
+				if nil != err {
+					return nil, err
+				}
+				if chunkMajor != major || chunkIndefinite {
+					return nil, errors.Errorf("invalid indefinite-length string chunk at offset %d", start)
+				}
+				chunk, err := dec.read(n)
+				if nil != err {
+					return nil, err
+				}
+				b = append(b, chunk...)
+			}
+		} else {
+			chunk, err := dec.read(arg)
+			if nil != err {
+				return nil, err
+			}
+			b = append([]byte{}, chunk...)
+		}
+		if cborText == major {
+			return string(b), nil
+		}
+		return b, nil
+
+	case cborArray:
+		mdl := into
+		if nil == mdl || stdModel.ModelTypeList != mdl.GetType() {
+			mdl = New(stdModel.ModelTypeList)
+		}
+		for a := uint64(0); indefinite || a < arg; a++ {
+			if indefinite && dec.isBreak() {
+				break
+			}
+			val, err := dec.decode(nil, depth+1)
+			if nil != err {
+				return nil, err
+			}
+			mdl.Push(val)
+		}
+		return mdl, nil
+
+	case cborMap:
+		mdl := into
+		if nil == mdl || stdModel.ModelTypeHash != mdl.GetType() {
+			mdl = New(stdModel.ModelTypeHash)
+		}
+		for a := uint64(0); indefinite || a < arg; a++ {
+			if indefinite && dec.isBreak() {
+				break
+			}
+			key, err := dec.decode(nil, depth+1)
+			if nil != err {
+				return nil, err
+			}
+			val, err := dec.decode(nil, depth+1)
+			if nil != err {
+				return nil, err
+			}
+			mdl.Set(cast.To[string](key), val)
+		}
+		if ref, ok := refFromMap(mdl); ok && nil == into {
+			return ref, nil
+		}
+		return mdl, nil
+
+	case cborTag:
+		content, err := dec.decode(nil, depth+1)
+		if nil != err {
+			return nil, err
+		}
+		return cborTagged(arg, content)
+
+	default: // cborSimple
+		switch info {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22, 23:
+			return nil, nil
+		case 25:
+			return float64(halfToFloat(uint16(arg))), nil
+		case 26:
+			return math.Float32frombits(uint32(arg)), nil
+		case 27:
+			return math.Float64frombits(arg), nil
+		}
+		return nil, errors.Errorf("unsupported simple value %d at offset %d", arg, start)
+	}
+}
+
+/*
+cborTagged interprets the content of a tagged data item. Unknown tags are
+ignored and the content is returned unchanged.
+*/
+func cborTagged(tag uint64, content any) (any, error) {
+	switch tag {
+	case 0:
+		str, ok := content.(string)
+		if !ok {
+			return nil, errors.Errorf("tag 0 requires a text string")
+		}
+		return time.Parse(time.RFC3339Nano, str)
+	case 1:
+		switch epoch := content.(type) {
+		case int64:
+			return time.Unix(epoch, 0).UTC(), nil
+		case uint64:
+			return time.Unix(int64(epoch), 0).UTC(), nil
+		case float32:
+			sec, frac := math.Modf(float64(epoch))
+			return time.Unix(int64(sec), int64(frac*1e9)).UTC(), nil
+		case float64:
+			sec, frac := math.Modf(epoch)
+			return time.Unix(int64(sec), int64(frac*1e9)).UTC(), nil
+		}
+		return nil, errors.Errorf("tag 1 requires a number")
+	case 2, 3:
+		b, ok := content.([]byte)
+		if !ok {
+			return nil, errors.Errorf("tag %d requires a byte string", tag)
+		}
+		n := new(big.Int).SetBytes(b)
+		if 3 == tag {
+			n.Sub(big.NewInt(-1), n)
+		}
+		return n, nil
+	}
+	return content, nil
+}
+
+/*
+halfToFloat converts an IEEE 754 half-precision float to a float32.
+*/
+func halfToFloat(h uint16) float32 {
+	sign := uint32(h>>15) << 31
+	exp := uint32(h>>10) & 0x1f
+	frac := uint32(h) & 0x3ff
+	switch exp {
+	case 0:
+		f := float32(frac) / (1 << 24)
+		if 0 != sign {
+			return -f
+		}
+		return f
+	case 0x1f:
+		return math.Float32frombits(sign | 0x7f800000 | frac<<13)
+	}
+	return math.Float32frombits(sign | (exp+112)<<23 | frac<<13)
+}
@@ -0,0 +1,227 @@
+package model
+
+import (
+	"encoding/csv"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bdlm/cast/v2"
+	"github.com/bdlm/errors/v2"
+	stdModel "github.com/bdlm/std/v2/model"
+)
+
+/*
+CSVOptions configures ReadCSV.
+*/
+type CSVOptions struct {
+	// Comma is the field delimiter, ',' by default.
+	Comma rune
+	// Comment, if not 0, is a comment character. Lines beginning with it
+	// are ignored.
+	Comment rune
+	// Header lists the column names. If empty, the first record is used as
+	// the header row.
+	Header []string
+	// InferTypes converts cells to bool, int64 or float64 values when they
+	// look like one, and empty cells to nil. Otherwise all cells are stored
+	// as strings.
+	InferTypes bool
+	// TrimLeadingSpace ignores leading white space in fields.
+	TrimLeadingSpace bool
+}
+
+/*
+ReadCSV reads CSV records from r and returns a list model containing a hash
+model for each record, keyed by the header row.
+*/
+func ReadCSV(r io.Reader, opts CSVOptions) (*Model, error) {
+	reader := csv.NewReader(r)
+	if 0 != opts.Comma {
+		reader.Comma = opts.Comma
+	}
+	reader.Comment = opts.Comment
+	reader.TrimLeadingSpace = opts.TrimLeadingSpace
+	reader.ReuseRecord = true
+
+	header := opts.Header
+	if 0 == len(header) {
+		record, err := reader.Read()
+		if io.EOF == err {
+			return New(stdModel.ModelTypeList), nil
+		}
+		if nil != err {
+			return nil, errors.Wrap(err, "could not read header row")
+		}
+		header = append([]string{}, record...)
+	} else {
+		reader.FieldsPerRecord = len(header)
+	}
+
+	mdl := New(stdModel.ModelTypeList)
+	for {
+		record, err := reader.Read()
+		if io.EOF == err {
+			break
+		}
+		if nil != err {
+			return nil, errors.Wrap(err, "could not read record")
+		}
+		row := New(stdModel.ModelTypeHash)
+		for k, cell := range record {
+			if opts.InferTypes {
+				row.Set(header[k], inferType(cell))
+			} else {
+				row.Set(header[k], cell)
+			}
+		}
+		mdl.Push(row)
+	}
+	return mdl, nil
+}
+
+/*
+ReadTSV reads tab-separated records from r. See ReadCSV.
+*/
+func ReadTSV(r io.Reader, opts CSVOptions) (*Model, error) {
+	opts.Comma = '\t'
+	return ReadCSV(r, opts)
+}
+
+/*
+WriteCSV writes the hash models in the list model mdl to w as CSV records,
+preceded by a header row.
+
+Nested models are flattened into dotted column names, e.g. "address.city"
+or "tags.0". If columns is empty, every column found in the rows is written
+in the order first seen.
+*/
+func WriteCSV(w io.Writer, mdl *Model, columns ...string) error {
+	return writeDelimited(w, mdl, ',', columns)
+}
+
+/*
+WriteTSV writes the hash models in the list model mdl to w as tab-separated
+records. See WriteCSV.
+*/
+func WriteTSV(w io.Writer, mdl *Model, columns ...string) error {
+	return writeDelimited(w, mdl, '\t', columns)
+}
+
+/*
+writeDelimited implements WriteCSV and WriteTSV.
+*/
+func writeDelimited(w io.Writer, mdl *Model, comma rune, columns []string) error {
+	if stdModel.ModelTypeList != mdl.GetType() {
+		return errors.WrapE(InvalidMethodContext, errors.Errorf("WriteCSV() is only valid for stdModel.ModelTypeList model types"))
+	}
+
+	_, values := mdl.entries()
+	rows := make([]map[string]any, len(values))
+	order := []string{}
+	seen := map[string]bool{}
+	for k, v := range values {
+		row, ok := v.(*Model)
+		if !ok || stdModel.ModelTypeHash != row.GetType() {
+			return errors.WrapE(InvalidDataSet, errors.Errorf("row %d is not a hash model", k))
+		}
+		rows[k] = map[string]any{}
+		flattenValue(row, "", FlattenOptions{}, func(key string, val any) {
+			if _, ok := val.(*Model); ok {
+				return
+			}
+			rows[k][key] = val
+			if !seen[key] {
+				seen[key] = true
+				order = append(order, key)
+			}
+		})
+	}
+	if 0 == len(columns) {
+		columns = order
+	}
+
+	writer := csv.NewWriter(w)
+	writer.Comma = comma
+	if err := writer.Write(columns); nil != err {
+		return errors.Wrap(err, "could not write header row")
+	}
+	record := make([]string, len(columns))
+	for k, row := range rows {
+		for a, col := range columns {
+			str, err := cellString(row[col])
+			if nil != err {
+				return errors.Wrap(err, "could not convert row %d column '%s'", k, col)
+			}
+			record[a] = str
+		}
+		if err := writer.Write(record); nil != err {
+			return errors.Wrap(err, "could not write row %d", k)
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+/*
+cellString formats a value as a CSV cell.
+*/
+func cellString(v any) (string, error) {
+	switch typed := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return typed, nil
+	case time.Time:
+		return typed.Format(time.RFC3339Nano), nil
+	}
+	return cast.ToE[string](v)
+}
+
+/*
+inferType converts a CSV cell to a bool, int64 or float64 value when it
+represents one, using cast. Empty cells become nil. Only plain decimal
+numbers are converted: integers with leading zeros, such as zip codes and
+phone numbers, and non-finite values such as "NaN" and "inf" stay strings.
+*/
+func inferType(cell string) any {
+	if "" == cell {
+		return nil
+	}
+	if strings.EqualFold("true", cell) || strings.EqualFold("false", cell) {
+		return cast.To[bool](cell)
+	}
+	if !isDecimal(cell) || leadingZero(cell) {
+		return cell
+	}
+	if i, err := cast.ToE[int64](cell); nil == err && strconv.FormatInt(i, 10) == strings.TrimPrefix(cell, "+") {
+		return i
+	}
+	if f, err := cast.ToE[float64](cell); nil == err && !math.IsInf(f, 0) && !math.IsNaN(f) {
+		if _, err := strconv.ParseFloat(cell, 64); nil == err {
+			return f
+		}
+	}
+	return cell
+}
+
+/*
+isDecimal reports whether cell only holds the characters of a decimal
+number, excluding hexadecimal, underscores and words such as "inf".
+*/
+func isDecimal(cell string) bool {
+	return !strings.ContainsFunc(cell, func(r rune) bool {
+		return !strings.ContainsRune("0123456789+-.eE", r)
+	})
+}
+
+/*
+leadingZero reports whether the integer part of a number has a leading zero,
+e.g. "007" or "-01.5".
+*/
+func leadingZero(cell string) bool {
+	digits := strings.TrimLeft(cell, "+-")
+	return 1 < len(digits) && '0' == digits[0] && '0' <= digits[1] && digits[1] <= '9'
+}
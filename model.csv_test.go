@@ -0,0 +1,118 @@
+package model_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/bdlm/model"
+	stdModel "github.com/bdlm/std/v2/model"
+)
+
+func TestReadCSV(t *testing.T) {
+	input := "name,age,score,active,note\nalice,30,9.5,true,\nbob,42,7,false,hi\n"
+
+	mdl, err := model.ReadCSV(strings.NewReader(input), model.CSVOptions{InferTypes: true})
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if data, _, _ := mdl.Data(); stdModel.ModelTypeList != mdl.GetType() || 2 != len(data) {
+		t.Fatalf("expected a list of 2 rows, received %d", len(data))
+	}
+	val, _ := mdl.Get(0)
+	row, _ := val.Model()
+	if name, _ := row.Get("name"); "alice" != name.Value() {
+		t.Errorf("expected 'alice', received %#v", name.Value())
+	}
+	if age, _ := row.Get("age"); int64(30) != age.Value() {
+		t.Errorf("expected int64 30, received %#v", age.Value())
+	}
+	if score, _ := row.Get("score"); 9.5 != score.Value() {
+		t.Errorf("expected 9.5, received %#v", score.Value())
+	}
+	if active, _ := row.Get("active"); true != active.Value() {
+		t.Errorf("expected true, received %#v", active.Value())
+	}
+	if note, _ := row.Get("note"); nil != note.Value() {
+		t.Errorf("expected empty cell to be nil, received %#v", note.Value())
+	}
+
+	mdl, err = model.ReadCSV(strings.NewReader(input), model.CSVOptions{})
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	val, _ = mdl.Get(1)
+	row, _ = val.Model()
+	if age, _ := row.Get("age"); "42" != age.Value() {
+		t.Errorf("expected string '42' without inference, received %#v", age.Value())
+	}
+}
+
+func TestReadCSVInferKeepsStrings(t *testing.T) {
+	input := "cell\nNaN\ninf\nInfinity\n007\n0123456789\n-01.5\n0x1F\n1_000\n1e999\n0\n-0.5\n+7\n1e3\n"
+	mdl, err := model.ReadCSV(strings.NewReader(input), model.CSVOptions{InferTypes: true})
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []any{"NaN", "inf", "Infinity", "007", "0123456789", "-01.5", "0x1F", "1_000", "1e999", int64(0), -0.5, int64(7), 1000.0}
+	for k, exp := range expected {
+		val, _ := mdl.Get(k)
+		row, _ := val.Model()
+		if cell, _ := row.Get("cell"); exp != cell.Value() {
+			t.Errorf("row %d: expected %#v, received %#v", k, exp, cell.Value())
+		}
+	}
+}
+
+func TestReadTSVHeader(t *testing.T) {
+	mdl, err := model.ReadTSV(strings.NewReader("a\tb\nc\td\n"), model.CSVOptions{Header: []string{"x", "y"}})
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if data, _, _ := mdl.Data(); 2 != len(data) {
+		t.Fatalf("expected the first record to be data, received %d rows", len(data))
+	}
+	val, _ := mdl.Get(1)
+	row, _ := val.Model()
+	if y, _ := row.Get("y"); "d" != y.Value() {
+		t.Errorf("expected 'd', received %#v", y.Value())
+	}
+
+	if _, err := model.ReadTSV(strings.NewReader("a\tb\tc\n"), model.CSVOptions{Header: []string{"x", "y"}}); nil == err {
+		t.Errorf("expected an error for a record with too many fields")
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	mdl := model.New(stdModel.ModelTypeList)
+	if err := mdl.UnmarshalJSON([]byte(`[
+		{"name": "alice", "address": {"city": "Paris", "zip": "75001"}, "tags": ["a", "b"]},
+		{"name": "bob, jr", "address": {"city": "Rome"}, "age": 42}
+	]`)); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := model.WriteCSV(buf, mdl); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := "address.city,address.zip,name,tags.0,tags.1,age\n" +
+		"Paris,75001,alice,a,b,\n" +
+		"Rome,,\"bob, jr\",,,42\n"
+	if expected != buf.String() {
+		t.Errorf("expected\n%s\nreceived\n%s", expected, buf.String())
+	}
+
+	buf.Reset()
+	if err := model.WriteTSV(buf, mdl, "address.city", "name"); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected = "address.city\tname\nParis\talice\nRome\tbob, jr\n"
+	if expected != buf.String() {
+		t.Errorf("expected\n%s\nreceived\n%s", expected, buf.String())
+	}
+
+	if err := model.WriteCSV(buf, model.New(stdModel.ModelTypeHash)); nil == err {
+		t.Errorf("expected an error for a hash model")
+	}
+}
@@ -0,0 +1,461 @@
+package model
+
+import (
+	"encoding"
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/bdlm/errors/v2"
+	stdModel "github.com/bdlm/std/v2/model"
+)
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	modelPtrType        = reflect.TypeOf((*Model)(nil))
+	timeType            = reflect.TypeOf(time.Time{})
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+/*
+timeLayouts lists the layouts used to parse time.Time values from strings.
+*/
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	time.DateOnly,
+}
+
+/*
+FieldError describes a value that could not be decoded.
+*/
+type FieldError struct {
+	Path string // path to the value in the model, e.g. "items[2].name"
+	Err  error  // the conversion error
+}
+
+/*
+Error implements error.
+*/
+func (e *FieldError) Error() string {
+	path := e.Path
+	if "" == path {
+		path = "(root)"
+	}
+	return fmt.Sprintf("%s: %v", path, e.Err)
+}
+
+/*
+Unwrap returns the underlying conversion error.
+*/
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+/*
+DecodeError collects every FieldError encountered by Decode. Decoding
+continues past field errors, so all values that could be converted are
+still populated.
+*/
+type DecodeError struct {
+	Errors []*FieldError
+}
+
+/*
+Error implements error.
+*/
+func (e *DecodeError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for k, fe := range e.Errors {
+		msgs[k] = fe.Error()
+	}
+	return fmt.Sprintf("decoding failed: %s", strings.Join(msgs, "; "))
+}
+
+/*
+Unwrap returns the list of field errors.
+*/
+func (e *DecodeError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for k, fe := range e.Errors {
+		errs[k] = fe
+	}
+	return errs
+}
+
+/*
+Decode populates the Go value pointed to by target with the data stored in
+mdl.
+
+Hash models decode into structs and maps, list models decode into slices and
+arrays. Struct fields are matched by their `model` tag, falling back to the
+`json` tag and then the field name (case-insensitive). Scalars are converted
+using bdlm/cast. time.Time, time.Duration and encoding.TextUnmarshaler
+targets are decoded from their string representations. Unmarshaler targets
+receive the output of Marshal for their portion of the data.
+
+Every value that cannot be decoded is reported in the returned *DecodeError
+along with its path.
+*/
+func Decode(mdl *Model, target any) error {
+	rv := reflect.ValueOf(target)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return errors.WrapE(InvalidTarget, errors.Errorf("Decode() requires a non-nil pointer, received %T", target))
+	}
+
+	dec := &decoder{}
+	dec.decode("", mdl, rv.Elem())
+	if len(dec.errs) > 0 {
+		return &DecodeError{Errors: dec.errs}
+	}
+	return nil
+}
+
+/*
+decoder holds the state of a single Decode call.
+*/
+type decoder struct {
+	errs []*FieldError
+}
+
+/*
+fail records a field error.
+*/
+func (dec *decoder) fail(path string, err error) {
+	dec.errs = append(dec.errs, &FieldError{Path: path, Err: err})
+}
+
+/*
+decode converts src and stores it in dst.
+*/
+func (dec *decoder) decode(path string, src any, dst reflect.Value) {
+	src = unwrap(src)
+
+	// Values that already have the target type are assigned directly.
+	if nil != src && reflect.TypeOf(src) == dst.Type() {
+		dst.Set(reflect.ValueOf(src))
+		return
+	}
+
+	// Pointers are allocated as needed, nil clears them.
+	if dst.Kind() == reflect.Pointer {
+		if nil == src {
+			dst.Set(reflect.Zero(dst.Type()))
+			return
+		}
+		if dst.Type() == modelPtrType {
+			dec.fail(path, errors.Errorf("cannot decode %T into *model.Model", src))
+			return
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		dec.decode(path, src, dst.Elem())
+		return
+	}
+
+	if dst.Kind() == reflect.Interface {
+		if nil == src {
+			dst.Set(reflect.Zero(dst.Type()))
+			return
+		}
+		native := reflect.ValueOf(toNative(src))
+		if !native.Type().AssignableTo(dst.Type()) {
+			dec.fail(path, errors.Errorf("cannot assign %T to %s", src, dst.Type()))
+			return
+		}
+		dst.Set(native)
+		return
+	}
+
+	if reflect.PointerTo(dst.Type()).Implements(unmarshalerType) {
+		b, err := Marshal(src)
+		if nil == err {
+			err = dst.Addr().Interface().(Unmarshaler).UnmarshalModel(b)
+		}
+		if nil != err {
+			dec.fail(path, err)
+		}
+		return
+	}
+
+	switch dst.Type() {
+	case durationType:
+		dec.decodeDuration(path, src, dst)
+		return
+	case timeType:
+		dec.decodeTime(path, src, dst)
+		return
+	}
+
+	if str, ok := src.(string); ok && reflect.PointerTo(dst.Type()).Implements(textUnmarshalerType) {
+		if err := dst.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(str)); nil != err {
+			dec.fail(path, err)
+		}
+		return
+	}
+
+	switch dst.Kind() {
+	case reflect.Struct:
+		dec.decodeStruct(path, src, dst)
+	case reflect.Map:
+		dec.decodeMap(path, src, dst)
+	case reflect.Slice:
+		dec.decodeSlice(path, src, dst)
+	case reflect.Array:
+		dec.decodeArray(path, src, dst)
+	default:
+		if _, ok := src.(*Model); ok {
+			dec.fail(path, errors.Errorf("cannot decode a model into %s", dst.Type()))
+			return
+		}
+		val, err := castScalar(src, dst.Type())
+		if nil != err {
+			dec.fail(path, err)
+			return
+		}
+		dst.Set(val)
+	}
+}
+
+/*
+decodeDuration decodes a time.Duration from a duration string or a number
+of nanoseconds.
+*/
+func (dec *decoder) decodeDuration(path string, src any, dst reflect.Value) {
+	if str, ok := src.(string); ok {
+		d, err := time.ParseDuration(str)
+		if nil != err {
+			dec.fail(path, err)
+			return
+		}
+		dst.SetInt(int64(d))
+		return
+	}
+	val, err := castScalar(src, dst.Type())
+	if nil != err {
+		dec.fail(path, err)
+		return
+	}
+	dst.Set(val)
+}
+
+/*
+decodeTime decodes a time.Time from a string in one of the supported layouts.
+*/
+func (dec *decoder) decodeTime(path string, src any, dst reflect.Value) {
+	str, ok := src.(string)
+	if !ok {
+		dec.fail(path, errors.Errorf("cannot decode %T into time.Time", src))
+		return
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, str); nil == err {
+			dst.Set(reflect.ValueOf(t))
+			return
+		}
+	}
+	dec.fail(path, errors.Errorf("cannot parse '%s' as a time", str))
+}
+
+/*
+decodeStruct decodes a hash model into a struct.
+*/
+func (dec *decoder) decodeStruct(path string, src any, dst reflect.Value) {
+	mdl, ok := src.(*Model)
+	if !ok || stdModel.ModelTypeHash != mdl.GetType() {
+		dec.fail(path, errors.Errorf("cannot decode %T into %s, a hash model is required", src, dst.Type()))
+		return
+	}
+
+	keys, values := mdl.entries()
+	for _, fld := range structFields(dst.Type()) {
+		idx := findKey(keys, fld.name)
+		if idx < 0 {
+			continue
+		}
+		fv, ok := fieldByIndex(dst, fld.index)
+		if !ok {
+			continue
+		}
+		dec.decode(joinPath(path, fld.name), values[idx], fv)
+	}
+}
+
+/*
+decodeMap decodes a hash model into a map.
+*/
+func (dec *decoder) decodeMap(path string, src any, dst reflect.Value) {
+	if nil == src {
+		dst.Set(reflect.Zero(dst.Type()))
+		return
+	}
+	mdl, ok := src.(*Model)
+	if !ok || stdModel.ModelTypeHash != mdl.GetType() {
+		dec.fail(path, errors.Errorf("cannot decode %T into %s, a hash model is required", src, dst.Type()))
+		return
+	}
+
+	if dst.IsNil() {
+		dst.Set(reflect.MakeMap(dst.Type()))
+	}
+	keyType := dst.Type().Key()
+	elemType := dst.Type().Elem()
+	keys, values := mdl.entries()
+	for k, key := range keys {
+		kv := reflect.New(keyType).Elem()
+		if reflect.PointerTo(keyType).Implements(textUnmarshalerType) {
+			if err := kv.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(key)); nil != err {
+				dec.fail(joinPath(path, key), err)
+				continue
+			}
+		} else {
+			cv, err := castScalar(key, keyType)
+			if nil != err {
+				dec.fail(joinPath(path, key), err)
+				continue
+			}
+			kv.Set(cv)
+		}
+		ev := reflect.New(elemType).Elem()
+		if existing := dst.MapIndex(kv); existing.IsValid() {
+			ev.Set(existing)
+		}
+		dec.decode(joinPath(path, key), values[k], ev)
+		dst.SetMapIndex(kv, ev)
+	}
+}
+
+/*
+decodeSlice decodes a list model into a slice. Byte slices may also be
+decoded from base64 encoded strings.
+*/
+func (dec *decoder) decodeSlice(path string, src any, dst reflect.Value) {
+	if nil == src {
+		dst.Set(reflect.Zero(dst.Type()))
+		return
+	}
+	if str, ok := src.(string); ok && dst.Type().Elem().Kind() == reflect.Uint8 {
+		b, err := base64.StdEncoding.DecodeString(str)
+		if nil != err {
+			dec.fail(path, err)
+			return
+		}
+		dst.SetBytes(b)
+		return
+	}
+	mdl, ok := src.(*Model)
+	if !ok || stdModel.ModelTypeList != mdl.GetType() {
+		dec.fail(path, errors.Errorf("cannot decode %T into %s, a list model is required", src, dst.Type()))
+		return
+	}
+
+	_, values := mdl.entries()
+	slice := reflect.MakeSlice(dst.Type(), len(values), len(values))
+	for k, v := range values {
+		dec.decode(joinPath(path, k), v, slice.Index(k))
+	}
+	dst.Set(slice)
+}
+
+/*
+decodeArray decodes a list model into an array. Surplus list values are
+ignored, surplus array elements are zeroed.
+*/
+func (dec *decoder) decodeArray(path string, src any, dst reflect.Value) {
+	mdl, ok := src.(*Model)
+	if !ok || stdModel.ModelTypeList != mdl.GetType() {
+		dec.fail(path, errors.Errorf("cannot decode %T into %s, a list model is required", src, dst.Type()))
+		return
+	}
+
+	_, values := mdl.entries()
+	for k := 0; k < dst.Len(); k++ {
+		if k >= len(values) {
+			dst.Index(k).Set(reflect.Zero(dst.Type().Elem()))
+			continue
+		}
+		dec.decode(joinPath(path, k), values[k], dst.Index(k))
+	}
+}
+
+/*
+fieldByIndex returns the struct field at index, allocating nil embedded
+struct pointers along the way. It returns false if an embedded pointer is
+unexported and cannot be allocated.
+*/
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for k, idx := range index {
+		if k > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(idx)
+	}
+	return v, true
+}
+
+/*
+findKey returns the position of name in keys. An exact match is preferred,
+otherwise the first case-insensitive match is used. It returns -1 if no key
+matches.
+*/
+func findKey(keys []string, name string) int {
+	fold := -1
+	for k, key := range keys {
+		if key == name {
+			return k
+		}
+		if fold < 0 && strings.EqualFold(key, name) {
+			fold = k
+		}
+	}
+	return fold
+}
+
+/*
+joinPath appends a hash key or list index to a value path.
+*/
+func joinPath(path string, key any) string {
+	if idx, ok := key.(int); ok {
+		return fmt.Sprintf("%s[%d]", path, idx)
+	}
+	if "" == path {
+		return fmt.Sprint(key)
+	}
+	return fmt.Sprintf("%s.%v", path, key)
+}
+
+/*
+toNative converts model data into plain Go values: hash models become
+map[string]any and list models become []any.
+*/
+func toNative(data any) any {
+	data = unwrap(data)
+	mdl, ok := data.(*Model)
+	if !ok {
+		return data
+	}
+	keys, values := mdl.entries()
+	if stdModel.ModelTypeList == mdl.GetType() {
+		list := make([]any, len(values))
+		for k, v := range values {
+			list[k] = toNative(v)
+		}
+		return list
+	}
+	hash := make(map[string]any, len(values))
+	for k, v := range values {
+		hash[keys[k]] = toNative(v)
+	}
+	return hash
+}
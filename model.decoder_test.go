@@ -0,0 +1,120 @@
+package model_test
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/bdlm/errors/v2"
+	"github.com/bdlm/model"
+	stdModel "github.com/bdlm/std/v2/model"
+)
+
+type decodeBase struct {
+	ID      int    `json:"id"`
+	Created string `model:"created"`
+}
+
+type decodeItem struct {
+	Name  string  `model:"name"`
+	Price float64 `json:"price"`
+}
+
+type decodeTarget struct {
+	decodeBase
+	Name    string            `model:"name,omitempty"`
+	Count   int               `json:"count"`
+	Enabled bool              `model:"enabled"`
+	Timeout time.Duration     `model:"timeout"`
+	At      time.Time         `model:"at"`
+	IP      net.IP            `model:"ip"`
+	Tags    []string          `model:"tags"`
+	Labels  map[string]string `model:"labels"`
+	Items   []*decodeItem     `model:"items"`
+	Extra   any               `model:"extra"`
+	Skipped string            `model:"-"`
+}
+
+func TestDecode(t *testing.T) {
+	mdl := model.New(stdModel.ModelTypeHash)
+	err := json.Unmarshal([]byte(`{
+		"id": "42",
+		"created": "yesterday",
+		"name": "widget",
+		"count": 3.0,
+		"enabled": "true",
+		"timeout": "1m30s",
+		"at": "2024-01-02T03:04:05Z",
+		"ip": "10.0.0.1",
+		"tags": ["a", "b"],
+		"labels": {"env": "prod"},
+		"items": [{"name": "one", "price": "1.5"}, {"name": "two", "price": 2}],
+		"extra": {"nested": [1, 2]},
+		"Skipped": "nope"
+	}`), mdl)
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	target := decodeTarget{}
+	if err := model.Decode(mdl, &target); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if 42 != target.ID || "yesterday" != target.Created {
+		t.Errorf("embedded struct not decoded: %+v", target.decodeBase)
+	}
+	if "widget" != target.Name || 3 != target.Count || !target.Enabled {
+		t.Errorf("scalars not decoded: %+v", target)
+	}
+	if 90*time.Second != target.Timeout {
+		t.Errorf("expected 1m30s, received %v", target.Timeout)
+	}
+	if !target.At.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("unexpected time %v", target.At)
+	}
+	if "10.0.0.1" != target.IP.String() {
+		t.Errorf("expected TextUnmarshaler to decode ip, received %v", target.IP)
+	}
+	if 2 != len(target.Tags) || "b" != target.Tags[1] {
+		t.Errorf("unexpected tags %v", target.Tags)
+	}
+	if "prod" != target.Labels["env"] {
+		t.Errorf("unexpected labels %v", target.Labels)
+	}
+	if 2 != len(target.Items) || 1.5 != target.Items[0].Price || "two" != target.Items[1].Name {
+		t.Errorf("unexpected items %+v", target.Items)
+	}
+	if extra, ok := target.Extra.(map[string]any); !ok || 2 != len(extra["nested"].([]any)) {
+		t.Errorf("unexpected extra %#v", target.Extra)
+	}
+	if "" != target.Skipped {
+		t.Errorf("expected skipped field to be empty, received '%s'", target.Skipped)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	mdl := model.New(stdModel.ModelTypeHash)
+	json.Unmarshal([]byte(`{"count": "many", "items": [{"price": "free"}], "timeout": "soon"}`), mdl)
+
+	target := decodeTarget{}
+	err := model.Decode(mdl, &target)
+	decErr, ok := err.(*model.DecodeError)
+	if !ok {
+		t.Fatalf("expected *model.DecodeError, received %T: %v", err, err)
+	}
+	paths := map[string]bool{}
+	for _, fe := range decErr.Errors {
+		paths[fe.Path] = true
+	}
+	for _, path := range []string{"count", "items[0].price", "timeout"} {
+		if !paths[path] {
+			t.Errorf("expected an error for '%s', received %v", path, decErr)
+		}
+	}
+
+	if err := model.Decode(mdl, target); !errors.Is(err, model.InvalidTarget) {
+		t.Errorf("expected model.InvalidTarget, received '%v'", err)
+	}
+}
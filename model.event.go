@@ -0,0 +1,380 @@
+package model
+
+import (
+	"sync"
+	"weak"
+)
+
+/*
+EventType identifies the kind of change described by an Event.
+*/
+type EventType int
+
+const (
+	// EventSet - An existing key or index was assigned a new value.
+	EventSet EventType = iota
+	// EventInsert - A new hash key was set or a value was pushed to a list.
+	EventInsert
+	// EventDelete - A key or index was deleted.
+	EventDelete
+	// EventReorder - The order of the data changed, e.g. by Sort.
+	EventReorder
+	// EventReplace - All data was replaced by SetData.
+	EventReplace
+)
+
+/*
+String implements fmt.Stringer.
+*/
+func (typ EventType) String() string {
+	switch typ {
+	case EventSet:
+		return "set"
+	case EventInsert:
+		return "insert"
+	case EventDelete:
+		return "delete"
+	case EventReorder:
+		return "reorder"
+	case EventReplace:
+		return "replace"
+	}
+	return "unknown"
+}
+
+/*
+Event describes a change to a model.
+*/
+type Event struct {
+	// Type is the kind of change.
+	Type EventType
+	// Model is the model that changed, which may be nested within the
+	// model subscribed to.
+	Model *Model
+	// Key is the hash key or list index that changed in Model. It is nil
+	// for EventReorder and EventReplace.
+	Key any
+	// Path is the path from the subscribed model to Key, e.g.
+	// ["items", 0, "name"]. For EventReorder and EventReplace it is the
+	// path to Model.
+	Path []any
+	// Old is the previous value, for EventSet and EventDelete.
+	Old any
+	// New is the new value, for EventSet, EventInsert and EventReplace.
+	New any
+
+	// index is the position of Key in the data of Model, for EventSet,
+	// EventInsert and EventDelete.
+	index int
+	// prev is a model holding the previous data, for EventReplace, or the
+	// previous key order of a hash model, for EventReorder.
+	prev any
+}
+
+/*
+PathString returns Path formatted like "items[0].name".
+*/
+func (evt Event) PathString() string {
+	path := ""
+	for _, key := range evt.Path {
+		path = joinPath(path, key)
+	}
+	return path
+}
+
+/*
+Subscription is a registered change observer. See Subscribe.
+*/
+type Subscription struct {
+	model *Model
+	fn    func(Event) // synchronous delivery
+	ch    chan Event  // channel delivery
+
+	mux       sync.RWMutex
+	done      chan struct{}
+	cancelled bool
+	once      sync.Once
+}
+
+/*
+Subscribe registers fn to be called with each change made to this model or
+to any model nested within it. Changes to nested models carry the full path
+from this model.
+
+fn is called synchronously by the goroutine making the change, after the
+model lock has been released, so it may read or modify the model.
+*/
+func (mdl *Model) Subscribe(fn func(Event)) *Subscription {
+	sub := &Subscription{model: mdl, fn: fn, done: make(chan struct{})}
+	mdl.obs.add(sub)
+	return sub
+}
+
+/*
+SubscribeChan registers a buffered channel of the given size receiving each
+change made to this model or to any model nested within it. When the buffer
+is full, changes block until the receiver catches up. The channel is closed
+when the subscription is cancelled.
+*/
+func (mdl *Model) SubscribeChan(size int) (<-chan Event, *Subscription) {
+	sub := &Subscription{model: mdl, ch: make(chan Event, size), done: make(chan struct{})}
+	mdl.obs.add(sub)
+	return sub.ch, sub
+}
+
+/*
+Cancel stops delivery of events to this subscription. It is safe to call
+more than once and from within a subscriber.
+*/
+func (sub *Subscription) Cancel() {
+	sub.once.Do(func() {
+		close(sub.done)
+		sub.model.obs.remove(sub)
+		sub.mux.Lock()
+		defer sub.mux.Unlock()
+		sub.cancelled = true
+		if nil != sub.ch {
+			close(sub.ch)
+		}
+	})
+}
+
+/*
+deliver sends evt to the subscriber.
+*/
+func (sub *Subscription) deliver(evt Event) {
+	if nil != sub.fn {
+		select {
+		case <-sub.done:
+		default:
+			sub.fn(evt)
+		}
+		return
+	}
+	sub.mux.RLock()
+	defer sub.mux.RUnlock()
+	if sub.cancelled {
+		return
+	}
+	select {
+	case sub.ch <- evt:
+	case <-sub.done:
+	}
+}
+
+/*
+observers holds the subscriptions and op logs of a model and weak
+references to the models containing it.
+*/
+type observers struct {
+	mux     sync.Mutex
+	subs    []*Subscription
+	logs    []*OpLog
+	parents []weak.Pointer[Model]
+}
+
+/*
+add registers a subscription.
+*/
+func (obs *observers) add(sub *Subscription) {
+	obs.mux.Lock()
+	defer obs.mux.Unlock()
+	obs.subs = append(obs.subs, sub)
+}
+
+/*
+remove unregisters a subscription.
+*/
+func (obs *observers) remove(sub *Subscription) {
+	obs.mux.Lock()
+	defer obs.mux.Unlock()
+	for k, existing := range obs.subs {
+		if existing == sub {
+			obs.subs = append(obs.subs[:k:k], obs.subs[k+1:]...)
+			return
+		}
+	}
+}
+
+/*
+addLog registers an op log.
+*/
+func (obs *observers) addLog(log *OpLog) {
+	obs.mux.Lock()
+	defer obs.mux.Unlock()
+	obs.logs = append(obs.logs, log)
+}
+
+/*
+removeLog unregisters an op log.
+*/
+func (obs *observers) removeLog(log *OpLog) {
+	obs.mux.Lock()
+	defer obs.mux.Unlock()
+	for k, existing := range obs.logs {
+		if existing == log {
+			obs.logs = append(obs.logs[:k:k], obs.logs[k+1:]...)
+			return
+		}
+	}
+}
+
+/*
+addParent records that parent contains this model.
+*/
+func (obs *observers) addParent(parent *Model) {
+	ptr := weak.Make(parent)
+	obs.mux.Lock()
+	defer obs.mux.Unlock()
+	for _, existing := range obs.parents {
+		if existing == ptr {
+			return
+		}
+	}
+	obs.parents = append(obs.parents, ptr)
+}
+
+/*
+removeParent forgets a parent that no longer contains this model.
+*/
+func (obs *observers) removeParent(parent *Model) {
+	ptr := weak.Make(parent)
+	obs.mux.Lock()
+	defer obs.mux.Unlock()
+	for k, existing := range obs.parents {
+		if existing == ptr {
+			obs.parents = append(obs.parents[:k:k], obs.parents[k+1:]...)
+			return
+		}
+	}
+}
+
+/*
+snapshot returns the current subscriptions, op logs and live parents,
+pruning parents that have been garbage collected.
+*/
+func (obs *observers) snapshot() ([]*Subscription, []*OpLog, []*Model) {
+	obs.mux.Lock()
+	defer obs.mux.Unlock()
+	subs, logs := obs.subs, obs.logs
+	var parents []*Model
+	live := obs.parents[:0]
+	for _, ptr := range obs.parents {
+		if parent := ptr.Value(); nil != parent {
+			parents = append(parents, parent)
+			live = append(live, ptr)
+		}
+	}
+	clear(obs.parents[len(live):])
+	obs.parents = live
+	return subs, logs, parents
+}
+
+/*
+active reports whether the model has subscriptions or op logs, or parents
+that may have them.
+*/
+func (obs *observers) active() bool {
+	obs.mux.Lock()
+	defer obs.mux.Unlock()
+	return 0 < len(obs.subs) || 0 < len(obs.logs) || 0 < len(obs.parents)
+}
+
+/*
+adopt records this model as a parent of value if it is a model. The caller
+must hold the model lock.
+*/
+func (mdl *Model) adopt(value any) {
+	if child, ok := unwrap(value).(*Model); ok && nil != child && child != mdl {
+		child.obs.addParent(mdl)
+	}
+}
+
+/*
+change makes a change to this model by calling fn with the model lock held,
+then notifies subscribers of the event fn returns. If the model, or a model
+containing it, is logged by an OpLog, the change is written to the log
+before the lock is released; if it cannot be written it is reverted and the
+error is returned.
+*/
+func (mdl *Model) change(fn func() (Event, error)) (Event, error) {
+	jnl := mdl.lockLogs()
+	mdl.mux.Lock()
+	evt, err := fn()
+	if nil == err {
+		if err = jnl.write(mdl, evt); nil != err {
+			mdl.revertLocked(evt)
+		}
+	}
+	mdl.mux.Unlock()
+	jnl.unlock()
+	if nil != err {
+		return Event{}, err
+	}
+	evt.Model = mdl
+	mdl.emit(evt)
+	return evt, nil
+}
+
+/*
+emit delivers evt to the subscribers of this model and its ancestors. It
+must not be called with the model lock held.
+*/
+func (mdl *Model) emit(evt Event) {
+	if !mdl.obs.active() {
+		return
+	}
+	evt.Model = mdl
+	mdl.propagate(evt, nil)
+}
+
+/*
+propagate delivers evt to the subscribers of this model and passes it on
+to the models containing this one. ancestors holds the models on the
+current path, guarding against cycles.
+*/
+func (mdl *Model) propagate(evt Event, ancestors []*Model) {
+	for _, ancestor := range ancestors {
+		if ancestor == mdl {
+			return
+		}
+	}
+	subs, _, parents := mdl.obs.snapshot()
+	for _, sub := range subs {
+		sub.deliver(evt)
+	}
+	for _, parent := range parents {
+		if !parent.obs.active() {
+			continue
+		}
+		keys := parent.keysOf(mdl)
+		if 0 == len(keys) {
+			mdl.obs.removeParent(parent)
+			continue
+		}
+		for _, key := range keys {
+			parentEvt := evt
+			parentEvt.Path = append([]any{key}, evt.Path...)
+			parent.propagate(parentEvt, append(ancestors, mdl))
+		}
+	}
+}
+
+/*
+keysOf returns the keys at which child is stored in this model.
+*/
+func (mdl *Model) keysOf(child *Model) []any {
+	mdl.mux.Lock()
+	defer mdl.mux.Unlock()
+	var keys []any
+	for k, val := range mdl.data {
+		if unwrap(val) == child {
+			if key, ok := mdl.idxHash[k]; ok {
+				keys = append(keys, key)
+			} else {
+				keys = append(keys, k)
+			}
+		}
+	}
+	return keys
+}
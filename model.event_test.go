@@ -0,0 +1,105 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/bdlm/model"
+	stdModel "github.com/bdlm/std/v2/model"
+)
+
+func TestSubscribe(t *testing.T) {
+	root := model.New(stdModel.ModelTypeHash)
+	items := model.New(stdModel.ModelTypeList)
+	root.Set("items", items)
+
+	events := []model.Event{}
+	sub := root.Subscribe(func(evt model.Event) {
+		events = append(events, evt)
+	})
+
+	row := model.New(stdModel.ModelTypeHash)
+	items.Push(row)
+	row.Set("name", "a")
+	row.Set("name", "b")
+	row.Delete("name")
+	root.Set("count", 1)
+	items.SetData([]any{1, 2})
+	row.Set("name", "orphan")
+
+	expected := []struct {
+		typ  model.EventType
+		path string
+		old  any
+		new  any
+	}{
+		{model.EventInsert, "items[0]", nil, row},
+		{model.EventInsert, "items[0].name", nil, "a"},
+		{model.EventSet, "items[0].name", "a", "b"},
+		{model.EventDelete, "items[0].name", "b", nil},
+		{model.EventInsert, "count", nil, 1},
+		{model.EventReplace, "items", nil, nil},
+	}
+	if len(expected) != len(events) {
+		t.Fatalf("expected %d events, received %d: %v", len(expected), len(events), events)
+	}
+	for k, exp := range expected {
+		evt := events[k]
+		if exp.typ != evt.Type || exp.path != evt.PathString() || exp.old != evt.Old {
+			t.Errorf("event %d: expected %s %s %v, received %s %s %v", k, exp.typ, exp.path, exp.old, evt.Type, evt.PathString(), evt.Old)
+		}
+		if model.EventReplace != exp.typ && exp.new != evt.New {
+			t.Errorf("event %d: expected new value %v, received %v", k, exp.new, evt.New)
+		}
+	}
+	if events[1].Model != row || "name" != events[1].Key {
+		t.Errorf("expected the nested model and key, received %v %v", events[1].Model, events[1].Key)
+	}
+
+	sub.Cancel()
+	sub.Cancel()
+	root.Set("count", 2)
+	if len(expected) != len(events) {
+		t.Errorf("expected no events after Cancel, received %d", len(events)-len(expected))
+	}
+}
+
+func TestSubscribeChan(t *testing.T) {
+	mdl := model.New(stdModel.ModelTypeList)
+	events, sub := mdl.SubscribeChan(2)
+	mdl.Push("a")
+	mdl.Push("b")
+
+	evt := <-events
+	if model.EventInsert != evt.Type || 0 != evt.Key || "a" != evt.New {
+		t.Errorf("unexpected event %+v", evt)
+	}
+	evt = <-events
+	if 1 != evt.Key {
+		t.Errorf("unexpected event %+v", evt)
+	}
+
+	done := make(chan bool)
+	go func() {
+		for range events {
+		}
+		done <- true
+	}()
+	mdl.Push("c")
+	sub.Cancel()
+	<-done
+	mdl.Push("d")
+}
+
+func TestSubscribeReorder(t *testing.T) {
+	mdl := model.New(stdModel.ModelTypeHash)
+	received := []model.EventType{}
+	mdl.Subscribe(func(evt model.Event) {
+		received = append(received, evt.Type)
+	})
+	if err := mdl.UnmarshalJSON([]byte(`{"b": 1, "a": 2}`)); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if 3 != len(received) || model.EventReorder != received[2] {
+		t.Errorf("expected two inserts and a reorder, received %v", received)
+	}
+}
@@ -0,0 +1,688 @@
+package model
+
+import (
+	"container/list"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/bdlm/cast/v2"
+	"github.com/bdlm/errors/v2"
+	stdModel "github.com/bdlm/std/v2/model"
+)
+
+/*
+exprCacheSize is the maximum number of compiled expressions kept by
+CompileExpr.
+*/
+const exprCacheSize = 1024
+
+/*
+exprCache holds the most recently used compiled expressions keyed by
+source.
+*/
+var exprCache = &exprLRU{entries: map[string]*list.Element{}, order: list.New()}
+
+/*
+exprLRU is a least recently used cache of compiled expressions.
+*/
+type exprLRU struct {
+	mux     sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // front is the most recently used *Expr
+}
+
+/*
+get returns the cached expression compiled from src.
+*/
+func (cache *exprLRU) get(src string) (*Expr, bool) {
+	cache.mux.Lock()
+	defer cache.mux.Unlock()
+	elem, ok := cache.entries[src]
+	if !ok {
+		return nil, false
+	}
+	cache.order.MoveToFront(elem)
+	return elem.Value.(*Expr), true
+}
+
+/*
+add caches expr, evicting the least recently used expression when the cache
+is full.
+*/
+func (cache *exprLRU) add(expr *Expr) {
+	cache.mux.Lock()
+	defer cache.mux.Unlock()
+	if elem, ok := cache.entries[expr.src]; ok {
+		cache.order.MoveToFront(elem)
+		return
+	}
+	cache.entries[expr.src] = cache.order.PushFront(expr)
+	if cache.order.Len() > exprCacheSize {
+		oldest := cache.order.Back()
+		cache.order.Remove(oldest)
+		delete(cache.entries, oldest.Value.(*Expr).src)
+	}
+}
+
+/*
+Expr is a compiled expression evaluated against hash model fields. An Expr
+is safe for concurrent use.
+*/
+type Expr struct {
+	src  string
+	eval exprFunc
+}
+
+/*
+exprFunc evaluates a compiled expression node against a value.
+*/
+type exprFunc func(v any) any
+
+/*
+CompileExpr compiles an expression. The most recently used compiled
+expressions are cached, so compiling the same source again is cheap.
+
+Expressions are evaluated against a value, usually a hash model, whose
+fields are referenced by name. Nested fields and list elements are accessed
+with "." and "[]", e.g. "address.city" or "tags[0]". Supported are:
+
+	literals     'str', "str", 12, 1.5, true, false, null
+	comparisons  ==, !=, <, <=, >, >=
+	logic        &&, ||, !, ( )
+	functions    len(v), lower(s), upper(s), trim(s), contains(s, sub),
+	             hasPrefix(s, prefix), hasSuffix(s, suffix), matches(s, re)
+
+Missing fields evaluate to null. Comparisons between a number and a numeric
+string compare the cast values.
+*/
+func CompileExpr(expr string) (*Expr, error) {
+	if cached, ok := exprCache.get(expr); ok {
+		return cached, nil
+	}
+
+	p := &exprParser{src: expr}
+	if err := p.next(); nil != err {
+		return nil, err
+	}
+	eval, err := p.parseOr()
+	if nil != err {
+		return nil, err
+	}
+	if exprEOF != p.tok.kind {
+		return nil, p.errorf("unexpected '%s'", p.tok.text)
+	}
+
+	compiled := &Expr{src: expr, eval: eval}
+	exprCache.add(compiled)
+	return compiled, nil
+}
+
+/*
+Eval evaluates the expression against v and returns the result.
+*/
+func (expr *Expr) Eval(v any) any {
+	return expr.eval(unwrap(v))
+}
+
+/*
+Test evaluates the expression against v and reports whether the result is
+true. Results that are not booleans are cast; null and failed casts are
+false.
+*/
+func (expr *Expr) Test(v any) bool {
+	return truthy(expr.Eval(v))
+}
+
+/*
+Predicate returns the expression as a filter predicate for FilterFunc.
+*/
+func (expr *Expr) Predicate() func(stdModel.Value) bool {
+	return func(val stdModel.Value) bool {
+		return expr.Test(val)
+	}
+}
+
+/*
+String returns the source of the expression.
+*/
+func (expr *Expr) String() string {
+	return expr.src
+}
+
+/*
+FilterExpr returns a new model containing the elements of this model for
+which the expression is true. See CompileExpr.
+*/
+func (mdl *Model) FilterExpr(expr string) (*Model, error) {
+	compiled, err := CompileExpr(expr)
+	if nil != err {
+		return nil, err
+	}
+	return mdl.FilterFunc(compiled.Predicate()), nil
+}
+
+/*
+FilterFunc returns a new model of the same type containing the elements of
+this model for which fn returns true. Hash models keep their keys.
+*/
+func (mdl *Model) FilterFunc(fn func(stdModel.Value) bool) *Model {
+	keys, values := mdl.entries()
+	result := New(mdl.GetType())
+	for k, val := range values {
+		if !fn(&Value{val}) {
+			continue
+		}
+		if nil != keys {
+			result.Set(keys[k], val)
+		} else {
+			result.Push(val)
+		}
+	}
+	return result
+}
+
+/*
+truthy reports whether an expression result is true.
+*/
+func truthy(v any) bool {
+	switch typed := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return typed
+	}
+	result, err := cast.ToE[bool](v)
+	return nil == err && result
+}
+
+/*
+exprTokenKind identifies the type of an expression token.
+*/
+type exprTokenKind int
+
+const (
+	exprEOF exprTokenKind = iota
+	exprIdent
+	exprNumber
+	exprString
+	exprOp
+)
+
+/*
+exprToken is a lexical token of an expression.
+*/
+type exprToken struct {
+	kind  exprTokenKind
+	text  string
+	value any
+	pos   int
+}
+
+/*
+exprParser compiles expressions by recursive descent.
+*/
+type exprParser struct {
+	src string
+	pos int
+	tok exprToken
+}
+
+/*
+errorf returns an InvalidQuery error describing a failure at the current
+token.
+*/
+func (p *exprParser) errorf(format string, args ...any) error {
+	return errors.WrapE(InvalidQuery, errors.Errorf("%s at offset %d in '%s'", fmt.Sprintf(format, args...), p.tok.pos, p.src))
+}
+
+/*
+next reads the next token.
+*/
+func (p *exprParser) next() error {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+	p.tok = exprToken{pos: p.pos}
+	if p.pos >= len(p.src) {
+		p.tok.kind = exprEOF
+		return nil
+	}
+
+	start := p.pos
+	c := p.src[p.pos]
+	switch {
+	case '\'' == c || '"' == c:
+		jp := &jpParser{src: p.src, pos: p.pos}
+		str, err := jp.parseString()
+		if nil != err {
+			return err
+		}
+		p.pos = jp.pos
+		p.tok.kind, p.tok.value = exprString, str
+
+	case '0' <= c && c <= '9':
+		jp := &jpParser{src: p.src, pos: p.pos}
+		num, err := jp.parseNumber()
+		if nil != err {
+			return err
+		}
+		p.pos = jp.pos
+		p.tok.kind, p.tok.value = exprNumber, num
+
+	case '_' == c || c >= utf8.RuneSelf || unicode.IsLetter(rune(c)):
+		for p.pos < len(p.src) {
+			r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+			if '_' != r && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+				break
+			}
+			p.pos += size
+		}
+		p.tok.kind = exprIdent
+
+	default:
+		p.tok.kind = exprOp
+		for _, op := range []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")", "[", "]", ",", ".", "-"} {
+			if strings.HasPrefix(p.src[p.pos:], op) {
+				p.pos += len(op)
+				break
+			}
+		}
+		if start == p.pos {
+			return p.errorf("unexpected '%c'", c)
+		}
+	}
+	p.tok.text = p.src[start:p.pos]
+	return nil
+}
+
+/*
+accept consumes the current token if it is the operator op.
+*/
+func (p *exprParser) accept(op string) (bool, error) {
+	if exprOp != p.tok.kind || op != p.tok.text {
+		return false, nil
+	}
+	return true, p.next()
+}
+
+/*
+expect consumes the operator op or fails.
+*/
+func (p *exprParser) expect(op string) error {
+	ok, err := p.accept(op)
+	if nil == err && !ok {
+		err = p.errorf("expected '%s'", op)
+	}
+	return err
+}
+
+/*
+parseOr parses a logical-or expression.
+*/
+func (p *exprParser) parseOr() (exprFunc, error) {
+	left, err := p.parseAnd()
+	for nil == err {
+		var ok bool
+		if ok, err = p.accept("||"); !ok || nil != err {
+			break
+		}
+		var right exprFunc
+		if right, err = p.parseAnd(); nil != err {
+			break
+		}
+		a, b := left, right
+		left = func(v any) any { return truthy(a(v)) || truthy(b(v)) }
+	}
+	return left, err
+}
+
+/*
+parseAnd parses a logical-and expression.
+*/
+func (p *exprParser) parseAnd() (exprFunc, error) {
+	left, err := p.parseNot()
+	for nil == err {
+		var ok bool
+		if ok, err = p.accept("&&"); !ok || nil != err {
+			break
+		}
+		var right exprFunc
+		if right, err = p.parseNot(); nil != err {
+			break
+		}
+		a, b := left, right
+		left = func(v any) any { return truthy(a(v)) && truthy(b(v)) }
+	}
+	return left, err
+}
+
+/*
+parseNot parses a negation or a comparison.
+*/
+func (p *exprParser) parseNot() (exprFunc, error) {
+	if ok, err := p.accept("!"); nil != err {
+		return nil, err
+	} else if ok {
+		operand, err := p.parseNot()
+		if nil != err {
+			return nil, err
+		}
+		return func(v any) any { return !truthy(operand(v)) }, nil
+	}
+	return p.parseComparison()
+}
+
+/*
+parseComparison parses a comparison of two operands.
+*/
+func (p *exprParser) parseComparison() (exprFunc, error) {
+	left, err := p.parsePostfix()
+	if nil != err {
+		return nil, err
+	}
+	if exprOp != p.tok.kind {
+		return left, nil
+	}
+	op := p.tok.text
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=":
+	default:
+		return left, nil
+	}
+	if err := p.next(); nil != err {
+		return nil, err
+	}
+	right, err := p.parsePostfix()
+	if nil != err {
+		return nil, err
+	}
+	a, b := left, right
+	switch op {
+	case "==":
+		return func(v any) any { return jpDeepEqual(a(v), b(v)) }, nil
+	case "!=":
+		return func(v any) any { return !jpDeepEqual(a(v), b(v)) }, nil
+	case "<":
+		return func(v any) any { return jpLess(a(v), b(v)) }, nil
+	case "<=":
+		return func(v any) any { x, y := a(v), b(v); return jpLess(x, y) || jpDeepEqual(x, y) }, nil
+	case ">":
+		return func(v any) any { return jpLess(b(v), a(v)) }, nil
+	default:
+		return func(v any) any { x, y := a(v), b(v); return jpLess(y, x) || jpDeepEqual(x, y) }, nil
+	}
+}
+
+/*
+parsePostfix parses an operand followed by field and index accessors.
+*/
+func (p *exprParser) parsePostfix() (exprFunc, error) {
+	operand, err := p.parsePrimary()
+	for nil == err {
+		var ok bool
+		if ok, err = p.accept("."); nil != err {
+			break
+		} else if ok {
+			if exprIdent != p.tok.kind {
+				return nil, p.errorf("expected a field name")
+			}
+			base, name := operand, p.tok.text
+			operand = func(v any) any {
+				val, _ := jpMember(base(v), name)
+				return val
+			}
+			err = p.next()
+			continue
+		}
+
+		if ok, err = p.accept("["); nil != err || !ok {
+			break
+		}
+		var index exprFunc
+		if index, err = p.parseOr(); nil != err {
+			break
+		}
+		if err = p.expect("]"); nil != err {
+			break
+		}
+		base := operand
+		operand = func(v any) any { return exprIndex(base(v), index(v)) }
+	}
+	return operand, err
+}
+
+/*
+parsePrimary parses a literal, field, function call or parenthesized
+expression.
+*/
+func (p *exprParser) parsePrimary() (exprFunc, error) {
+	tok := p.tok
+	switch tok.kind {
+	case exprNumber, exprString:
+		return exprLiteral(tok.value), p.next()
+
+	case exprIdent:
+		if err := p.next(); nil != err {
+			return nil, err
+		}
+		switch tok.text {
+		case "true":
+			return exprLiteral(true), nil
+		case "false":
+			return exprLiteral(false), nil
+		case "null", "nil":
+			return exprLiteral(nil), nil
+		}
+		if ok, err := p.accept("("); nil != err {
+			return nil, err
+		} else if ok {
+			return p.parseCall(tok)
+		}
+		name := tok.text
+		return func(v any) any {
+			val, _ := jpMember(v, name)
+			return val
+		}, nil
+
+	case exprOp:
+		switch tok.text {
+		case "(":
+			if err := p.next(); nil != err {
+				return nil, err
+			}
+			expr, err := p.parseOr()
+			if nil != err {
+				return nil, err
+			}
+			return expr, p.expect(")")
+		case "-":
+			if err := p.next(); nil != err {
+				return nil, err
+			}
+			if exprNumber != p.tok.kind {
+				return nil, p.errorf("expected a number")
+			}
+			var num any
+			switch typed := p.tok.value.(type) {
+			case int64:
+				num = -typed
+			case float64:
+				num = -typed
+			}
+			return exprLiteral(num), p.next()
+		}
+	}
+	if exprEOF == tok.kind {
+		return nil, p.errorf("unexpected end of expression")
+	}
+	return nil, p.errorf("unexpected '%s'", tok.text)
+}
+
+/*
+parseCall parses the arguments of a function call and binds the function.
+*/
+func (p *exprParser) parseCall(name exprToken) (exprFunc, error) {
+	args := []exprFunc{}
+	literals := []any{}
+	for {
+		if ok, err := p.accept(")"); nil != err {
+			return nil, err
+		} else if ok {
+			break
+		}
+		if 0 < len(args) {
+			if err := p.expect(","); nil != err {
+				return nil, err
+			}
+		}
+		var literal any = exprNoLiteral{}
+		isLiteral := exprString == p.tok.kind || exprNumber == p.tok.kind
+		literalValue, literalEnd := p.tok.value, p.pos
+		arg, err := p.parseOr()
+		if nil != err {
+			return nil, err
+		}
+		if isLiteral && "" == strings.TrimSpace(p.src[literalEnd:p.tok.pos]) {
+			literal = literalValue
+		}
+		args = append(args, arg)
+		literals = append(literals, literal)
+	}
+
+	arity := map[string]int{
+		"len": 1, "lower": 1, "upper": 1, "trim": 1,
+		"contains": 2, "hasPrefix": 2, "hasSuffix": 2, "matches": 2,
+	}
+	count, ok := arity[name.text]
+	if !ok {
+		p.tok = name
+		return nil, p.errorf("unknown function '%s'", name.text)
+	}
+	if count != len(args) {
+		p.tok = name
+		return nil, p.errorf("%s() requires %d argument(s)", name.text, count)
+	}
+
+	switch name.text {
+	case "len":
+		arg := args[0]
+		return func(v any) any {
+			val := arg(v)
+			if str, ok := val.(string); ok {
+				return int64(utf8.RuneCountInString(str))
+			}
+			if _, values, kind := jpChildren(val); jpScalar != kind {
+				return int64(len(values))
+			}
+			return nil
+		}, nil
+	case "lower":
+		return exprString1(args[0], strings.ToLower), nil
+	case "upper":
+		return exprString1(args[0], strings.ToUpper), nil
+	case "trim":
+		return exprString1(args[0], strings.TrimSpace), nil
+	case "contains":
+		return exprString2(args[0], args[1], strings.Contains), nil
+	case "hasPrefix":
+		return exprString2(args[0], args[1], strings.HasPrefix), nil
+	case "hasSuffix":
+		return exprString2(args[0], args[1], strings.HasSuffix), nil
+	}
+
+	// matches
+	if pattern, ok := literals[1].(string); ok {
+		re, err := regexp.Compile(pattern)
+		if nil != err {
+			p.tok = name
+			return nil, p.errorf("invalid pattern '%s'", pattern)
+		}
+		return exprString2(args[0], exprLiteral(pattern), func(s, _ string) bool { return re.MatchString(s) }), nil
+	}
+	return exprString2(args[0], args[1], func(s, pattern string) bool {
+		re, err := regexp.Compile(pattern)
+		return nil == err && re.MatchString(s)
+	}), nil
+}
+
+/*
+exprNoLiteral marks a function argument that is not a literal.
+*/
+type exprNoLiteral struct{}
+
+/*
+exprLiteral returns an exprFunc producing a constant value.
+*/
+func exprLiteral(val any) exprFunc {
+	return func(any) any { return val }
+}
+
+/*
+exprString1 applies a string function to a string argument. Other values
+produce null.
+*/
+func exprString1(arg exprFunc, fn func(string) string) exprFunc {
+	return func(v any) any {
+		str, ok := exprToString(arg(v))
+		if !ok {
+			return nil
+		}
+		return fn(str)
+	}
+}
+
+/*
+exprString2 applies a string predicate to two string arguments. Other
+values produce false.
+*/
+func exprString2(a, b exprFunc, fn func(string, string) bool) exprFunc {
+	return func(v any) any {
+		x, ok := exprToString(a(v))
+		if !ok {
+			return false
+		}
+		y, ok := exprToString(b(v))
+		return ok && fn(x, y)
+	}
+}
+
+/*
+exprToString casts scalar values to strings.
+*/
+func exprToString(v any) (string, bool) {
+	switch typed := v.(type) {
+	case nil:
+		return "", false
+	case string:
+		return typed, true
+	}
+	if _, _, kind := jpChildren(v); jpScalar != kind {
+		return "", false
+	}
+	str, err := cast.ToE[string](v)
+	return str, nil == err
+}
+
+/*
+exprIndex returns the element or member of base selected by index.
+*/
+func exprIndex(base, index any) any {
+	if str, ok := index.(string); ok {
+		val, _ := jpMember(base, str)
+		return val
+	}
+	num, ok := jpNumber(index)
+	if !ok {
+		return nil
+	}
+	idx := int(num)
+	if float64(idx) != num {
+		return nil
+	}
+	val, _, _ := jpElement(base, idx)
+	return val
+}
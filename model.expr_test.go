@@ -0,0 +1,145 @@
+package model_test
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/bdlm/model"
+	stdModel "github.com/bdlm/std/v2/model"
+)
+
+const exprPeople = `[
+	{"name": "Alice", "status": "active", "age": 34, "address": {"city": "Paris"}, "tags": ["admin"]},
+	{"name": "bob", "status": "active", "age": "29", "address": {"city": "Rome"}, "tags": []},
+	{"name": "Carol", "status": "inactive", "age": 41, "tags": ["ops", "admin"]},
+	{"name": "Dave", "status": "active", "age": 52, "address": {"city": "paris"}}
+]`
+
+func exprNames(t *testing.T, mdl *model.Model, expr string) []string {
+	t.Helper()
+	result, err := mdl.FilterExpr(expr)
+	if nil != err {
+		t.Fatalf("%s: unexpected error: %v", expr, err)
+	}
+	names := []string{}
+	data, _, _ := result.Data()
+	for k := range data {
+		row, _ := result.Get(k)
+		sub, _ := row.Model()
+		name, _ := sub.Get("name")
+		str, _ := name.String()
+		names = append(names, str)
+	}
+	return names
+}
+
+func TestFilterExpr(t *testing.T) {
+	mdl := model.New(stdModel.ModelTypeList)
+	if err := mdl.UnmarshalJSON([]byte(exprPeople)); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		expr     string
+		expected string
+	}{
+		{`status == 'active' && age > 30`, "[Alice Dave]"},
+		{`age >= 29 && age < 41`, "[Alice bob]"},
+		{`!(status == "active") || name == 'bob'`, "[bob Carol]"},
+		{`lower(address.city) == 'paris'`, "[Alice Dave]"},
+		{`address == null`, "[Carol]"},
+		{`tags[0] == 'admin' || tags[1] == 'admin'`, "[Alice Carol]"},
+		{`len(tags) > 1`, "[Carol]"},
+		{`contains(upper(name), 'O') && hasPrefix(name, 'b')`, "[bob]"},
+		{`hasSuffix(name, 'e') && matches(name, '^[A-Z]')`, "[Alice Dave]"},
+		{`trim(' x ') == 'x' && age != -1`, "[Alice bob Carol Dave]"},
+		{`address['city'] == 'Rome'`, "[bob]"},
+	}
+	for _, test := range tests {
+		if names := fmt.Sprint(exprNames(t, mdl, test.expr)); test.expected != names {
+			t.Errorf("%s: expected %s, received %s", test.expr, test.expected, names)
+		}
+	}
+}
+
+func TestCompileExpr(t *testing.T) {
+	expr, err := model.CompileExpr(`a.b == 1`)
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if again, _ := model.CompileExpr(`a.b == 1`); again != expr {
+		t.Errorf("expected the compiled expression to be cached")
+	}
+
+	// The cache keeps the 1024 most recently used expressions.
+	evicted, _ := model.CompileExpr(`evicted == 1`)
+	for k := 0; k < 1024; k++ {
+		model.CompileExpr(`a.b == 1`)
+		model.CompileExpr(fmt.Sprintf("n == %d", k))
+	}
+	if again, _ := model.CompileExpr(`a.b == 1`); again != expr {
+		t.Errorf("expected a recently used expression to stay cached")
+	}
+	if again, _ := model.CompileExpr(`evicted == 1`); again == evicted {
+		t.Errorf("expected the least recently used expression to be evicted")
+	}
+
+	mdl := model.New(stdModel.ModelTypeHash)
+	sub := model.New(stdModel.ModelTypeHash)
+	sub.Set("b", 1)
+	mdl.Set("a", sub)
+
+	wg := sync.WaitGroup{}
+	for k := 0; k < 8; k++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 100; n++ {
+				if !expr.Test(mdl) {
+					t.Errorf("expected true")
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, src := range []string{``, `a ==`, `a == 'x`, `(a`, `foo(a)`, `len(a, b)`, `a # b`, `matches(a, '(')`, `a.`} {
+		if _, err := model.CompileExpr(src); !errors.Is(err, model.InvalidQuery) {
+			t.Errorf("%q: expected InvalidQuery, received %v", src, err)
+		}
+	}
+}
+
+func BenchmarkCompileExpr(b *testing.B) {
+	for n := 0; n < b.N; n++ {
+		model.CompileExpr(`status == 'active' && age > 30`)
+	}
+}
+
+func BenchmarkExprTest(b *testing.B) {
+	row := model.New(stdModel.ModelTypeHash)
+	row.Set("status", "active")
+	row.Set("age", 42)
+	expr, _ := model.CompileExpr(`status == 'active' && age > 30`)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		expr.Test(row)
+	}
+}
+
+func BenchmarkFilterExpr(b *testing.B) {
+	mdl := model.New(stdModel.ModelTypeList)
+	for k := 0; k < 1000; k++ {
+		row := model.New(stdModel.ModelTypeHash)
+		row.Set("status", []string{"active", "inactive"}[k%2])
+		row.Set("age", k%80)
+		mdl.Push(row)
+	}
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		mdl.FilterExpr(`status == 'active' && age > 30`)
+	}
+}
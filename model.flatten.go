@@ -0,0 +1,365 @@
+package model
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/bdlm/errors/v2"
+	stdModel "github.com/bdlm/std/v2/model"
+)
+
+/*
+FlattenOptions configures FlattenWith and UnflattenWith.
+*/
+type FlattenOptions struct {
+	// Separator joins nested keys, "." by default.
+	Separator string
+	// BracketIndex writes list indexes as "a[0]" instead of "a.0". When
+	// unflattening dotted keys, numeric segments are hash keys, and a hash
+	// whose keys are exactly "0", "1", ... in order is restored as a list;
+	// bracketed indexes remove that ambiguity.
+	BracketIndex bool
+	// Escape prefixes separators, brackets and backslashes found in keys with
+	// a backslash so that they survive a round trip.
+	Escape bool
+}
+
+/*
+Flatten returns a single-level hash model keyed by the full path of each
+value in mdl, with nested keys joined by sep, e.g. "a.b.0.c". Empty nested
+models are kept as values so that Unflatten can restore them.
+*/
+func Flatten(mdl *Model, sep string) *Model {
+	return FlattenWith(mdl, FlattenOptions{Separator: sep})
+}
+
+/*
+FlattenWith flattens mdl using opts. See Flatten.
+*/
+func FlattenWith(mdl *Model, opts FlattenOptions) *Model {
+	flat := New(stdModel.ModelTypeHash)
+	flattenValue(mdl, "", opts, func(key string, val any) {
+		flat.Set(key, val)
+	})
+	return flat
+}
+
+/*
+Unflatten rebuilds nested hash and list models from a single-level hash
+model produced by Flatten with the same separator. List indexes may not
+exceed the number of keys in mdl.
+*/
+func Unflatten(mdl *Model, sep string) (*Model, error) {
+	return UnflattenWith(mdl, FlattenOptions{Separator: sep})
+}
+
+/*
+UnflattenWith rebuilds nested models using opts. See Unflatten.
+*/
+func UnflattenWith(mdl *Model, opts FlattenOptions) (*Model, error) {
+	if stdModel.ModelTypeHash != mdl.GetType() {
+		return nil, errors.WrapE(InvalidMethodContext, errors.Errorf("Unflatten() is only valid for stdModel.ModelTypeHash model types"))
+	}
+	opts = opts.withDefaults()
+
+	keys, values := mdl.entries()
+	paths := make([][]flatSegment, len(keys))
+	list := 0 < len(keys)
+	for k, key := range keys {
+		segments, err := parseFlatKey(key, opts)
+		if nil != err {
+			return nil, err
+		}
+		paths[k] = segments
+		list = list && segments[0].index
+	}
+
+	root := New(stdModel.ModelTypeHash)
+	if list {
+		root = New(stdModel.ModelTypeList)
+	}
+	created := map[*Model]bool{root: true}
+	for k, segments := range paths {
+		if err := unflattenSet(root, segments, values[k], len(keys), created); nil != err {
+			return nil, errors.Wrap(err, "could not unflatten key '%s'", keys[k])
+		}
+	}
+	if !opts.BracketIndex {
+		root = restoreLists(root, created)
+	}
+	return root, nil
+}
+
+/*
+withDefaults returns a copy of opts with defaults applied.
+*/
+func (opts FlattenOptions) withDefaults() FlattenOptions {
+	if "" == opts.Separator {
+		opts.Separator = "."
+	}
+	return opts
+}
+
+/*
+flattenValue calls fn for each value in v with its full key path. Nested
+models are traversed; empty nested models are passed to fn as values.
+*/
+func flattenValue(v any, prefix string, opts FlattenOptions, fn func(key string, val any)) {
+	flattenModel(v, prefix, opts.withDefaults(), nil, fn)
+}
+
+/*
+flattenModel implements flattenValue. visited holds the models containing
+v; a model containing itself is not traversed again.
+*/
+func flattenModel(v any, prefix string, opts FlattenOptions, visited []*Model, fn func(key string, val any)) {
+	mdl, ok := v.(*Model)
+	if !ok {
+		fn(prefix, v)
+		return
+	}
+	for _, m := range visited {
+		if m == mdl {
+			return
+		}
+	}
+	visited = append(visited, mdl)
+	keys, values := mdl.entries()
+	if 0 == len(values) && "" != prefix {
+		fn(prefix, New(mdl.GetType()))
+		return
+	}
+	for k, val := range values {
+		var key string
+		switch {
+		case nil != keys:
+			key = keys[k]
+			if opts.Escape {
+				key = escapeFlatKey(key, opts)
+			}
+			if "" != prefix {
+				key = prefix + opts.Separator + key
+			}
+		case opts.BracketIndex:
+			key = prefix + "[" + strconv.Itoa(k) + "]"
+		default:
+			key = strconv.Itoa(k)
+			if "" != prefix {
+				key = prefix + opts.Separator + key
+			}
+		}
+		flattenModel(val, key, opts, visited, fn)
+	}
+}
+
+/*
+escapeFlatKey escapes the separator, brackets and backslashes in key.
+*/
+func escapeFlatKey(key string, opts FlattenOptions) string {
+	special := []string{`\`, opts.Separator}
+	if opts.BracketIndex {
+		special = append(special, "[", "]")
+	}
+	var buf strings.Builder
+	for pos := 0; pos < len(key); {
+		matched := false
+		for _, str := range special {
+			if strings.HasPrefix(key[pos:], str) {
+				buf.WriteString(`\` + str)
+				pos += len(str)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			buf.WriteByte(key[pos])
+			pos++
+		}
+	}
+	return buf.String()
+}
+
+/*
+flatSegment is a single step of a flattened key path.
+*/
+type flatSegment struct {
+	key     string
+	idx     int
+	index   bool // the segment is a bracketed list index
+	numeric bool // the segment is a dotted key that may address a list index
+}
+
+/*
+parseFlatKey splits a flattened key into path segments.
+*/
+func parseFlatKey(key string, opts FlattenOptions) ([]flatSegment, error) {
+	segments := []flatSegment{}
+	var buf strings.Builder
+	pending := true // a key segment is expected
+	flush := func() {
+		seg := flatSegment{key: buf.String()}
+		if !opts.BracketIndex {
+			if idx, err := strconv.Atoi(seg.key); nil == err && idx >= 0 && strconv.Itoa(idx) == seg.key {
+				seg.idx, seg.numeric = idx, true
+			}
+		}
+		segments = append(segments, seg)
+		buf.Reset()
+	}
+
+	for pos := 0; pos < len(key); {
+		switch {
+		case opts.Escape && '\\' == key[pos] && pos+1 < len(key):
+			if strings.HasPrefix(key[pos+1:], opts.Separator) {
+				buf.WriteString(opts.Separator)
+				pos += 1 + len(opts.Separator)
+			} else {
+				buf.WriteByte(key[pos+1])
+				pos += 2
+			}
+			pending = true
+
+		case strings.HasPrefix(key[pos:], opts.Separator):
+			if pending {
+				flush()
+			}
+			pending = true
+			pos += len(opts.Separator)
+
+		case opts.BracketIndex && '[' == key[pos]:
+			end := strings.IndexByte(key[pos:], ']')
+			if end < 0 {
+				return nil, errors.WrapE(InvalidIndex, errors.Errorf("unterminated index in key '%s'", key))
+			}
+			idx, err := strconv.Atoi(key[pos+1 : pos+end])
+			if nil != err || idx < 0 {
+				return nil, errors.WrapE(InvalidIndex, errors.Errorf("invalid index in key '%s'", key))
+			}
+			if pending && (0 < buf.Len() || 0 < pos) {
+				flush()
+			}
+			segments = append(segments, flatSegment{idx: idx, index: true})
+			pending = false
+			pos += end + 1
+
+		default:
+			buf.WriteByte(key[pos])
+			pending = true
+			pos++
+		}
+	}
+	if pending {
+		flush()
+	}
+	return segments, nil
+}
+
+/*
+newContainer returns a new model suitable for addressing by seg.
+*/
+func newContainer(seg flatSegment) *Model {
+	if seg.index {
+		return New(stdModel.ModelTypeList)
+	}
+	return New(stdModel.ModelTypeHash)
+}
+
+/*
+unflattenSet stores value in node at the path described by segments,
+creating intermediate models as needed and recording them in created. List
+indexes must be less than limit, so that a single key cannot allocate an
+arbitrarily large list.
+*/
+func unflattenSet(node *Model, segments []flatSegment, value any, limit int, created map[*Model]bool) error {
+	for k, seg := range segments {
+		last := k == len(segments)-1
+
+		if stdModel.ModelTypeHash == node.GetType() {
+			key := seg.key
+			if seg.index && "" == key {
+				key = strconv.Itoa(seg.idx)
+			}
+			if last {
+				return node.Set(key, value)
+			}
+			if val, err := node.Get(key); nil == err {
+				child, ok := val.Value().(*Model)
+				if !ok {
+					return errors.WrapE(InvalidDataSet, errors.Errorf("key '%s' is not a model", key))
+				}
+				node = child
+				continue
+			}
+			child := newContainer(segments[k+1])
+			created[child] = true
+			node.Set(key, child)
+			node = child
+			continue
+		}
+
+		if !seg.index && !seg.numeric {
+			return errors.WrapE(InvalidIndexType, errors.Errorf("key '%s' is not a list index", seg.key))
+		}
+		if seg.idx >= limit {
+			return errors.WrapE(InvalidIndex, errors.Errorf("index '%d' out of range", seg.idx))
+		}
+		node.mux.Lock()
+		size := len(node.data)
+		node.mux.Unlock()
+		for n := size; n <= seg.idx; n++ {
+			node.Push(nil)
+		}
+		if last {
+			return node.Set(seg.idx, value)
+		}
+		val, _ := node.Get(seg.idx)
+		if child, ok := val.Value().(*Model); ok {
+			node = child
+			continue
+		}
+		if nil != val.Value() {
+			return errors.WrapE(InvalidDataSet, errors.Errorf("index '%d' is not a model", seg.idx))
+		}
+		child := newContainer(segments[k+1])
+		created[child] = true
+		node.Set(seg.idx, child)
+		node = child
+	}
+	return nil
+}
+
+/*
+restoreLists returns node, or a list model if node is a hash model created
+by unflattenSet whose keys are exactly "0", "1", ... in order. Nested
+models created by unflattenSet are restored the same way.
+*/
+func restoreLists(node *Model, created map[*Model]bool) *Model {
+	keys, values := node.entries()
+	for k, val := range values {
+		child, ok := val.(*Model)
+		if !ok || !created[child] {
+			continue
+		}
+		if restored := restoreLists(child, created); restored != child {
+			values[k] = restored
+			if nil == keys {
+				node.Set(k, restored)
+			} else {
+				node.Set(keys[k], restored)
+			}
+		}
+	}
+	if nil == keys || 0 == len(keys) {
+		return node
+	}
+	for k, key := range keys {
+		if strconv.Itoa(k) != key {
+			return node
+		}
+	}
+	list := New(stdModel.ModelTypeList)
+	for _, val := range values {
+		list.Push(val)
+	}
+	return list
+}
@@ -0,0 +1,127 @@
+package model_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bdlm/model"
+	stdModel "github.com/bdlm/std/v2/model"
+)
+
+func TestFlatten(t *testing.T) {
+	mdl := model.New(stdModel.ModelTypeHash)
+	if err := mdl.UnmarshalJSON([]byte(`{"a": {"b": [{"c": 1}, 2]}, "d": "x", "e": {}}`)); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	flat := model.Flatten(mdl, ".")
+	for key, expected := range map[string]any{"a.b.0.c": 1.0, "a.b.1": 2.0, "d": "x"} {
+		val, err := flat.Get(key)
+		if nil != err {
+			t.Errorf("expected key '%s': %v", key, err)
+			continue
+		}
+		if expected != val.Value() {
+			t.Errorf("expected '%s' to be %v, received %#v", key, expected, val.Value())
+		}
+	}
+	if val, err := flat.Get("e"); nil != err {
+		t.Errorf("expected empty model to be kept: %v", err)
+	} else if _, ok := val.Value().(*model.Model); !ok {
+		t.Errorf("expected empty model, received %#v", val.Value())
+	}
+
+	rebuilt, err := model.Unflatten(flat, ".")
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected, _ := mdl.MarshalJSON()
+	received, _ := rebuilt.MarshalJSON()
+	if string(expected) != string(received) {
+		t.Errorf("expected %s, received %s", expected, received)
+	}
+}
+
+func TestFlattenBracketEscape(t *testing.T) {
+	mdl := model.New(stdModel.ModelTypeList)
+	if err := mdl.UnmarshalJSON([]byte(`[{"a.b": [1, [2]], "0": "zero", "x[y]": true}]`)); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	opts := model.FlattenOptions{BracketIndex: true, Escape: true}
+	flat := model.FlattenWith(mdl, opts)
+	for _, key := range []string{`[0].a\.b[0]`, `[0].a\.b[1][0]`, `[0].0`, `[0].x\[y\]`} {
+		if !flat.Has(key) {
+			t.Errorf("expected key '%s'", key)
+		}
+	}
+
+	rebuilt, err := model.UnflattenWith(flat, opts)
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stdModel.ModelTypeList != rebuilt.GetType() {
+		t.Fatalf("expected a list model")
+	}
+	expected, _ := mdl.MarshalJSON()
+	received, _ := rebuilt.MarshalJSON()
+	if string(expected) != string(received) {
+		t.Errorf("expected %s, received %s", expected, received)
+	}
+}
+
+func TestUnflattenErrors(t *testing.T) {
+	flat := model.New(stdModel.ModelTypeHash)
+	flat.Set("a", 1)
+	flat.Set("a.b", 2)
+	if _, err := model.Unflatten(flat, "."); nil == err {
+		t.Errorf("expected an error for a key nested under a scalar")
+	}
+
+	flat = model.New(stdModel.ModelTypeHash)
+	flat.Set("a[0", 1)
+	if _, err := model.UnflattenWith(flat, model.FlattenOptions{BracketIndex: true}); nil == err {
+		t.Errorf("expected an error for an unterminated index")
+	}
+
+	if _, err := model.Unflatten(model.New(stdModel.ModelTypeList), "."); nil == err {
+		t.Errorf("expected an error for a list model")
+	}
+}
+
+func TestFlattenNumericKeys(t *testing.T) {
+	for _, jsn := range []string{
+		`{"codes":{"404":"nf","500":"err"}}`,
+		`{"3":"x"}`,
+		`{"a":{"1":true,"2":false}}`,
+		`{"a":[[1,2],{"0":"x","2":"y"}]}`,
+	} {
+		mdl := model.New(stdModel.ModelTypeHash)
+		if err := mdl.UnmarshalJSON([]byte(jsn)); nil != err {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		rebuilt, err := model.Unflatten(model.Flatten(mdl, "."), ".")
+		if nil != err {
+			t.Fatalf("%s: unexpected error: %v", jsn, err)
+		}
+		if received, _ := rebuilt.MarshalJSON(); jsn != string(received) {
+			t.Errorf("expected %s, received %s", jsn, received)
+		}
+	}
+
+	flat := model.New(stdModel.ModelTypeHash)
+	flat.Set("a[1000000000]", 1)
+	if _, err := model.UnflattenWith(flat, model.FlattenOptions{BracketIndex: true}); !errors.Is(err, model.InvalidIndex) {
+		t.Errorf("expected an InvalidIndex error for a sparse index, received %v", err)
+	}
+}
+
+func TestFlattenCycle(t *testing.T) {
+	mdl := model.New(stdModel.ModelTypeHash)
+	mdl.Set("a", 1)
+	mdl.Set("self", mdl)
+	flat := model.Flatten(mdl, ".")
+	if received, _ := flat.MarshalJSON(); `{"a":1}` != string(received) {
+		t.Errorf("expected the cycle to be skipped, received %s", received)
+	}
+}
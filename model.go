@@ -1,6 +1,7 @@
 package model
 
 import (
+	"sort"
 	"sync"
 
 	"github.com/bdlm/cast/v2"
@@ -27,8 +28,15 @@ type Model struct {
 	id     any                // model identifier
 	locked bool               // model read-only flag
 	typ    stdModel.ModelType // model type, either stdModel.ModelTypeHash or stdModel.ModelTypeList
+	format Format             // serialization format used by MarshalModel and UnmarshalModel
+
+	omitNull bool // leave null hash values out when marshaling
+
+	comments map[string]string      // stdModel.ModelTypeHash key comments
+	indexes  map[string]*fieldIndex // stdModel.ModelTypeList secondary indexes
 
 	mux     *sync.Mutex    // goroutine-safe
+	obs     *observers     // change subscriptions and parents
 	data    []any          // data store
 	hashIdx map[string]int // stdModel.ModelTypeHash data index
 	idxHash map[int]string // stdModel.ModelTypeHash hash index
@@ -36,11 +44,21 @@ type Model struct {
 }
 
 /*
-New returns a new stdModel.Model.
+New returns a new stdModel.Model. If an ID generator is set with
+SetIDGenerator, the model is assigned an ID.
 */
 func New(modelType stdModel.ModelType) *Model {
+	return newModel(modelType, newID())
+}
+
+/*
+newModel returns a new model with the given ID.
+*/
+func newModel(modelType stdModel.ModelType, id any) *Model {
 	return &Model{
+		id:      id,
 		mux:     &sync.Mutex{},
+		obs:     &observers{},
 		typ:     modelType,
 		hashIdx: map[string]int{},
 		idxHash: map[int]string{},
@@ -48,6 +66,94 @@ func New(modelType stdModel.ModelType) *Model {
 	}
 }
 
+/*
+Clone returns a deep copy of this model. Nested models are copied, other
+values are shared. Indexes are rebuilt for the copy; subscriptions are not
+copied. Copies are assigned new IDs as by New, so that a clone and its
+original can be registered together.
+*/
+func (mdl *Model) Clone() *Model {
+	mdl.mux.Lock()
+	defer mdl.mux.Unlock()
+	return mdl.cloneLocked(map[*Model]*Model{}, false)
+}
+
+/*
+copy returns a deep copy of this model that keeps the IDs of the copied
+models.
+*/
+func (mdl *Model) copy() *Model {
+	mdl.mux.Lock()
+	defer mdl.mux.Unlock()
+	return mdl.cloneLocked(map[*Model]*Model{}, true)
+}
+
+/*
+cloneLocked implements Clone. The caller must hold the model lock. seen maps
+models already copied to their copies, preserving shared and circular
+references. If keepIDs is set, copies keep the IDs of their originals, for
+internal copies that stand in for the originals.
+*/
+func (mdl *Model) cloneLocked(seen map[*Model]*Model, keepIDs bool) *Model {
+	id := mdl.id
+	if !keepIDs {
+		id = newID()
+	}
+	clone := newModel(mdl.typ, id)
+	seen[mdl] = clone
+	clone.format = mdl.format
+	clone.omitNull = mdl.omitNull
+	if nil != mdl.comments {
+		clone.comments = make(map[string]string, len(mdl.comments))
+		for k, v := range mdl.comments {
+			clone.comments[k] = v
+		}
+	}
+
+	clone.data = make([]any, len(mdl.data))
+	for k, v := range mdl.data {
+		val := unwrap(v)
+		if child, ok := val.(*Model); ok && nil != child {
+			if copied, ok := seen[child]; ok {
+				val = copied
+			} else {
+				child.mux.Lock()
+				val = child.cloneLocked(seen, keepIDs)
+				child.mux.Unlock()
+			}
+			clone.adopt(val)
+		}
+		if _, ok := v.(*Value); ok {
+			clone.data[k] = &Value{val}
+		} else {
+			clone.data[k] = val
+		}
+	}
+	for k, v := range mdl.hashIdx {
+		clone.hashIdx[k] = v
+	}
+	for k, v := range mdl.idxHash {
+		clone.idxHash[k] = v
+	}
+	for field, idx := range mdl.indexes {
+		if nil == clone.indexes {
+			clone.indexes = map[string]*fieldIndex{}
+		}
+		clone.indexes[field] = &fieldIndex{path: idx.path, unique: idx.unique}
+	}
+	clone.reindex()
+	return clone
+}
+
+/*
+Comment returns the comment attached to a hash key, if any.
+*/
+func (mdl *Model) Comment(key any) string {
+	mdl.mux.Lock()
+	defer mdl.mux.Unlock()
+	return mdl.comments[cast.To[string](key)]
+}
+
 /*
 Data returns the current data set and indexes.
 */
@@ -56,28 +162,69 @@ func (mdl *Model) Data() ([]any, map[string]int, map[int]string) {
 }
 
 /*
-Delete removes a value from this model.
+entries returns a copy of the keys and unwrapped values stored in this model,
+in storage order. keys is nil for list models.
 */
-func (mdl *Model) Delete(key any) error {
+func (mdl *Model) entries() (keys []string, values []any) {
 	mdl.mux.Lock()
 	defer mdl.mux.Unlock()
+	values = make([]any, len(mdl.data))
+	for k, v := range mdl.data {
+		values[k] = unwrap(v)
+	}
+	if stdModel.ModelTypeHash == mdl.typ {
+		keys = make([]string, len(mdl.data))
+		for k := range mdl.data {
+			keys[k] = mdl.idxHash[k]
+		}
+	}
+	return keys, values
+}
+
+/*
+Delete removes a value from this model.
+*/
+func (mdl *Model) Delete(key any) error {
+	_, err := mdl.change(func() (Event, error) {
+		return mdl.deleteLocked(key)
+	})
+	return err
+}
+
+/*
+deleteLocked implements Delete. The caller must hold the model lock.
+*/
+func (mdl *Model) deleteLocked(key any) (Event, error) {
 	if stdModel.ModelTypeList == mdl.GetType() {
-		k := key.(int)
-		if k > len(mdl.data) {
-			return errors.WrapE(InvalidIndex, errors.Errorf("index '%d' out of range", k))
+		k, err := cast.ToE[int](key)
+		if nil != err {
+			return Event{}, errors.WrapE(InvalidIndexType, errors.Errorf("key '%v' must be an integer", key))
+		}
+		if k < 0 || k >= len(mdl.data) {
+			return Event{}, errors.WrapE(InvalidIndex, errors.Errorf("index '%d' out of range", k))
 		}
-		mdl.data = append(mdl.data[:key.(int)-1], mdl.data[key.(int):]...)
-		return nil
+		old := mdl.data[k]
+		mdl.indexRemove(k, old)
+		mdl.data = append(mdl.data[:k], mdl.data[k+1:]...)
+		mdl.indexShift(k)
+		return Event{Type: EventDelete, Key: k, index: k, Path: []any{k}, Old: unwrap(old)}, nil
 	}
 
-	k := key.(string)
-	if idx, ok := mdl.hashIdx[k]; ok {
-		mdl.data = append(mdl.data[:idx-1], mdl.data[idx:]...)
-		delete(mdl.hashIdx, k)
-		delete(mdl.idxHash, idx)
-		return nil
+	k := cast.To[string](key)
+	idx, ok := mdl.hashIdx[k]
+	if !ok {
+		return Event{}, errors.WrapE(InvalidIndex, errors.Errorf("index '%s' out of range", k))
+	}
+	old := mdl.data[idx]
+	mdl.data = append(mdl.data[:idx], mdl.data[idx+1:]...)
+	delete(mdl.hashIdx, k)
+	delete(mdl.comments, k)
+	for a := idx; a < len(mdl.data); a++ {
+		mdl.idxHash[a] = mdl.idxHash[a+1]
+		mdl.hashIdx[mdl.idxHash[a]] = a
 	}
-	return errors.WrapE(InvalidIndex, errors.Errorf("index '%s' out of range", k))
+	delete(mdl.idxHash, len(mdl.data))
+	return Event{Type: EventDelete, Key: k, index: idx, Path: []any{k}, Old: unwrap(old)}, nil
 }
 
 /*
@@ -89,40 +236,58 @@ func (mdl *Model) Filter(callback func(stdModel.Value) stdModel.Model) stdModel.
 }
 
 /*
-Get returns the specified data value in this model.
+Get returns the specified data value in this model. A key holding null
+returns a Value for which IsNull is true; a missing key returns an
+InvalidIndex error.
 */
 func (mdl *Model) Get(key any) (stdModel.Value, error) {
-	if stdModel.ModelTypeHash == mdl.GetType() {
-		var ok bool
-		var idx int
+	mdl.mux.Lock()
+	defer mdl.mux.Unlock()
+	idx, err := mdl.posLocked(key)
+	if nil != err {
+		return nil, err
+	}
+	return &Value{unwrap(mdl.data[idx])}, nil
+}
 
+/*
+posLocked returns the storage position of key. The caller must hold the
+model lock.
+*/
+func (mdl *Model) posLocked(key any) (int, error) {
+	if stdModel.ModelTypeHash == mdl.GetType() {
 		// hash keys are always strings
 		hashIdx := cast.To[string](key)
-
-		mdl.mux.Lock()
-		defer mdl.mux.Unlock()
-
-		if idx, ok = mdl.hashIdx[hashIdx]; !ok {
-			return nil, errors.WrapE(InvalidIndex, errors.Errorf("invalid index '%s'", hashIdx))
+		idx, ok := mdl.hashIdx[hashIdx]
+		if !ok {
+			return -1, errors.WrapE(InvalidIndex, errors.Errorf("invalid index '%s'", hashIdx))
 		}
-
-		ret := mdl.data[idx]
-		return &Value{ret}, nil
+		return idx, nil
 	}
 
 	// List model
 	switch key.(type) {
-	case int, int8, int16, int32, int64:
-		mdl.mux.Lock()
-		defer mdl.mux.Unlock()
-		if key.(int) >= int(len(mdl.data)) {
-			return nil, errors.WrapE(InvalidIndex, errors.Errorf("invalid index '%d'", key.(int)))
+	case int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64:
+		k := cast.To[int](key)
+		if k < 0 || k >= len(mdl.data) {
+			return -1, errors.WrapE(InvalidIndex, errors.Errorf("invalid index '%d'", k))
 		}
-		ret := mdl.data[key.(int)]
-		return &Value{ret}, nil
+		return k, nil
 	default:
-		return nil, errors.WrapE(InvalidIndexType, errors.Errorf("key '%v' must be an integer", key))
+		return -1, errors.WrapE(InvalidIndexType, errors.Errorf("key '%v' must be an integer", key))
+	}
+}
+
+/*
+GetFormat returns the serialization format used by MarshalModel and
+UnmarshalModel.
+*/
+func (mdl *Model) GetFormat() Format {
+	if "" == mdl.format {
+		return FormatJSON
 	}
+	return mdl.format
 }
 
 /*
@@ -140,19 +305,25 @@ func (mdl *Model) GetType() stdModel.ModelType {
 }
 
 /*
-Has tests to see of a specified data element exists in this model.
+Has tests to see of a specified data element exists in this model. It is
+true for keys holding null; see IsNull.
 */
 func (mdl *Model) Has(key any) bool {
-	if stdModel.ModelTypeList == mdl.GetType() {
-		if k, ok := key.(int); ok && k < len(mdl.data) {
-			return true
-		}
-	} else if kstr, ok := key.(string); ok {
-		if _, ok := mdl.hashIdx[kstr]; ok {
-			return true
-		}
-	}
-	return false
+	mdl.mux.Lock()
+	defer mdl.mux.Unlock()
+	_, err := mdl.posLocked(key)
+	return nil == err
+}
+
+/*
+IsNull reports whether a specified data element exists in this model and
+holds null.
+*/
+func (mdl *Model) IsNull(key any) bool {
+	mdl.mux.Lock()
+	defer mdl.mux.Unlock()
+	idx, err := mdl.posLocked(key)
+	return nil == err && isNull(unwrap(mdl.data[idx]))
 }
 
 /*
@@ -183,16 +354,63 @@ func (mdl *Model) Push(value any) error {
 	if raw, ok := value.(stdModel.Value); ok {
 		value = raw
 	}
+	_, err := mdl.change(func() (Event, error) {
+		return mdl.pushLocked(value)
+	})
+	return err
+}
 
+/*
+pushLocked implements Push. The caller must hold the model lock.
+*/
+func (mdl *Model) pushLocked(value any) (Event, error) {
 	// stdModel.ModelTypeList only
 	if stdModel.ModelTypeList != mdl.GetType() {
-		return errors.WrapE(InvalidMethodContext, errors.Errorf("Push() is only valid for stdModel.ModelTypeList model types"))
+		return Event{}, errors.WrapE(InvalidMethodContext, errors.Errorf("Push() is only valid for stdModel.ModelTypeList model types"))
 	}
-
-	mdl.mux.Lock()
+	if err := mdl.indexCheck(-1, value); nil != err {
+		return Event{}, err
+	}
+	k := len(mdl.data)
 	mdl.data = append(mdl.data, &Value{value})
-	mdl.mux.Unlock()
-	return nil
+	mdl.indexAdd(k, value)
+	mdl.adopt(value)
+	return Event{Type: EventInsert, Key: k, index: k, Path: []any{k}, New: unwrap(value)}, nil
+}
+
+/*
+insertLocked stores value at position pos, shifting later values. key is
+the hash key and is ignored for list models. The caller must hold the model
+lock.
+*/
+func (mdl *Model) insertLocked(pos int, key any, value any) (Event, error) {
+	if pos < 0 || pos > len(mdl.data) {
+		return Event{}, errors.WrapE(InvalidIndex, errors.Errorf("index '%d' out of range", pos))
+	}
+
+	if stdModel.ModelTypeList == mdl.GetType() {
+		if err := mdl.indexCheck(-1, value); nil != err {
+			return Event{}, err
+		}
+		mdl.data = append(mdl.data[:pos], append([]any{&Value{value}}, mdl.data[pos:]...)...)
+		mdl.reindex()
+		mdl.adopt(value)
+		return Event{Type: EventInsert, Key: pos, index: pos, Path: []any{pos}, New: unwrap(value)}, nil
+	}
+
+	k := cast.To[string](key)
+	if _, ok := mdl.hashIdx[k]; ok {
+		return Event{}, errors.WrapE(InvalidIndex, errors.Errorf("key '%s' already exists", k))
+	}
+	mdl.data = append(mdl.data[:pos], append([]any{value}, mdl.data[pos:]...)...)
+	for a := len(mdl.data) - 1; a > pos; a-- {
+		mdl.idxHash[a] = mdl.idxHash[a-1]
+		mdl.hashIdx[mdl.idxHash[a]] = a
+	}
+	mdl.idxHash[pos] = k
+	mdl.hashIdx[k] = pos
+	mdl.adopt(value)
+	return Event{Type: EventInsert, Key: k, index: pos, Path: []any{k}, New: unwrap(value)}, nil
 }
 
 /*
@@ -217,40 +435,73 @@ func (mdl *Model) Set(key any, value any) error {
 	if raw, ok := value.(stdModel.Value); ok {
 		value = raw
 	}
+	_, err := mdl.change(func() (Event, error) {
+		return mdl.setLocked(key, value)
+	})
+	return err
+}
 
+/*
+setLocked implements Set. The caller must hold the model lock.
+*/
+func (mdl *Model) setLocked(key any, value any) (Event, error) {
 	// Hash model
 	if stdModel.ModelTypeHash == mdl.GetType() {
 		// hash keys are always strings
 		idx := cast.To[string](key)
-		mdl.mux.Lock()
-		defer mdl.mux.Unlock()
-		if _, ok := mdl.hashIdx[idx]; !ok {
-			mdl.hashIdx[idx] = len(mdl.data)
-			mdl.idxHash[len(mdl.data)] = idx
+		mdl.adopt(value)
+		pos, ok := mdl.hashIdx[idx]
+		if !ok {
+			pos = len(mdl.data)
+			mdl.hashIdx[idx] = pos
+			mdl.idxHash[pos] = idx
 			mdl.data = append(mdl.data, value)
-			return nil
+			return Event{Type: EventInsert, Key: idx, index: pos, Path: []any{idx}, New: unwrap(value)}, nil
 		}
-		mdl.data[mdl.hashIdx[idx]] = value
-		return nil
+		old := mdl.data[pos]
+		mdl.data[pos] = value
+		return Event{Type: EventSet, Key: idx, index: pos, Path: []any{idx}, Old: unwrap(old), New: unwrap(value)}, nil
 	}
 
 	// List model
 	switch key.(type) {
 	case int, int8, int16, int32, int64,
 		uint, uint8, uint16, uint32, uint64:
-		k := key.(int)
-		mdl.mux.Lock()
-		defer mdl.mux.Unlock()
+		k := cast.To[int](key)
 		if k >= len(mdl.data) || k < 0 {
-			return errors.WrapE(InvalidIndex, errors.Errorf("invalid index '%d'", k))
+			return Event{}, errors.WrapE(InvalidIndex, errors.Errorf("invalid index '%d'", k))
 		}
+		if err := mdl.indexCheck(k, value); nil != err {
+			return Event{}, err
+		}
+		old := mdl.data[k]
+		mdl.indexRemove(k, old)
 		mdl.data[k] = value
-		return nil
+		mdl.indexAdd(k, value)
+		mdl.adopt(value)
+		return Event{Type: EventSet, Key: k, index: k, Path: []any{k}, Old: unwrap(old), New: unwrap(value)}, nil
 	default:
-		return errors.WrapE(InvalidIndexType, errors.Errorf("key '%v' is must be an integer", key))
+		return Event{}, errors.WrapE(InvalidIndexType, errors.Errorf("key '%v' is must be an integer", key))
 	}
 }
 
+/*
+SetFormat sets the serialization format used by MarshalModel and
+UnmarshalModel.
+*/
+func (mdl *Model) SetFormat(format Format) {
+	mdl.format = format
+}
+
+/*
+SetOmitNull sets whether MarshalJSON and MarshalYAML leave out hash keys
+holding null, in this model and the models nested within it. List elements
+holding null are always kept.
+*/
+func (mdl *Model) SetOmitNull(omit bool) {
+	mdl.omitNull = omit
+}
+
 /*
 SetID sets this Model's identifier property.
 */
@@ -258,33 +509,128 @@ func (mdl *Model) SetID(id any) {
 	mdl.id = id
 }
 
+/*
+SetComment attaches a comment to a hash key. Comments are emitted by
+serialization formats that support them, such as YAML. An empty comment
+removes any existing comment.
+*/
+func (mdl *Model) SetComment(key any, comment string) {
+	k := cast.To[string](key)
+	mdl.mux.Lock()
+	defer mdl.mux.Unlock()
+	if "" == comment {
+		delete(mdl.comments, k)
+		return
+	}
+	if nil == mdl.comments {
+		mdl.comments = map[string]string{}
+	}
+	mdl.comments[k] = comment
+}
+
 /*
 SetData replaces the current data stored in the model with the provided
-data.
+data. Hash data is stored in key order.
 */
 func (mdl *Model) SetData(data any) error {
+	_, err := mdl.change(func() (Event, error) {
+		prev, err := mdl.setDataLocked(data)
+		if nil != err {
+			return Event{}, err
+		}
+		return Event{Type: EventReplace, Path: []any{}, prev: prev, New: data}, nil
+	})
+	return err
+}
+
+/*
+setDataLocked implements SetData. It returns a shallow copy of the previous
+data. The caller must hold the model lock.
+*/
+func (mdl *Model) setDataLocked(data any) (*Model, error) {
 	if stdModel.ModelTypeList == mdl.GetType() {
 		d, ok := data.([]any)
 		if !ok {
-			return errors.WrapE(InvalidDataSet, errors.Errorf("invalid data set for list model"))
+			return nil, errors.WrapE(InvalidDataSet, errors.Errorf("invalid data set for list model"))
 		}
+		prev := mdl.snapshotLocked()
 		mdl.data = d
+		if err := mdl.reindex(); nil != err {
+			mdl.data = prev.data
+			mdl.reindex()
+			return nil, err
+		}
+		for _, v := range d {
+			mdl.adopt(v)
+		}
+		return prev, nil
 	}
 
 	d, ok := data.(map[string]any)
 	if !ok {
-		return errors.WrapE(InvalidDataSet, errors.Errorf("invalid data set for hash model"))
+		return nil, errors.WrapE(InvalidDataSet, errors.Errorf("invalid data set for hash model"))
 	}
+	prev := mdl.snapshotLocked()
+	keys := make([]string, 0, len(d))
+	for k := range d {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
 
 	mdl.data = []any{}
-	for k, v := range d {
+	mdl.hashIdx = map[string]int{}
+	mdl.idxHash = map[int]string{}
+	for _, k := range keys {
 		mdl.hashIdx[k] = len(mdl.data)
 		mdl.idxHash[len(mdl.data)] = k
-		mdl.data = append(mdl.data, v)
+		mdl.data = append(mdl.data, d[k])
+		mdl.adopt(d[k])
+	}
+	return prev, nil
+}
+
+/*
+restoreLocked replaces the model data with the data of a snapshot taken by
+snapshotLocked. The caller must hold the model lock.
+*/
+func (mdl *Model) restoreLocked(snapshot *Model) error {
+	prev := mdl.snapshotLocked()
+	mdl.data = append([]any{}, snapshot.data...)
+	mdl.hashIdx = make(map[string]int, len(snapshot.hashIdx))
+	for k, v := range snapshot.hashIdx {
+		mdl.hashIdx[k] = v
+	}
+	mdl.idxHash = make(map[int]string, len(snapshot.idxHash))
+	for k, v := range snapshot.idxHash {
+		mdl.idxHash[k] = v
+	}
+	if err := mdl.reindex(); nil != err {
+		mdl.data, mdl.hashIdx, mdl.idxHash = prev.data, prev.hashIdx, prev.idxHash
+		mdl.reindex()
+		return err
+	}
+	for _, v := range mdl.data {
+		mdl.adopt(v)
 	}
 	return nil
 }
 
+/*
+snapshotLocked returns a shallow copy of the model data. Nested models are
+shared. The caller must hold the model lock.
+*/
+func (mdl *Model) snapshotLocked() *Model {
+	snapshot := newModel(mdl.typ, nil)
+	snapshot.data = append([]any{}, mdl.data...)
+	for k, v := range mdl.hashIdx {
+		snapshot.hashIdx[k] = v
+	}
+	for k, v := range mdl.idxHash {
+		snapshot.idxHash[k] = v
+	}
+	return snapshot
+}
+
 /*
 SetType sets the model type. If any data is stored in this model, this
 property becomes read-only.
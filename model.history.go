@@ -0,0 +1,374 @@
+package model
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/bdlm/errors/v2"
+	stdModel "github.com/bdlm/std/v2/model"
+)
+
+/*
+History is an undo/redo journal for a model, created by EnableHistory. Each
+change made to the model, or to any model nested within it, is recorded
+with its inverse so that it can be undone and redone.
+
+Changes made by Undo and Redo notify subscribers like any other change but
+are not recorded. Changes made concurrently with Undo or Redo may not be
+recorded either.
+*/
+type History struct {
+	depth int
+	sub   *Subscription
+
+	mux       sync.Mutex
+	entries   []historyEntry
+	cursor    int         // entries[:cursor] have been applied
+	replaying atomic.Bool // set while Undo or Redo is changing the model
+}
+
+/*
+historyEntry is a recorded change, or a named checkpoint if op is nil.
+*/
+type historyEntry struct {
+	name string
+	op   *historyOp
+}
+
+/*
+historyOp is a recorded change and its inverse.
+*/
+type historyOp struct {
+	undo func() error
+	redo func() error
+}
+
+/*
+EnableHistory starts recording changes to this model for Undo and Redo.
+depth limits the number of changes kept, dropping the oldest first; a depth
+of 0 or less keeps every change.
+*/
+func (mdl *Model) EnableHistory(depth int) *History {
+	hist := &History{depth: depth}
+	hist.sub = mdl.Subscribe(hist.record)
+	return hist
+}
+
+/*
+Undo reverts the most recent change that has not been undone.
+*/
+func (hist *History) Undo() error {
+	hist.mux.Lock()
+	defer hist.mux.Unlock()
+	pos := hist.prevOp(hist.cursor)
+	if pos < 0 {
+		return errors.WrapE(InvalidMethodContext, errors.Errorf("nothing to undo"))
+	}
+	if err := hist.replay(hist.entries[pos].op.undo); nil != err {
+		return errors.Wrap(err, "could not undo change")
+	}
+	hist.cursor = pos
+	return nil
+}
+
+/*
+Redo reapplies the most recently undone change.
+*/
+func (hist *History) Redo() error {
+	hist.mux.Lock()
+	defer hist.mux.Unlock()
+	pos := hist.nextOp(hist.cursor)
+	if pos < 0 {
+		return errors.WrapE(InvalidMethodContext, errors.Errorf("nothing to redo"))
+	}
+	if err := hist.replay(hist.entries[pos].op.redo); nil != err {
+		return errors.Wrap(err, "could not redo change")
+	}
+	hist.cursor = pos + 1
+	return nil
+}
+
+/*
+CanUndo reports whether there is a change to undo.
+*/
+func (hist *History) CanUndo() bool {
+	hist.mux.Lock()
+	defer hist.mux.Unlock()
+	return hist.prevOp(hist.cursor) >= 0
+}
+
+/*
+CanRedo reports whether there is a change to redo.
+*/
+func (hist *History) CanRedo() bool {
+	hist.mux.Lock()
+	defer hist.mux.Unlock()
+	return hist.nextOp(hist.cursor) >= 0
+}
+
+/*
+Checkpoint records a named checkpoint at the current state, for UndoTo and
+RedoTo. Names need not be unique.
+*/
+func (hist *History) Checkpoint(name string) {
+	hist.mux.Lock()
+	defer hist.mux.Unlock()
+	hist.entries = append(hist.entries[:hist.cursor], append([]historyEntry{{name: name}}, hist.entries[hist.cursor:]...)...)
+	hist.cursor++
+}
+
+/*
+UndoTo undoes changes until the state at the most recent checkpoint with the
+given name is reached. If a change cannot be undone, the changes undone so
+far are kept and an error is returned.
+*/
+func (hist *History) UndoTo(name string) error {
+	hist.mux.Lock()
+	defer hist.mux.Unlock()
+	mark := -1
+	for k := hist.cursor - 1; k >= 0; k-- {
+		if nil == hist.entries[k].op && name == hist.entries[k].name {
+			mark = k
+			break
+		}
+	}
+	if mark < 0 {
+		return errors.WrapE(InvalidIndex, errors.Errorf("no checkpoint '%s' to undo to", name))
+	}
+	for pos := hist.prevOp(hist.cursor); pos > mark; pos = hist.prevOp(hist.cursor) {
+		if err := hist.replay(hist.entries[pos].op.undo); nil != err {
+			return errors.Wrap(err, "could not undo to checkpoint '%s'", name)
+		}
+		hist.cursor = pos
+	}
+	hist.cursor = mark + 1
+	return nil
+}
+
+/*
+RedoTo redoes changes until the state at the next checkpoint with the given
+name is reached. If a change cannot be redone, the changes redone so far
+are kept and an error is returned.
+*/
+func (hist *History) RedoTo(name string) error {
+	hist.mux.Lock()
+	defer hist.mux.Unlock()
+	mark := -1
+	for k := hist.cursor; k < len(hist.entries); k++ {
+		if nil == hist.entries[k].op && name == hist.entries[k].name {
+			mark = k
+			break
+		}
+	}
+	if mark < 0 {
+		return errors.WrapE(InvalidIndex, errors.Errorf("no checkpoint '%s' to redo to", name))
+	}
+	for pos := hist.nextOp(hist.cursor); pos >= 0 && pos < mark; pos = hist.nextOp(hist.cursor) {
+		if err := hist.replay(hist.entries[pos].op.redo); nil != err {
+			return errors.Wrap(err, "could not redo to checkpoint '%s'", name)
+		}
+		hist.cursor = pos + 1
+	}
+	hist.cursor = mark + 1
+	return nil
+}
+
+/*
+Clear discards all recorded changes and checkpoints.
+*/
+func (hist *History) Clear() {
+	hist.mux.Lock()
+	defer hist.mux.Unlock()
+	hist.entries = nil
+	hist.cursor = 0
+}
+
+/*
+Close stops recording changes and discards the journal.
+*/
+func (hist *History) Close() {
+	hist.sub.Cancel()
+	hist.Clear()
+}
+
+/*
+prevOp returns the position of the last change before pos, or -1. The
+caller must hold the history lock.
+*/
+func (hist *History) prevOp(pos int) int {
+	for k := pos - 1; k >= 0; k-- {
+		if nil != hist.entries[k].op {
+			return k
+		}
+	}
+	return -1
+}
+
+/*
+nextOp returns the position of the first change at or after pos, or -1.
+The caller must hold the history lock.
+*/
+func (hist *History) nextOp(pos int) int {
+	for k := pos; k < len(hist.entries); k++ {
+		if nil != hist.entries[k].op {
+			return k
+		}
+	}
+	return -1
+}
+
+/*
+replay runs an undo or redo function without recording the changes it
+makes. The caller must hold the history lock.
+*/
+func (hist *History) replay(fn func() error) error {
+	hist.replaying.Store(true)
+	defer hist.replaying.Store(false)
+	return fn()
+}
+
+/*
+record journals a change. Recording a change discards the changes that
+could have been redone.
+*/
+func (hist *History) record(evt Event) {
+	// Changes made by replay are delivered while the history lock is held.
+	if hist.replaying.Load() {
+		return
+	}
+	op := historyInverse(evt)
+	if nil == op {
+		return
+	}
+	hist.mux.Lock()
+	defer hist.mux.Unlock()
+
+	hist.entries = append(hist.entries[:hist.cursor], historyEntry{op: op})
+	if hist.depth > 0 {
+		ops := 0
+		for _, entry := range hist.entries {
+			if nil != entry.op {
+				ops++
+			}
+		}
+		for ops > hist.depth {
+			// Checkpoints before the dropped change can no longer be
+			// reached.
+			drop := hist.nextOp(0)
+			clear(hist.entries[:drop+1])
+			hist.entries = hist.entries[drop+1:]
+			ops--
+		}
+	}
+	hist.cursor = len(hist.entries)
+}
+
+/*
+historyInverse returns the undo and redo functions for a change.
+*/
+func historyInverse(evt Event) *historyOp {
+	mdl := evt.Model
+	if nil == mdl {
+		return nil
+	}
+	switch evt.Type {
+	case EventSet:
+		return &historyOp{
+			undo: func() error { return mdl.Set(evt.Key, evt.Old) },
+			redo: func() error { return mdl.Set(evt.Key, evt.New) },
+		}
+
+	case EventInsert:
+		return &historyOp{
+			undo: func() error { return mdl.Delete(evt.Key) },
+			redo: func() error { return mdl.insert(evt.index, evt.Key, evt.New) },
+		}
+
+	case EventDelete:
+		return &historyOp{
+			undo: func() error { return mdl.insert(evt.index, evt.Key, evt.Old) },
+			redo: func() error { return mdl.Delete(evt.Key) },
+		}
+
+	case EventReplace:
+		prev, ok := evt.prev.(*Model)
+		if !ok {
+			return nil
+		}
+		mdl.mux.Lock()
+		next := mdl.snapshotLocked()
+		mdl.mux.Unlock()
+		return &historyOp{
+			undo: func() error { return mdl.restore(prev) },
+			redo: func() error { return mdl.restore(next) },
+		}
+
+	case EventReorder:
+		prev, ok := evt.prev.([]string)
+		if !ok {
+			return nil
+		}
+		mdl.mux.Lock()
+		next := mdl.keyOrderLocked()
+		mdl.mux.Unlock()
+		return &historyOp{
+			undo: func() error { return mdl.reorder(prev) },
+			redo: func() error { return mdl.reorder(next) },
+		}
+	}
+	return nil
+}
+
+/*
+insert stores value at position pos and notifies subscribers.
+*/
+func (mdl *Model) insert(pos int, key any, value any) error {
+	_, err := mdl.change(func() (Event, error) {
+		return mdl.insertLocked(pos, key, value)
+	})
+	return err
+}
+
+/*
+restore replaces the model data with a snapshot and notifies subscribers.
+*/
+func (mdl *Model) restore(snapshot *Model) error {
+	_, err := mdl.change(func() (Event, error) {
+		prev := mdl.snapshotLocked()
+		if err := mdl.restoreLocked(snapshot); nil != err {
+			return Event{}, err
+		}
+		return Event{Type: EventReplace, Path: []any{}, prev: prev, New: snapshot.plainData()}, nil
+	})
+	return err
+}
+
+/*
+reorder stores hash model data in the given key order and notifies
+subscribers.
+*/
+func (mdl *Model) reorder(keys []string) error {
+	_, err := mdl.change(func() (Event, error) {
+		prev := mdl.keyOrderLocked()
+		if err := mdl.reorderLocked(keys); nil != err {
+			return Event{}, err
+		}
+		return Event{Type: EventReorder, Path: []any{}, prev: prev}, nil
+	})
+	return err
+}
+
+/*
+plainData returns the model data in the form accepted by SetData.
+*/
+func (mdl *Model) plainData() any {
+	keys, values := mdl.entries()
+	if stdModel.ModelTypeList == mdl.GetType() {
+		return values
+	}
+	data := make(map[string]any, len(values))
+	for k, key := range keys {
+		data[key] = values[k]
+	}
+	return data
+}
@@ -0,0 +1,156 @@
+package model_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bdlm/model"
+	stdModel "github.com/bdlm/std/v2/model"
+	stdSorter "github.com/bdlm/std/v2/sorter"
+)
+
+func historyJSON(t *testing.T, mdl *model.Model) string {
+	t.Helper()
+	data, err := mdl.MarshalJSON()
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return string(data)
+}
+
+func TestHistoryUndoRedo(t *testing.T) {
+	mdl := txModel(t)
+	hist := mdl.EnableHistory(0)
+	states := []string{historyJSON(t, mdl)}
+
+	mdl.Set("debug", true)
+	states = append(states, historyJSON(t, mdl))
+	mdl.Set("name", "app")
+	states = append(states, historyJSON(t, mdl))
+	mdl.Delete("db")
+	states = append(states, historyJSON(t, mdl))
+	val, _ := mdl.Get("tags")
+	tags, _ := val.Model()
+	tags.Push("b")
+	states = append(states, historyJSON(t, mdl))
+	tags.Delete(0)
+	states = append(states, historyJSON(t, mdl))
+	mdl.Sort(stdSorter.SortByKey)
+	states = append(states, historyJSON(t, mdl))
+	tags.SetData([]any{"x", "y", "z"})
+	states = append(states, historyJSON(t, mdl))
+
+	for k := len(states) - 2; k >= 0; k-- {
+		if err := hist.Undo(); nil != err {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := historyJSON(t, mdl); states[k] != got {
+			t.Errorf("undo to state %d: expected %s, received %s", k, states[k], got)
+		}
+	}
+	if err := hist.Undo(); !errors.Is(err, model.InvalidMethodContext) {
+		t.Errorf("expected InvalidMethodContext, received %v", err)
+	}
+	for k := 1; k < len(states); k++ {
+		if err := hist.Redo(); nil != err {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := historyJSON(t, mdl); states[k] != got {
+			t.Errorf("redo to state %d: expected %s, received %s", k, states[k], got)
+		}
+	}
+	if hist.CanRedo() {
+		t.Errorf("expected nothing to redo")
+	}
+}
+
+func TestHistoryNewChangeDiscardsRedo(t *testing.T) {
+	mdl := model.New(stdModel.ModelTypeList)
+	hist := mdl.EnableHistory(0)
+	mdl.Push(1)
+	mdl.Push(2)
+	hist.Undo()
+	mdl.Push(3)
+	if hist.CanRedo() {
+		t.Errorf("expected nothing to redo")
+	}
+	hist.Undo()
+	hist.Undo()
+	if got := historyJSON(t, mdl); "[]" != got {
+		t.Errorf("expected [], received %s", got)
+	}
+}
+
+func TestHistoryDepth(t *testing.T) {
+	mdl := model.New(stdModel.ModelTypeList)
+	hist := mdl.EnableHistory(2)
+	hist.Checkpoint("start")
+	for _, v := range []int{1, 2, 3} {
+		mdl.Push(v)
+	}
+	hist.Undo()
+	hist.Undo()
+	if hist.CanUndo() {
+		t.Errorf("expected history depth to be bounded")
+	}
+	if got := historyJSON(t, mdl); "[1]" != got {
+		t.Errorf("expected [1], received %s", got)
+	}
+	if err := hist.UndoTo("start"); !errors.Is(err, model.InvalidIndex) {
+		t.Errorf("expected dropped checkpoint, received %v", err)
+	}
+}
+
+func TestHistoryCheckpoints(t *testing.T) {
+	mdl := model.New(stdModel.ModelTypeHash)
+	hist := mdl.EnableHistory(0)
+	mdl.Set("a", 1)
+	hist.Checkpoint("one")
+	mdl.Set("b", 2)
+	mdl.Set("c", 3)
+	hist.Checkpoint("two")
+	mdl.Set("a", 4)
+
+	if err := hist.UndoTo("one"); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := historyJSON(t, mdl); `{"a":1}` != got {
+		t.Errorf(`expected {"a":1}, received %s`, got)
+	}
+	if err := hist.RedoTo("two"); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := historyJSON(t, mdl); `{"a":1,"b":2,"c":3}` != got {
+		t.Errorf(`expected {"a":1,"b":2,"c":3}, received %s`, got)
+	}
+	if err := hist.RedoTo("one"); !errors.Is(err, model.InvalidIndex) {
+		t.Errorf("expected InvalidIndex, received %v", err)
+	}
+	if err := hist.Redo(); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := historyJSON(t, mdl); `{"a":4,"b":2,"c":3}` != got {
+		t.Errorf(`expected {"a":4,"b":2,"c":3}, received %s`, got)
+	}
+}
+
+func TestHistoryNotifiesSubscribers(t *testing.T) {
+	mdl := model.New(stdModel.ModelTypeHash)
+	hist := mdl.EnableHistory(0)
+	mdl.Set("a", 1)
+	events := []string{}
+	mdl.Subscribe(func(evt model.Event) {
+		events = append(events, evt.Type.String()+" "+evt.PathString())
+	})
+	hist.Undo()
+	hist.Redo()
+	if 2 != len(events) || "delete a" != events[0] || "insert a" != events[1] {
+		t.Errorf("unexpected events %v", events)
+	}
+
+	hist.Close()
+	mdl.Set("b", 2)
+	if hist.CanUndo() {
+		t.Errorf("expected closed history to stop recording")
+	}
+}
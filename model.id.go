@@ -0,0 +1,385 @@
+package model
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+	"weak"
+
+	"github.com/bdlm/errors/v2"
+)
+
+/*
+IDGenerator returns a new model ID. IDs must be comparable.
+*/
+type IDGenerator func() any
+
+/*
+ids holds the package-wide ID settings.
+*/
+var ids = struct {
+	mux       sync.RWMutex
+	generator IDGenerator
+	key       string
+}{}
+
+/*
+SetIDGenerator sets the function New uses to assign an ID to each new model,
+e.g. UUIDv7. The default, nil, leaves new models without an ID.
+*/
+func SetIDGenerator(gen IDGenerator) {
+	ids.mux.Lock()
+	defer ids.mux.Unlock()
+	ids.generator = gen
+}
+
+/*
+SetIDKey sets the key under which MarshalJSON includes the ID of hash
+models, and from which UnmarshalJSON reads it. The default, "", leaves IDs
+out of JSON. A hash key with the same name takes precedence over the ID.
+*/
+func SetIDKey(key string) {
+	ids.mux.Lock()
+	defer ids.mux.Unlock()
+	ids.key = key
+}
+
+/*
+newID returns an ID from the current generator, or nil.
+*/
+func newID() any {
+	ids.mux.RLock()
+	gen := ids.generator
+	ids.mux.RUnlock()
+	if nil == gen {
+		return nil
+	}
+	return gen()
+}
+
+/*
+idKey returns the current ID key.
+*/
+func idKey() string {
+	ids.mux.RLock()
+	defer ids.mux.RUnlock()
+	return ids.key
+}
+
+/*
+UUIDv7 is an IDGenerator returning RFC 9562 version 7 UUID strings, which
+sort in creation order.
+*/
+func UUIDv7() any {
+	var uuid [16]byte
+	ms := uint64(time.Now().UnixMilli())
+	binary.BigEndian.PutUint64(uuid[:8], ms<<16)
+	rand.Read(uuid[6:])
+	uuid[6] = 0x70 | uuid[6]&0x0f // version 7
+	uuid[8] = 0x80 | uuid[8]&0x3f // RFC 9562 variant
+
+	buf := make([]byte, 36)
+	hex.Encode(buf[0:8], uuid[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], uuid[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], uuid[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], uuid[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], uuid[10:])
+	return string(buf)
+}
+
+/*
+SequentialIDs returns an IDGenerator returning int64 IDs counting up from
+start. It is safe for concurrent use.
+*/
+func SequentialIDs(start int64) IDGenerator {
+	next := &atomic.Int64{}
+	next.Store(start)
+	return func() any {
+		return next.Add(1) - 1
+	}
+}
+
+/*
+FindByID returns the model with the given ID, searching this model and the
+models nested within it depth-first. Numeric IDs match by value, so the
+int64 ID 1 matches the float64 1 read back from JSON.
+*/
+func (mdl *Model) FindByID(id any) (*Model, bool) {
+	id = normalizeID(id)
+	if !idComparable(id) {
+		return nil, false
+	}
+	var found *Model
+	mdl.walkModels(map[*Model]bool{}, func(node *Model) bool {
+		if nodeID := normalizeID(node.GetID()); idComparable(nodeID) && nodeID == id {
+			found = node
+			return false
+		}
+		return true
+	})
+	return found, nil != found
+}
+
+/*
+walkModels calls fn for this model and each model nested within it, once
+each, until fn returns false. It reports whether the walk completed.
+*/
+func (mdl *Model) walkModels(seen map[*Model]bool, fn func(*Model) bool) bool {
+	if seen[mdl] {
+		return true
+	}
+	seen[mdl] = true
+	if !fn(mdl) {
+		return false
+	}
+	_, values := mdl.entries()
+	for _, val := range values {
+		if child, ok := val.(*Model); ok && nil != child {
+			if !child.walkModels(seen, fn) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+/*
+normalizeID returns id with integral numbers converted to int64 and other
+numbers to float64, so that IDs compare equal whatever their numeric type.
+*/
+func normalizeID(id any) any {
+	switch typed := id.(type) {
+	case json.Number:
+		if i, err := typed.Int64(); nil == err {
+			return i
+		}
+		if f, err := typed.Float64(); nil == err {
+			return normalizeID(f)
+		}
+		return id
+	case float32:
+		return normalizeID(float64(typed))
+	case float64:
+		if typed == math.Trunc(typed) && math.Abs(typed) < 1<<63 {
+			return int64(typed)
+		}
+		return typed
+	}
+	if KindInt == kindOf(id) {
+		rv := reflect.ValueOf(id)
+		if !rv.CanUint() {
+			return rv.Int()
+		}
+		if u := rv.Uint(); u <= math.MaxInt64 {
+			return int64(u)
+		}
+	}
+	return id
+}
+
+/*
+idComparable reports whether id can be used as a map key.
+*/
+func idComparable(id any) bool {
+	return nil != id && reflect.TypeOf(id).Comparable()
+}
+
+/*
+Registry maps IDs to live models. It holds weak references, so registering
+a model does not keep it from being garbage collected. Numeric IDs are
+matched by value, as in FindByID.
+*/
+type Registry struct {
+	mux    sync.RWMutex
+	models map[any]weak.Pointer[Model]
+}
+
+/*
+NewRegistry returns an empty Registry.
+*/
+func NewRegistry() *Registry {
+	return &Registry{models: map[any]weak.Pointer[Model]{}}
+}
+
+/*
+Register adds a model to the registry. It returns an InvalidIndex error if
+the model has no usable ID and a DuplicateValue error if a different live
+model is registered with the same ID.
+*/
+func (reg *Registry) Register(mdl *Model) error {
+	id := normalizeID(mdl.GetID())
+	if !idComparable(id) {
+		return errors.WrapE(InvalidIndex, errors.Errorf("model ID '%v' cannot be registered", id))
+	}
+	reg.mux.Lock()
+	defer reg.mux.Unlock()
+	if existing := reg.models[id].Value(); nil != existing && existing != mdl {
+		return errors.WrapE(DuplicateValue, errors.Errorf("model ID '%v' is already registered", id))
+	}
+	reg.models[id] = weak.Make(mdl)
+	return nil
+}
+
+/*
+RegisterTree registers a model and each model nested within it. Models
+without an ID are skipped. It stops at the first error.
+*/
+func (reg *Registry) RegisterTree(root *Model) error {
+	var err error
+	root.walkModels(map[*Model]bool{}, func(node *Model) bool {
+		if nil == node.GetID() {
+			return true
+		}
+		err = reg.Register(node)
+		return nil == err
+	})
+	return err
+}
+
+/*
+Unregister removes a model from the registry.
+*/
+func (reg *Registry) Unregister(mdl *Model) {
+	id := normalizeID(mdl.GetID())
+	if !idComparable(id) {
+		return
+	}
+	reg.mux.Lock()
+	defer reg.mux.Unlock()
+	if existing := reg.models[id].Value(); nil == existing || existing == mdl {
+		delete(reg.models, id)
+	}
+}
+
+/*
+Get returns the live model registered with the given ID.
+*/
+func (reg *Registry) Get(id any) (*Model, bool) {
+	id = normalizeID(id)
+	if !idComparable(id) {
+		return nil, false
+	}
+	reg.mux.RLock()
+	ptr, ok := reg.models[id]
+	reg.mux.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	mdl := ptr.Value()
+	if nil == mdl {
+		reg.mux.Lock()
+		if reg.models[id] == ptr {
+			delete(reg.models, id)
+		}
+		reg.mux.Unlock()
+		return nil, false
+	}
+	return mdl, true
+}
+
+/*
+Track registers root and the models nested within it, and keeps the
+registry up to date as models are added to or removed from the tree until
+the returned subscription is cancelled.
+
+A model added to the tree with the ID of a registered model that has left
+the tree, e.g. a model committed by a Tx in place of its original, takes
+over the ID. If the registered model is still in the tree, the added model
+takes over the ID once it leaves.
+*/
+func (reg *Registry) Track(root *Model) (*Subscription, error) {
+	if err := reg.RegisterTree(root); nil != err {
+		return nil, err
+	}
+	mux := sync.Mutex{}
+	waiting := map[any]bool{} // IDs of models waiting to take over an ID
+	return root.Subscribe(func(evt Event) {
+		var removed any = evt.Old
+		if EventReplace == evt.Type {
+			removed = evt.prev
+		}
+		if old, ok := removed.(*Model); ok && nil != old {
+			old.walkModels(map[*Model]bool{}, func(node *Model) bool {
+				reg.Unregister(node)
+				id := normalizeID(node.GetID())
+				mux.Lock()
+				wait := waiting[id]
+				delete(waiting, id)
+				mux.Unlock()
+				if next, ok := root.FindByID(id); wait && ok && !reg.track(root, next) {
+					mux.Lock()
+					waiting[id] = true
+					mux.Unlock()
+				}
+				return true
+			})
+		}
+		var added any = evt.New
+		if EventReplace == evt.Type {
+			added = evt.Model
+		}
+		if model, ok := added.(*Model); ok && nil != model {
+			model.walkModels(map[*Model]bool{}, func(node *Model) bool {
+				if nil != node.GetID() && !reg.track(root, node) {
+					mux.Lock()
+					waiting[normalizeID(node.GetID())] = true
+					mux.Unlock()
+				}
+				return true
+			})
+		}
+	}), nil
+}
+
+/*
+track registers mdl, a model within root. If a different live model is
+registered with the same ID and is no longer within root, mdl replaces it.
+It reports whether mdl was registered.
+*/
+func (reg *Registry) track(root, mdl *Model) bool {
+	id := normalizeID(mdl.GetID())
+	if !idComparable(id) {
+		return false
+	}
+	for {
+		reg.mux.Lock()
+		ptr := reg.models[id]
+		existing := ptr.Value()
+		if nil == existing || existing == mdl {
+			reg.models[id] = weak.Make(mdl)
+			reg.mux.Unlock()
+			return true
+		}
+		reg.mux.Unlock()
+
+		if root.contains(existing) {
+			return false
+		}
+		reg.mux.Lock()
+		if reg.models[id] == ptr {
+			reg.models[id] = weak.Make(mdl)
+			reg.mux.Unlock()
+			return true
+		}
+		reg.mux.Unlock()
+	}
+}
+
+/*
+contains reports whether node is this model or nested within it.
+*/
+func (mdl *Model) contains(node *Model) bool {
+	return !mdl.walkModels(map[*Model]bool{}, func(m *Model) bool {
+		return m != node
+	})
+}
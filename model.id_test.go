@@ -0,0 +1,269 @@
+package model_test
+
+import (
+	"errors"
+	"regexp"
+	"runtime"
+	"testing"
+
+	"github.com/bdlm/model"
+	stdModel "github.com/bdlm/std/v2/model"
+)
+
+func TestUUIDv7(t *testing.T) {
+	model.SetIDGenerator(model.UUIDv7)
+	defer model.SetIDGenerator(nil)
+	pattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	first := model.New(stdModel.ModelTypeHash).GetID()
+	id, ok := first.(string)
+	if !ok || !pattern.MatchString(id) {
+		t.Fatalf("expected a UUIDv7, received %v", first)
+	}
+	if second := model.New(stdModel.ModelTypeHash).GetID(); first == second {
+		t.Errorf("expected unique IDs, received %v twice", first)
+	}
+}
+
+func TestSequentialIDs(t *testing.T) {
+	if id := model.New(stdModel.ModelTypeHash).GetID(); nil != id {
+		t.Errorf("expected no ID by default, received %v", id)
+	}
+
+	model.SetIDGenerator(model.SequentialIDs(10))
+	defer model.SetIDGenerator(nil)
+	if id := model.New(stdModel.ModelTypeHash).GetID(); int64(10) != id {
+		t.Errorf("expected 10, received %v", id)
+	}
+	if id := model.New(stdModel.ModelTypeList).GetID(); int64(11) != id {
+		t.Errorf("expected 11, received %v", id)
+	}
+
+	model.SetIDGenerator(nil)
+	if id := model.New(stdModel.ModelTypeHash).GetID(); nil != id {
+		t.Errorf("expected no ID, received %v", id)
+	}
+}
+
+func TestFindByID(t *testing.T) {
+	model.SetIDGenerator(model.UUIDv7)
+	defer model.SetIDGenerator(nil)
+	root := model.New(stdModel.ModelTypeHash)
+	items := model.New(stdModel.ModelTypeList)
+	row := model.New(stdModel.ModelTypeHash)
+	row.SetID("row-1")
+	items.Push(row)
+	root.Set("items", items)
+	row.Set("root", root)
+
+	if found, ok := root.FindByID("row-1"); !ok || found != row {
+		t.Errorf("expected the nested row, received %v", found)
+	}
+	if found, ok := root.FindByID(items.GetID()); !ok || found != items {
+		t.Errorf("expected the nested list, received %v", found)
+	}
+	if _, ok := root.FindByID("missing"); ok {
+		t.Errorf("expected no model")
+	}
+	if _, ok := root.FindByID([]int{1}); ok {
+		t.Errorf("expected no model for an uncomparable ID")
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	model.SetIDGenerator(model.UUIDv7)
+	defer model.SetIDGenerator(nil)
+	reg := model.NewRegistry()
+	root := model.New(stdModel.ModelTypeHash)
+	child := model.New(stdModel.ModelTypeHash)
+	root.Set("child", child)
+	sub, err := reg.Track(root)
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer sub.Cancel()
+
+	if found, ok := reg.Get(child.GetID()); !ok || found != child {
+		t.Errorf("expected the child model, received %v", found)
+	}
+	added := model.New(stdModel.ModelTypeList)
+	root.Set("added", added)
+	if found, ok := reg.Get(added.GetID()); !ok || found != added {
+		t.Errorf("expected the added model, received %v", found)
+	}
+	root.Delete("child")
+	if _, ok := reg.Get(child.GetID()); ok {
+		t.Errorf("expected the deleted model to be unregistered")
+	}
+
+	dup := model.New(stdModel.ModelTypeHash)
+	dup.SetID(added.GetID())
+	if err := reg.Register(dup); !errors.Is(err, model.DuplicateValue) {
+		t.Errorf("expected DuplicateValue, received %v", err)
+	}
+	dup.SetID(nil)
+	if err := reg.Register(dup); !errors.Is(err, model.InvalidIndex) {
+		t.Errorf("expected InvalidIndex, received %v", err)
+	}
+}
+
+func TestRegistryWeak(t *testing.T) {
+	model.SetIDGenerator(model.UUIDv7)
+	defer model.SetIDGenerator(nil)
+	reg := model.NewRegistry()
+	mdl := model.New(stdModel.ModelTypeHash)
+	id := mdl.GetID()
+	reg.Register(mdl)
+	mdl = nil
+	runtime.GC()
+	if _, ok := reg.Get(id); ok {
+		t.Errorf("expected the collected model to be gone")
+	}
+}
+
+func TestIDKey(t *testing.T) {
+	model.SetIDKey("$id")
+	defer model.SetIDKey("")
+	mdl := model.New(stdModel.ModelTypeHash)
+	mdl.SetID("user-1")
+	mdl.Set("name", "Ann")
+	if got := historyJSON(t, mdl); `{"$id":"user-1","name":"Ann"}` != got {
+		t.Errorf(`expected {"$id":"user-1","name":"Ann"}, received %s`, got)
+	}
+
+	loaded := model.New(stdModel.ModelTypeHash)
+	if err := loaded.UnmarshalJSON([]byte(`{"$id":"user-2","name":"Bob","pet":{"$id":"pet-1"}}`)); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if "user-2" != loaded.GetID() || loaded.Has("$id") {
+		t.Errorf("expected the ID to be read, received %v", loaded.GetID())
+	}
+	if pet, ok := loaded.FindByID("pet-1"); !ok || pet.Has("$id") {
+		t.Errorf("expected the nested ID to be read")
+	}
+}
+
+func TestCloneIDs(t *testing.T) {
+	model.SetIDGenerator(model.UUIDv7)
+	defer model.SetIDGenerator(nil)
+	root := model.New(stdModel.ModelTypeHash)
+	child := model.New(stdModel.ModelTypeHash)
+	root.Set("child", child)
+	root.Set("copy", child.Clone())
+
+	val, _ := root.Get("copy")
+	clone, _ := val.Model()
+	if nil == clone.(*model.Model).GetID() || child.GetID() == clone.(*model.Model).GetID() {
+		t.Errorf("expected the clone to have a new ID")
+	}
+	if err := model.NewRegistry().RegisterTree(root); nil != err {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestNumericIDs(t *testing.T) {
+	model.SetIDGenerator(model.SequentialIDs(1))
+	defer model.SetIDGenerator(nil)
+	model.SetIDKey("$id")
+	defer model.SetIDKey("")
+
+	root := model.New(stdModel.ModelTypeHash)
+	child := model.New(stdModel.ModelTypeHash)
+	child.Set("name", "child")
+	root.Set("child", child)
+	jsn, _ := root.MarshalJSON()
+
+	model.SetIDGenerator(nil)
+	loaded := model.New(stdModel.ModelTypeHash)
+	if err := loaded.UnmarshalJSON(jsn); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	found, ok := loaded.FindByID(child.GetID())
+	if !ok {
+		t.Fatalf("expected to find ID %v in %s", child.GetID(), jsn)
+	}
+	if name, _ := found.Get("name"); "child" != name.Value() {
+		t.Errorf("expected the child model, received %v", name.Value())
+	}
+
+	reg := model.NewRegistry()
+	reg.Register(found)
+	if _, ok := reg.Get(uint8(2)); !ok {
+		t.Errorf("expected numeric IDs to match by value")
+	}
+}
+
+func TestStoreKeepsIDs(t *testing.T) {
+	model.SetIDGenerator(model.SequentialIDs(1))
+	defer model.SetIDGenerator(nil)
+	dir := t.TempDir()
+	store := openStore(t, dir, model.StoreOptions{})
+	db := model.New(stdModel.ModelTypeHash)
+	db.Set("port", 5432)
+	store.Model().Set("db", db)
+	if err := store.Close(); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	store = openStore(t, dir, model.StoreOptions{})
+	defer store.Close()
+	if _, ok := store.Model().FindByID(db.GetID()); !ok {
+		t.Errorf("expected model IDs to be kept")
+	}
+}
+
+func TestRegistryTrackTx(t *testing.T) {
+	model.SetIDGenerator(model.UUIDv7)
+	defer model.SetIDGenerator(nil)
+	reg := model.NewRegistry()
+	root := model.New(stdModel.ModelTypeHash)
+	child := model.New(stdModel.ModelTypeHash)
+	root.Set("a", child)
+	sub, err := reg.Track(root)
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer sub.Cancel()
+
+	// Move the child within a transaction; the tree receives a copy keeping
+	// its ID.
+	tx := root.Begin()
+	val, _ := tx.Get("a")
+	staged, _ := val.Model()
+	tx.Set("b", staged)
+	tx.Delete("a")
+	if err := tx.Commit(); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	val, _ = root.Get("b")
+	moved, _ := val.Model()
+	if found, ok := reg.Get(child.GetID()); !ok || found != moved {
+		t.Errorf("expected the committed copy to be registered")
+	}
+
+	// Replace the copy with another; the original it replaced has left the
+	// tree.
+	tx = root.Begin()
+	tx.Set("b", moved)
+	if err := tx.Commit(); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	val, _ = root.Get("b")
+	replaced, _ := val.Model()
+	if found, ok := reg.Get(child.GetID()); !ok || found != replaced || found == moved {
+		t.Errorf("expected the new copy to be registered")
+	}
+
+	// A registered model outside the tree gives way to its committed copy.
+	outside := model.New(stdModel.ModelTypeHash)
+	reg.Register(outside)
+	tx = root.Begin()
+	tx.Set("c", outside)
+	if err := tx.Commit(); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	val, _ = root.Get("c")
+	committed, _ := val.Model()
+	if found, ok := reg.Get(outside.GetID()); !ok || found != committed {
+		t.Errorf("expected the committed copy to replace the detached original")
+	}
+}
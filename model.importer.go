@@ -6,7 +6,15 @@ import (
 )
 
 func importMap(data map[string]interface{}, node *Model) *Model {
+	key := idKey()
 	for k, v := range data {
+		if "" != key && key == k && stdModel.ModelTypeHash == node.GetType() && idComparable(v) {
+			node.SetID(v)
+			continue
+		}
+		if ref, ok := refFromMap(v); ok {
+			v = ref
+		}
 		switch typedV := v.(type) {
 		case map[string]interface{}:
 			n := New(stdModel.ModelTypeHash)
@@ -29,6 +37,9 @@ func importMap(data map[string]interface{}, node *Model) *Model {
 
 func importSlice(data []interface{}, node *Model) *Model {
 	for _, v := range data {
+		if ref, ok := refFromMap(v); ok {
+			v = ref
+		}
 		switch typedV := v.(type) {
 		case map[string]interface{}:
 			n := New(stdModel.ModelTypeHash)
@@ -0,0 +1,245 @@
+package model
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/bdlm/cast/v2"
+	"github.com/bdlm/errors/v2"
+	stdModel "github.com/bdlm/std/v2/model"
+)
+
+/*
+fieldIndex maps the cast values of a field of the hash models stored in a
+list model to their positions.
+*/
+type fieldIndex struct {
+	path    []string         // dotted field path
+	unique  bool             // reject duplicate values
+	entries map[string][]int // field value -> sorted positions
+}
+
+/*
+CreateIndex creates an index on a field of the hash models stored in this
+list model, allowing FindBy to look up rows by that field's value in
+constant time. Nested fields are addressed with dotted paths, e.g.
+"address.city". Values are indexed by their string cast, so 42 and "42"
+are equal; null and missing values and nested models are not indexed.
+
+The index is maintained by Push, Set, Delete and SetData. Changes made
+directly to the rows themselves are not tracked; call Reindex after making
+them.
+*/
+func (mdl *Model) CreateIndex(field string) error {
+	return mdl.createIndex(field, false)
+}
+
+/*
+CreateUniqueIndex creates an index like CreateIndex that rejects duplicate
+values. It fails with DuplicateValue if the model already contains them, and
+Push and Set fail with DuplicateValue rather than store them.
+*/
+func (mdl *Model) CreateUniqueIndex(field string) error {
+	return mdl.createIndex(field, true)
+}
+
+/*
+DropIndex removes the index on a field.
+*/
+func (mdl *Model) DropIndex(field string) {
+	mdl.mux.Lock()
+	defer mdl.mux.Unlock()
+	delete(mdl.indexes, field)
+}
+
+/*
+FindBy returns the rows whose indexed field matches value, in list order.
+An InvalidIndex error is returned if the field is not indexed.
+*/
+func (mdl *Model) FindBy(field string, value any) ([]*Model, error) {
+	mdl.mux.Lock()
+	defer mdl.mux.Unlock()
+	idx, ok := mdl.indexes[field]
+	if !ok {
+		return nil, errors.WrapE(InvalidIndex, errors.Errorf("field '%s' is not indexed", field))
+	}
+	key, ok := indexKey(unwrap(value))
+	if !ok {
+		return []*Model{}, nil
+	}
+	rows := make([]*Model, 0, len(idx.entries[key]))
+	for _, pos := range idx.entries[key] {
+		// skip rows changed since they were indexed
+		row, _ := unwrap(mdl.data[pos]).(*Model)
+		if current, ok := idx.key(row); ok && current == key {
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+/*
+Reindex rebuilds all indexes of this model.
+*/
+func (mdl *Model) Reindex() error {
+	mdl.mux.Lock()
+	defer mdl.mux.Unlock()
+	return mdl.reindex()
+}
+
+/*
+createIndex builds and stores a new index.
+*/
+func (mdl *Model) createIndex(field string, unique bool) error {
+	if stdModel.ModelTypeList != mdl.GetType() {
+		return errors.WrapE(InvalidMethodContext, errors.Errorf("CreateIndex() is only valid for stdModel.ModelTypeList model types"))
+	}
+	idx := &fieldIndex{path: strings.Split(field, "."), unique: unique}
+
+	mdl.mux.Lock()
+	defer mdl.mux.Unlock()
+	if err := idx.build(mdl.data); nil != err {
+		return err
+	}
+	if nil == mdl.indexes {
+		mdl.indexes = map[string]*fieldIndex{}
+	}
+	mdl.indexes[field] = idx
+	return nil
+}
+
+/*
+reindex rebuilds all indexes. The caller must hold the model lock.
+*/
+func (mdl *Model) reindex() error {
+	for _, idx := range mdl.indexes {
+		if err := idx.build(mdl.data); nil != err {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+indexCheck returns a DuplicateValue error if storing value at pos would
+violate a unique index. A pos of -1 checks a value being appended. The
+caller must hold the model lock.
+*/
+func (mdl *Model) indexCheck(pos int, value any) error {
+	for field, idx := range mdl.indexes {
+		if !idx.unique {
+			continue
+		}
+		key, ok := idx.key(unwrap(value))
+		if !ok {
+			continue
+		}
+		for _, existing := range idx.entries[key] {
+			if existing != pos {
+				return errors.WrapE(DuplicateValue, errors.Errorf("value '%s' already exists for field '%s'", key, field))
+			}
+		}
+	}
+	return nil
+}
+
+/*
+indexAdd indexes the value stored at pos. The caller must hold the model
+lock.
+*/
+func (mdl *Model) indexAdd(pos int, value any) {
+	for _, idx := range mdl.indexes {
+		if key, ok := idx.key(unwrap(value)); ok {
+			positions := idx.entries[key]
+			at := sort.SearchInts(positions, pos)
+			positions = append(positions, 0)
+			copy(positions[at+1:], positions[at:])
+			positions[at] = pos
+			idx.entries[key] = positions
+		}
+	}
+}
+
+/*
+indexRemove removes the value stored at pos from the indexes. The caller
+must hold the model lock.
+*/
+func (mdl *Model) indexRemove(pos int, value any) {
+	for _, idx := range mdl.indexes {
+		key, ok := idx.key(unwrap(value))
+		if !ok {
+			continue
+		}
+		positions := idx.entries[key]
+		at := sort.SearchInts(positions, pos)
+		if at < len(positions) && pos == positions[at] {
+			positions = append(positions[:at], positions[at+1:]...)
+		}
+		if 0 == len(positions) {
+			delete(idx.entries, key)
+		} else {
+			idx.entries[key] = positions
+		}
+	}
+}
+
+/*
+indexShift decrements the indexed positions following a deleted position.
+The caller must hold the model lock.
+*/
+func (mdl *Model) indexShift(deleted int) {
+	for _, idx := range mdl.indexes {
+		for _, positions := range idx.entries {
+			for k := sort.SearchInts(positions, deleted); k < len(positions); k++ {
+				positions[k]--
+			}
+		}
+	}
+}
+
+/*
+build indexes data, replacing the current entries.
+*/
+func (idx *fieldIndex) build(data []any) error {
+	entries := map[string][]int{}
+	for pos, val := range data {
+		key, ok := idx.key(unwrap(val))
+		if !ok {
+			continue
+		}
+		if idx.unique && 0 < len(entries[key]) {
+			return errors.WrapE(DuplicateValue, errors.Errorf("value '%s' already exists for field '%s'", key, strings.Join(idx.path, ".")))
+		}
+		entries[key] = append(entries[key], pos)
+	}
+	idx.entries = entries
+	return nil
+}
+
+/*
+key returns the index key of a row.
+*/
+func (idx *fieldIndex) key(row any) (string, bool) {
+	if mdl, ok := row.(*Model); !ok || nil == mdl {
+		return "", false
+	}
+	val, ok := lookupPath(row, idx.path)
+	if !ok {
+		return "", false
+	}
+	return indexKey(val)
+}
+
+/*
+indexKey returns the index key of a field value.
+*/
+func indexKey(val any) (string, bool) {
+	if nil == val {
+		return "", false
+	}
+	if _, _, kind := jpChildren(val); jpScalar != kind {
+		return "", false
+	}
+	key, err := cast.ToE[string](val)
+	return key, nil == err
+}
@@ -0,0 +1,143 @@
+package model_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bdlm/model"
+	stdModel "github.com/bdlm/std/v2/model"
+)
+
+func indexRow(id any, email, city string) *model.Model {
+	row := model.New(stdModel.ModelTypeHash)
+	row.Set("id", id)
+	row.Set("email", email)
+	address := model.New(stdModel.ModelTypeHash)
+	address.Set("city", city)
+	row.Set("address", address)
+	return row
+}
+
+func findIDs(t *testing.T, mdl *model.Model, field string, value any) []any {
+	t.Helper()
+	rows, err := mdl.FindBy(field, value)
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ids := []any{}
+	for _, row := range rows {
+		id, _ := row.Get("id")
+		ids = append(ids, id.Value())
+	}
+	return ids
+}
+
+func TestIndex(t *testing.T) {
+	mdl := model.New(stdModel.ModelTypeList)
+	mdl.Push(indexRow(1, "a@example.com", "Paris"))
+	mdl.Push(indexRow(2, "b@example.com", "Rome"))
+
+	if err := mdl.CreateUniqueIndex("id"); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := mdl.CreateIndex("address.city"); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mdl.Push(indexRow(3, "c@example.com", "Paris"))
+	if ids := findIDs(t, mdl, "address.city", "Paris"); 2 != len(ids) || 1 != ids[0] || 3 != ids[1] {
+		t.Errorf("expected rows 1 and 3, received %v", ids)
+	}
+	if ids := findIDs(t, mdl, "id", "2"); 1 != len(ids) || 2 != ids[0] {
+		t.Errorf("expected the cast value to match row 2, received %v", ids)
+	}
+
+	if err := mdl.Push(indexRow(2, "d@example.com", "Oslo")); !errors.Is(err, model.DuplicateValue) {
+		t.Errorf("expected DuplicateValue, received %v", err)
+	}
+	if err := mdl.Set(0, indexRow(3, "d@example.com", "Oslo")); !errors.Is(err, model.DuplicateValue) {
+		t.Errorf("expected DuplicateValue, received %v", err)
+	}
+
+	if err := mdl.Set(0, indexRow(1, "a@example.com", "Oslo")); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ids := findIDs(t, mdl, "address.city", "Paris"); 1 != len(ids) || 3 != ids[0] {
+		t.Errorf("expected row 3, received %v", ids)
+	}
+
+	if err := mdl.Delete(1); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ids := findIDs(t, mdl, "id", 3); 1 != len(ids) || 3 != ids[0] {
+		t.Errorf("expected row 3 after delete, received %v", ids)
+	}
+	if ids := findIDs(t, mdl, "id", 2); 0 != len(ids) {
+		t.Errorf("expected deleted row to be gone, received %v", ids)
+	}
+
+	if _, err := mdl.FindBy("email", "a@example.com"); !errors.Is(err, model.InvalidIndex) {
+		t.Errorf("expected InvalidIndex, received %v", err)
+	}
+	mdl.DropIndex("id")
+	if _, err := mdl.FindBy("id", 1); !errors.Is(err, model.InvalidIndex) {
+		t.Errorf("expected InvalidIndex after DropIndex, received %v", err)
+	}
+}
+
+func TestIndexErrors(t *testing.T) {
+	mdl := model.New(stdModel.ModelTypeList)
+	mdl.Push(indexRow(1, "a@example.com", "Paris"))
+	mdl.Push(indexRow(1, "b@example.com", "Rome"))
+	if err := mdl.CreateUniqueIndex("id"); !errors.Is(err, model.DuplicateValue) {
+		t.Errorf("expected DuplicateValue, received %v", err)
+	}
+	if err := model.New(stdModel.ModelTypeHash).CreateIndex("id"); !errors.Is(err, model.InvalidMethodContext) {
+		t.Errorf("expected InvalidMethodContext, received %v", err)
+	}
+
+	// rows changed directly are found again after Reindex
+	mdl.CreateIndex("email")
+	val, _ := mdl.Get(0)
+	row, _ := val.Model()
+	row.Set("email", "z@example.com")
+	if ids := findIDs(t, mdl, "email", "a@example.com"); 0 != len(ids) {
+		t.Errorf("expected stale entries to be skipped, received %v", ids)
+	}
+	mdl.Reindex()
+	if ids := findIDs(t, mdl, "email", "z@example.com"); 1 != len(ids) {
+		t.Errorf("expected the row after Reindex, received %v", ids)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	hash := model.New(stdModel.ModelTypeHash)
+	hash.Set("a", 1)
+	hash.Set("b", 2)
+	hash.Set("c", 3)
+	if err := hash.Delete("a"); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if hash.Has("a") {
+		t.Errorf("expected 'a' to be deleted")
+	}
+	if val, err := hash.Get("c"); nil != err || 3 != val.Value() {
+		t.Errorf("expected 'c' to be 3, received %v (%v)", val, err)
+	}
+	if err := hash.Delete("a"); !errors.Is(err, model.InvalidIndex) {
+		t.Errorf("expected InvalidIndex, received %v", err)
+	}
+
+	list := model.New(stdModel.ModelTypeList)
+	list.Push("x")
+	list.Push("y")
+	if err := list.Delete(0); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if val, err := list.Get(0); nil != err || "y" != val.Value() {
+		t.Errorf("expected 'y', received %v (%v)", val, err)
+	}
+	if err := list.Delete(1); !errors.Is(err, model.InvalidIndex) {
+		t.Errorf("expected InvalidIndex, received %v", err)
+	}
+}
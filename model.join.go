@@ -0,0 +1,220 @@
+package model
+
+import (
+	"strings"
+
+	"github.com/bdlm/errors/v2"
+	stdModel "github.com/bdlm/std/v2/model"
+)
+
+/*
+JoinType selects the rows produced by Join.
+*/
+type JoinType int
+
+const (
+	// InnerJoin produces only rows matched on both sides.
+	InnerJoin JoinType = iota
+	// LeftJoin also produces unmatched rows from the left model.
+	LeftJoin
+	// FullJoin also produces unmatched rows from both models.
+	FullJoin
+)
+
+/*
+JoinOptions configures Join.
+*/
+type JoinOptions struct {
+	// Type is the join type, InnerJoin by default.
+	Type JoinType
+	// On lists the fields rows are matched on. Nested fields are addressed
+	// with dotted paths.
+	On []string
+	// RightOn lists the fields of the right rows matched against On, if
+	// they are named differently. It must be empty or as long as On.
+	RightOn []string
+	// LeftPrefix and RightPrefix are prepended to keys present in the rows
+	// of both models, other than the join fields of their own side. If both
+	// are empty the right value wins.
+	LeftPrefix  string
+	RightPrefix string
+}
+
+/*
+Join joins two list models of hash rows, producing a list model of merged
+hash rows. Join field values are compared by their string cast; rows where
+a join field is missing or null never match. Matched rows are produced in
+the order of the left model, followed by unmatched right rows for full
+joins.
+
+Join fields named the same on both sides appear once in each merged row,
+taking the value from the left row if present. Join fields keep their
+names; a field of the other row colliding with one is prefixed. Nested
+values are shared with the source rows, not copied.
+*/
+func Join(left, right *Model, opts JoinOptions) (*Model, error) {
+	if stdModel.ModelTypeList != left.GetType() || stdModel.ModelTypeList != right.GetType() {
+		return nil, errors.WrapE(InvalidMethodContext, errors.Errorf("Join() is only valid for stdModel.ModelTypeList model types"))
+	}
+	if 0 == len(opts.On) {
+		return nil, errors.WrapE(InvalidIndex, errors.Errorf("no join fields specified"))
+	}
+	rightOn := opts.RightOn
+	if 0 == len(rightOn) {
+		rightOn = opts.On
+	}
+	if len(rightOn) != len(opts.On) {
+		return nil, errors.WrapE(InvalidIndex, errors.Errorf("%d left join fields but %d right join fields", len(opts.On), len(rightOn)))
+	}
+
+	leftRows, leftKeys, err := joinRows(left, "left")
+	if nil != err {
+		return nil, err
+	}
+	rightRows, rightKeys, err := joinRows(right, "right")
+	if nil != err {
+		return nil, err
+	}
+
+	jn := &joiner{opts: opts, leftOn: joinFields(opts.On), rightOn: joinFields(rightOn), collisions: map[string]bool{}}
+	for key := range leftKeys {
+		if rightKeys[key] && !(jn.leftOn[key] && jn.rightOn[key]) {
+			jn.collisions[key] = true
+		}
+	}
+
+	leftPaths := splitPaths(opts.On)
+	rightPaths := splitPaths(rightOn)
+	index := map[string][]int{}
+	for k, row := range rightRows {
+		if key, ok := joinKey(row, rightPaths); ok {
+			index[key] = append(index[key], k)
+		}
+	}
+
+	result := New(stdModel.ModelTypeList)
+	matched := make([]bool, len(rightRows))
+	for _, row := range leftRows {
+		key, ok := joinKey(row, leftPaths)
+		if ok && 0 < len(index[key]) {
+			for _, k := range index[key] {
+				matched[k] = true
+				result.Push(jn.merge(row, rightRows[k]))
+			}
+			continue
+		}
+		if InnerJoin != opts.Type {
+			result.Push(jn.merge(row, nil))
+		}
+	}
+	if FullJoin == opts.Type {
+		for k, row := range rightRows {
+			if !matched[k] {
+				result.Push(jn.merge(nil, row))
+			}
+		}
+	}
+	return result, nil
+}
+
+/*
+joiner holds the state of a single Join call.
+*/
+type joiner struct {
+	opts       JoinOptions
+	leftOn     map[string]bool // top-level keys of the left join fields
+	rightOn    map[string]bool // top-level keys of the right join fields
+	collisions map[string]bool // keys present on both sides, other than shared join fields
+}
+
+/*
+merge merges a left and right row, either of which may be nil.
+*/
+func (jn *joiner) merge(left, right *Model) *Model {
+	row := New(stdModel.ModelTypeHash)
+	if nil != left {
+		keys, values := left.entries()
+		for k, key := range keys {
+			if jn.collisions[key] && !jn.leftOn[key] {
+				key = jn.opts.LeftPrefix + key
+			}
+			row.Set(key, values[k])
+		}
+	}
+	if nil != right {
+		keys, values := right.entries()
+		for k, key := range keys {
+			switch {
+			case jn.rightOn[key] && jn.leftOn[key]:
+				if !row.Has(key) {
+					row.Set(key, values[k])
+				}
+				continue
+			case jn.collisions[key] && !jn.rightOn[key]:
+				key = jn.opts.RightPrefix + key
+			}
+			row.Set(key, values[k])
+		}
+	}
+	return row
+}
+
+/*
+joinFields returns the set of top-level keys of dotted join fields.
+*/
+func joinFields(fields []string) map[string]bool {
+	keys := map[string]bool{}
+	for _, field := range fields {
+		keys[strings.SplitN(field, ".", 2)[0]] = true
+	}
+	return keys
+}
+
+/*
+joinRows returns the hash rows of a list model and the set of their keys.
+*/
+func joinRows(mdl *Model, side string) ([]*Model, map[string]bool, error) {
+	_, values := mdl.entries()
+	rows := make([]*Model, len(values))
+	keys := map[string]bool{}
+	for k, val := range values {
+		row, ok := val.(*Model)
+		if !ok || stdModel.ModelTypeHash != row.GetType() {
+			return nil, nil, errors.WrapE(InvalidDataSet, errors.Errorf("%s row %d is not a hash model", side, k))
+		}
+		rowKeys, _ := row.entries()
+		for _, key := range rowKeys {
+			keys[key] = true
+		}
+		rows[k] = row
+	}
+	return rows, keys, nil
+}
+
+/*
+joinKey returns the combined key of the join field values of a row.
+*/
+func joinKey(row *Model, paths [][]string) (string, bool) {
+	parts := make([]string, len(paths))
+	for k, path := range paths {
+		val, ok := lookupPath(row, path)
+		if !ok {
+			return "", false
+		}
+		if parts[k], ok = indexKey(val); !ok {
+			return "", false
+		}
+	}
+	return strings.Join(parts, "\x00"), true
+}
+
+/*
+splitPaths splits dotted field paths.
+*/
+func splitPaths(fields []string) [][]string {
+	paths := make([][]string, len(fields))
+	for k, field := range fields {
+		paths[k] = strings.Split(field, ".")
+	}
+	return paths
+}
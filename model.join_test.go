@@ -0,0 +1,100 @@
+package model_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bdlm/model"
+	stdModel "github.com/bdlm/std/v2/model"
+)
+
+func joinModels(t *testing.T) (*model.Model, *model.Model) {
+	t.Helper()
+	users := model.New(stdModel.ModelTypeList)
+	if err := users.UnmarshalJSON([]byte(`[
+		{"id": 1, "name": "alice", "org": "x"},
+		{"id": 2, "name": "bob", "org": "x"},
+		{"id": 3, "name": "carol", "org": "y"}
+	]`)); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	orders := model.New(stdModel.ModelTypeList)
+	if err := orders.UnmarshalJSON([]byte(`[
+		{"id": 100, "user_id": "1", "name": "book", "total": 10},
+		{"id": 101, "user_id": "1", "name": "pen", "total": 2},
+		{"id": 102, "user_id": "4", "name": "lamp", "total": 30}
+	]`)); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return users, orders
+}
+
+func TestJoin(t *testing.T) {
+	users, orders := joinModels(t)
+	tests := []struct {
+		typ      model.JoinType
+		expected string
+	}{
+		{model.InnerJoin, `[` +
+			`{"id":1,"u_name":"alice","org":"x","o_id":100,"o_name":"book","total":10,"user_id":"1"},` +
+			`{"id":1,"u_name":"alice","org":"x","o_id":101,"o_name":"pen","total":2,"user_id":"1"}]`},
+		{model.LeftJoin, `[` +
+			`{"id":1,"u_name":"alice","org":"x","o_id":100,"o_name":"book","total":10,"user_id":"1"},` +
+			`{"id":1,"u_name":"alice","org":"x","o_id":101,"o_name":"pen","total":2,"user_id":"1"},` +
+			`{"id":2,"u_name":"bob","org":"x"},` +
+			`{"id":3,"u_name":"carol","org":"y"}]`},
+		{model.FullJoin, `[` +
+			`{"id":1,"u_name":"alice","org":"x","o_id":100,"o_name":"book","total":10,"user_id":"1"},` +
+			`{"id":1,"u_name":"alice","org":"x","o_id":101,"o_name":"pen","total":2,"user_id":"1"},` +
+			`{"id":2,"u_name":"bob","org":"x"},` +
+			`{"id":3,"u_name":"carol","org":"y"},` +
+			`{"o_id":102,"o_name":"lamp","total":30,"user_id":"4"}]`},
+	}
+	for _, test := range tests {
+		result, err := model.Join(users, orders, model.JoinOptions{
+			Type:        test.typ,
+			On:          []string{"id"},
+			RightOn:     []string{"user_id"},
+			LeftPrefix:  "u_",
+			RightPrefix: "o_",
+		})
+		if nil != err {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if data, _ := result.MarshalJSON(); test.expected != string(data) {
+			t.Errorf("join %d: expected\n%s\nreceived\n%s", test.typ, test.expected, data)
+		}
+	}
+}
+
+func TestJoinMultipleFields(t *testing.T) {
+	left := model.New(stdModel.ModelTypeList)
+	left.UnmarshalJSON([]byte(`[{"a": 1, "b": "x", "v": "l1"}, {"a": 1, "b": "y", "v": "l2"}, {"a": null, "b": "x", "v": "l3"}]`))
+	right := model.New(stdModel.ModelTypeList)
+	right.UnmarshalJSON([]byte(`[{"a": 1, "b": "y", "v": "r1"}, {"a": null, "b": "x", "v": "r2"}]`))
+
+	result, err := model.Join(left, right, model.JoinOptions{On: []string{"a", "b"}})
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if data, _ := result.MarshalJSON(); `[{"a":1,"b":"y","v":"r1"}]` != string(data) {
+		t.Errorf("unexpected result %s", data)
+	}
+}
+
+func TestJoinErrors(t *testing.T) {
+	users, orders := joinModels(t)
+	if _, err := model.Join(users, orders, model.JoinOptions{}); !errors.Is(err, model.InvalidIndex) {
+		t.Errorf("expected InvalidIndex, received %v", err)
+	}
+	if _, err := model.Join(users, orders, model.JoinOptions{On: []string{"id"}, RightOn: []string{"a", "b"}}); !errors.Is(err, model.InvalidIndex) {
+		t.Errorf("expected InvalidIndex, received %v", err)
+	}
+	if _, err := model.Join(users, model.New(stdModel.ModelTypeHash), model.JoinOptions{On: []string{"id"}}); !errors.Is(err, model.InvalidMethodContext) {
+		t.Errorf("expected InvalidMethodContext, received %v", err)
+	}
+	orders.Push(1)
+	if _, err := model.Join(users, orders, model.JoinOptions{On: []string{"id"}}); !errors.Is(err, model.InvalidDataSet) {
+		t.Errorf("expected InvalidDataSet, received %v", err)
+	}
+}
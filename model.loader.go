@@ -0,0 +1,210 @@
+package model
+
+import (
+	"flag"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bdlm/errors/v2"
+	stdModel "github.com/bdlm/std/v2/model"
+)
+
+/*
+EnvSeparator separates nested keys in environment variable names, e.g.
+APP_DB__HOST refers to the key "db.host".
+*/
+const EnvSeparator = "__"
+
+/*
+LoadEnv overlays the environment variables beginning with prefix onto the
+hash model mdl. See LoadEnviron.
+*/
+func LoadEnv(mdl *Model, prefix string) error {
+	return LoadEnviron(mdl, prefix, os.Environ())
+}
+
+/*
+LoadEnviron overlays a list of "KEY=value" environment strings onto the hash
+model mdl. Only variables beginning with prefix followed by "_" are used, so
+with the prefix "APP" the variable APPDATA is ignored. An empty prefix uses
+all variables.
+
+The prefix is removed and the remaining name is lowercased and split on
+EnvSeparator to form a key path, e.g. with the prefix "APP" the variable
+APP_DB__HOST sets "db.host". Nested hash models are created as needed and
+existing keys are matched case-insensitively. Values replacing existing
+values are cast to the existing value's type, values for new keys are
+stored as strings.
+*/
+func LoadEnviron(mdl *Model, prefix string, environ []string) error {
+	if stdModel.ModelTypeHash != mdl.GetType() {
+		return errors.WrapE(InvalidMethodContext, errors.Errorf("LoadEnviron() is only valid for stdModel.ModelTypeHash model types"))
+	}
+
+	if "" != prefix && !strings.HasSuffix(prefix, "_") {
+		prefix += "_"
+	}
+	for _, env := range environ {
+		variable, value, ok := strings.Cut(env, "=")
+		if !ok || !strings.HasPrefix(variable, prefix) {
+			continue
+		}
+		name := strings.TrimPrefix(variable, prefix)
+		if "" == name {
+			continue
+		}
+		path := strings.Split(strings.ToLower(name), EnvSeparator)
+		if err := overlay(mdl, path, value); nil != err {
+			return errors.Wrap(err, "could not load environment variable '%s'", variable)
+		}
+	}
+	return nil
+}
+
+/*
+LoadFlags overlays the flags that have been set in fs onto the hash model
+mdl. Flag names are split on "." to form a key path, e.g. the flag -db.host
+sets "db.host". Values are converted as described in LoadEnviron.
+*/
+func LoadFlags(mdl *Model, fs *flag.FlagSet) error {
+	if stdModel.ModelTypeHash != mdl.GetType() {
+		return errors.WrapE(InvalidMethodContext, errors.Errorf("LoadFlags() is only valid for stdModel.ModelTypeHash model types"))
+	}
+
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		if nil != err {
+			return
+		}
+		var value any = f.Value.String()
+		if getter, ok := f.Value.(flag.Getter); ok {
+			value = getter.Get()
+		}
+		if e := overlay(mdl, strings.Split(f.Name, "."), value); nil != e {
+			err = errors.Wrap(e, "could not load flag '%s'", f.Name)
+		}
+	})
+	return err
+}
+
+/*
+overlay stores value at path in mdl, creating nested hash models as needed.
+*/
+func overlay(mdl *Model, path []string, value any) error {
+	node := mdl
+	for k, key := range path {
+		keys, values := node.entries()
+
+		// List models are addressed by index.
+		if stdModel.ModelTypeList == node.GetType() {
+			idx, err := strconv.Atoi(key)
+			if nil != err || idx < 0 || idx >= len(values) {
+				return errors.WrapE(InvalidIndex, errors.Errorf("invalid list index '%s'", key))
+			}
+			if k == len(path)-1 {
+				val, err := convertTo(value, values[idx])
+				if nil != err {
+					return err
+				}
+				return node.Set(idx, val)
+			}
+			child, ok := values[idx].(*Model)
+			if !ok {
+				return errors.WrapE(InvalidIndex, errors.Errorf("'%s' is not a model", strings.Join(path[:k+1], ".")))
+			}
+			node = child
+			continue
+		}
+
+		if idx := findKey(keys, key); idx >= 0 {
+			key = keys[idx]
+			if k == len(path)-1 {
+				val, err := convertTo(value, values[idx])
+				if nil != err {
+					return err
+				}
+				return node.Set(key, val)
+			}
+			child, ok := values[idx].(*Model)
+			if !ok {
+				child = New(stdModel.ModelTypeHash)
+				node.Set(key, child)
+			}
+			node = child
+			continue
+		}
+
+		if k == len(path)-1 {
+			return node.Set(key, value)
+		}
+		child := New(stdModel.ModelTypeHash)
+		node.Set(key, child)
+		node = child
+	}
+	return nil
+}
+
+/*
+convertTo converts value to the type of existing. Comma-separated strings
+replacing list models are split into a new list model whose values are
+converted to the type of the first existing element.
+*/
+func convertTo(value any, existing any) (any, error) {
+	switch typed := existing.(type) {
+	case nil:
+		return value, nil
+	case *Model:
+		if stdModel.ModelTypeHash == typed.GetType() {
+			return nil, errors.WrapE(InvalidDataSet, errors.Errorf("cannot replace a hash model with '%v'", value))
+		}
+		str, ok := value.(string)
+		if !ok {
+			return nil, errors.WrapE(InvalidDataSet, errors.Errorf("cannot replace a list model with '%v'", value))
+		}
+		_, items := typed.entries()
+		var first any
+		if len(items) > 0 {
+			first = items[0]
+		}
+		list := New(stdModel.ModelTypeList)
+		for _, item := range strings.Split(str, ",") {
+			val, err := convertTo(strings.TrimSpace(item), first)
+			if nil != err {
+				return nil, err
+			}
+			list.Push(val)
+		}
+		return list, nil
+	case time.Time:
+		if t, ok := value.(time.Time); ok {
+			return t, nil
+		}
+		str, ok := value.(string)
+		if !ok {
+			return nil, errors.Errorf("cannot convert '%v' to time.Time", value)
+		}
+		for _, layout := range timeLayouts {
+			if t, err := time.Parse(layout, str); nil == err {
+				return t, nil
+			}
+		}
+		return nil, errors.Errorf("cannot parse '%s' as a time", str)
+	case time.Duration:
+		switch v := value.(type) {
+		case time.Duration:
+			return v, nil
+		case string:
+			return time.ParseDuration(v)
+		}
+	}
+
+	typ := reflect.TypeOf(existing)
+	val, err := castScalar(value, typ)
+	if nil != err {
+		return value, errors.Wrap(err, "could not convert '%v' to %s", value, typ)
+	}
+	return val.Interface(), nil
+}
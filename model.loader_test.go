@@ -0,0 +1,109 @@
+package model_test
+
+import (
+	"flag"
+	"testing"
+	"time"
+
+	"github.com/bdlm/model"
+	stdModel "github.com/bdlm/std/v2/model"
+)
+
+func TestLoadEnviron(t *testing.T) {
+	mdl := model.New(stdModel.ModelTypeHash)
+	if err := mdl.UnmarshalJSON([]byte(`{"db": {"Host": "localhost", "port": 5432, "tls": false}, "tags": ["a"]}`)); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err := model.LoadEnviron(mdl, "APP", []string{
+		"APP_DB__HOST=db.internal",
+		"APP_DB__PORT=6543",
+		"APP_DB__TLS=true",
+		"APP_CACHE__TTL=5m",
+		"APP_TAGS=x, y",
+		"OTHER_DB__HOST=ignored",
+	})
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	val, _ := mdl.Get("db")
+	db, _ := val.Model()
+	if host, _ := db.Get("Host"); "db.internal" != host.Value() {
+		t.Errorf("expected existing key to be overridden, received %v", host.Value())
+	}
+	if port, _ := db.Get("port"); 6543.0 != port.Value() {
+		t.Errorf("expected port cast to float64, received %#v", port.Value())
+	}
+	if tls, _ := db.Get("tls"); true != tls.Value() {
+		t.Errorf("expected tls cast to bool, received %#v", tls.Value())
+	}
+
+	val, err = mdl.Get("cache")
+	if nil != err {
+		t.Fatalf("expected nested model 'cache' to be created: %v", err)
+	}
+	cache, _ := val.Model()
+	if ttl, _ := cache.Get("ttl"); "5m" != ttl.Value() {
+		t.Errorf("expected new key stored as a string, received %#v", ttl.Value())
+	}
+
+	val, _ = mdl.Get("tags")
+	tags, _ := val.Model()
+	if second, err := tags.Get(1); nil != err || "y" != second.Value() {
+		t.Errorf("expected tags to be split, received %v (%v)", second, err)
+	}
+
+	if err := model.LoadEnviron(mdl, "APP", []string{"APP_DB__PORT=many"}); nil == err {
+		t.Errorf("expected a conversion error")
+	}
+}
+
+func TestLoadEnvironPrefixBoundary(t *testing.T) {
+	mdl := model.New(stdModel.ModelTypeHash)
+	err := model.LoadEnviron(mdl, "APP", []string{
+		"APPDATA=c:/x",
+		"APPLE_PIE=1",
+		"APP=root",
+		"APP_NAME=demo",
+	})
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if received, _ := mdl.MarshalJSON(); `{"name":"demo"}` != string(received) {
+		t.Errorf("expected only APP_NAME to be loaded, received %s", received)
+	}
+}
+
+func TestLoadFlags(t *testing.T) {
+	mdl := model.New(stdModel.ModelTypeHash)
+	mdl.Set("timeout", time.Second)
+	mdl.Set("workers", 1)
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Duration("timeout", 0, "")
+	fs.String("workers", "", "")
+	fs.String("db.host", "", "")
+	fs.String("unset", "default", "")
+	if err := fs.Parse([]string{"-timeout", "2s", "-workers", "8", "-db.host", "remote"}); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := model.LoadFlags(mdl, fs); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if val, _ := mdl.Get("timeout"); 2*time.Second != val.Value() {
+		t.Errorf("expected 2s, received %#v", val.Value())
+	}
+	if val, _ := mdl.Get("workers"); 8 != val.Value() {
+		t.Errorf("expected workers cast to int, received %#v", val.Value())
+	}
+	if mdl.Has("unset") {
+		t.Errorf("expected unset flags to be ignored")
+	}
+	val, _ := mdl.Get("db")
+	db, _ := val.Model()
+	if host, _ := db.Get("host"); "remote" != host.Value() {
+		t.Errorf("expected db.host to be 'remote', received %#v", host.Value())
+	}
+}
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"bytes"
 	"encoding/json"
 
 	"github.com/bdlm/errors/v2"
@@ -9,23 +10,114 @@ import (
 
 /*
 MarshalJSON implements json.Marshaler.
+
+Hash models are encoded as objects in model order and list models as arrays.
+If an ID key is set with SetIDKey, the IDs of hash models are included. Ref
+values are encoded as {"$ref": id}; a model containing itself returns a
+CircularReference error. Null hash values are kept, so that a key holding
+null can be told from a missing key, unless SetOmitNull is used.
+Nested values implementing Marshaler, but not json.Marshaler, are encoded
+with MarshalModel and must produce valid JSON.
 */
 func (mdl *Model) MarshalJSON() ([]byte, error) {
-	if stdModel.ModelTypeList == mdl.GetType() {
-		return json.Marshal(mdl.data)
+	buf := &bytes.Buffer{}
+	if err := writeJSON(buf, mdl); nil != err {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+/*
+writeJSON writes the JSON encoding of a single value.
+*/
+func writeJSON(buf *bytes.Buffer, v any) error {
+	return writeJSONValue(buf, v, nil, false)
+}
+
+/*
+writeJSONValue implements writeJSON. visited holds the models being written,
+to detect models that contain themselves. If omitNull is set, or set on a
+model with SetOmitNull, null hash values are left out.
+*/
+func writeJSONValue(buf *bytes.Buffer, v any, visited []*Model, omitNull bool) error {
+	switch typed := unwrap(v).(type) {
+	case *Model:
+		for _, m := range visited {
+			if m == typed {
+				return errors.WrapE(CircularReference, errors.Errorf("model contains itself; use a Ref"))
+			}
+		}
+		visited = append(visited, typed)
+		omitNull = omitNull || typed.omitNull
+		keys, values := typed.entries()
+		open, close := byte('['), byte(']')
+		if stdModel.ModelTypeHash == typed.GetType() {
+			open, close = '{', '}'
+		}
+		buf.WriteByte(open)
+		sep := false
+		if key := idKey(); "" != key && nil != keys && nil != typed.GetID() && !typed.Has(key) {
+			name, _ := json.Marshal(key)
+			buf.Write(name)
+			buf.WriteByte(':')
+			if err := writeJSONValue(buf, typed.GetID(), visited, omitNull); nil != err {
+				return err
+			}
+			sep = true
+		}
+		for k, val := range values {
+			if omitNull && nil != keys && isNull(val) {
+				continue
+			}
+			if sep {
+				buf.WriteByte(',')
+			}
+			sep = true
+			if nil != keys {
+				key, _ := json.Marshal(keys[k])
+				buf.Write(key)
+				buf.WriteByte(':')
+			}
+			if err := writeJSONValue(buf, val, visited, omitNull); nil != err {
+				return err
+			}
+		}
+		buf.WriteByte(close)
+		return nil
+
+	case json.Marshaler:
+		b, err := json.Marshal(typed)
+		if nil != err {
+			return err
+		}
+		buf.Write(b)
+		return nil
+
+	case Marshaler:
+		b, err := typed.MarshalModel()
+		if nil != err {
+			return err
+		}
+		if !json.Valid(b) {
+			return errors.WrapE(InvalidFormat, errors.Errorf("MarshalModel() for %T did not return valid JSON", typed))
+		}
+		return json.Compact(buf, b)
 	}
-	d := map[string]interface{}{}
-	for k, v := range mdl.data {
-		d[mdl.idxHash[k]] = v
+
+	b, err := json.Marshal(unwrap(v))
+	if nil != err {
+		return err
 	}
-	return json.Marshal(d)
+	buf.Write(b)
+	return nil
 }
 
 /*
-MarshalModel implements Marshaler.
+MarshalModel implements Marshaler. The output format is selected with
+SetFormat and encoded by the codec registered for that format.
 */
 func (mdl *Model) MarshalModel() ([]byte, error) {
-	return mdl.MarshalJSON()
+	return EncodeAs(mdl, mdl.GetFormat())
 }
 
 /*
@@ -44,8 +136,13 @@ func (mdl *Model) UnmarshalJSON(jsn []byte) error {
 }
 
 /*
-UnmarshalModel implements Marshaler.
+UnmarshalModel implements Unmarshaler. The input format is selected with
+SetFormat and decoded by the codec registered for that format.
+UnmarshalModel([]byte("null")) is a no-op.
 */
-func (mdl *Model) UnmarshalModel() ([]byte, error) {
-	return mdl.MarshalJSON()
+func (mdl *Model) UnmarshalModel(data []byte) error {
+	if "null" == string(bytes.TrimSpace(data)) {
+		return nil
+	}
+	return DecodeAs(data, mdl, mdl.GetFormat())
 }
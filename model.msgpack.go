@@ -0,0 +1,476 @@
+package model
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"time"
+
+	"github.com/bdlm/cast/v2"
+	"github.com/bdlm/errors/v2"
+	stdModel "github.com/bdlm/std/v2/model"
+)
+
+/*
+msgpackTimestamp is the MessagePack timestamp extension type, -1.
+*/
+const msgpackTimestamp byte = 0xff
+
+/*
+marshalMsgPack encodes a model as MessagePack.
+
+Hash models are encoded as maps in model order and list models as arrays.
+Integers use the smallest int or uint family encoding, floats keep their
+float32 or float64 encoding, []byte values are encoded as bin and
+time.Time values use the timestamp extension type.
+*/
+func marshalMsgPack(mdl *Model) ([]byte, error) {
+	enc := &msgpackEncoder{}
+	if err := enc.encode(mdl); nil != err {
+		return nil, err
+	}
+	return enc.buf.Bytes(), nil
+}
+
+/*
+unmarshalMsgPack decodes a MessagePack map or array into mdl. Integers are
+decoded as int64, or uint64 if they overflow int64, bin values as []byte and
+timestamps as time.Time.
+*/
+func unmarshalMsgPack(data []byte, mdl *Model) error {
+	dec := &msgpackDecoder{data: data}
+	if len(data) > 0 {
+		switch b := data[0]; {
+		case b >= 0x80 && b <= 0x8f, 0xde == b, 0xdf == b:
+			if stdModel.ModelTypeHash != mdl.GetType() {
+				if err := mdl.SetType(stdModel.ModelTypeHash); nil != err {
+					return errors.WrapE(InvalidDataSet, errors.Errorf("cannot unmarshal a MessagePack map into a list model"))
+				}
+			}
+		case b >= 0x90 && b <= 0x9f, 0xdc == b, 0xdd == b:
+			if stdModel.ModelTypeList != mdl.GetType() {
+				if err := mdl.SetType(stdModel.ModelTypeList); nil != err {
+					return errors.WrapE(InvalidDataSet, errors.Errorf("cannot unmarshal a MessagePack array into a hash model"))
+				}
+			}
+		}
+	}
+	val, err := dec.decode(mdl, 0)
+	if nil != err {
+		return errors.Wrap(err, "unmarshaling failed")
+	}
+	if _, ok := val.(*Model); !ok {
+		return errors.WrapE(InvalidDataSet, errors.Errorf("MessagePack data must be a map or an array"))
+	}
+	if dec.pos != len(data) {
+		return errors.Errorf("unmarshaling failed: %d trailing bytes", len(data)-dec.pos)
+	}
+	return nil
+}
+
+/*
+msgpackEncoder writes MessagePack values.
+*/
+type msgpackEncoder struct {
+	buf     bytes.Buffer
+	visited []*Model
+}
+
+/*
+int writes a signed integer.
+*/
+func (enc *msgpackEncoder) int(i int64) {
+	switch {
+	case i >= 0:
+		enc.uint(uint64(i))
+	case i >= -32:
+		enc.buf.WriteByte(byte(i))
+	case i >= math.MinInt8:
+		enc.buf.WriteByte(0xd0)
+		enc.buf.WriteByte(byte(i))
+	case i >= math.MinInt16:
+		enc.buf.WriteByte(0xd1)
+		enc.buf.Write(binary.BigEndian.AppendUint16(nil, uint16(i)))
+	case i >= math.MinInt32:
+		enc.buf.WriteByte(0xd2)
+		enc.buf.Write(binary.BigEndian.AppendUint32(nil, uint32(i)))
+	default:
+		enc.buf.WriteByte(0xd3)
+		enc.buf.Write(binary.BigEndian.AppendUint64(nil, uint64(i)))
+	}
+}
+
+/*
+uint writes an unsigned integer.
+*/
+func (enc *msgpackEncoder) uint(u uint64) {
+	switch {
+	case u <= 0x7f:
+		enc.buf.WriteByte(byte(u))
+	case u <= math.MaxUint8:
+		enc.buf.WriteByte(0xcc)
+		enc.buf.WriteByte(byte(u))
+	case u <= math.MaxUint16:
+		enc.buf.WriteByte(0xcd)
+		enc.buf.Write(binary.BigEndian.AppendUint16(nil, uint16(u)))
+	case u <= math.MaxUint32:
+		enc.buf.WriteByte(0xce)
+		enc.buf.Write(binary.BigEndian.AppendUint32(nil, uint32(u)))
+	default:
+		enc.buf.WriteByte(0xcf)
+		enc.buf.Write(binary.BigEndian.AppendUint64(nil, u))
+	}
+}
+
+/*
+length writes a length prefix. fix is the fixed-size format byte, or 0 if
+the type has no fixed-size format, and fixMax its maximum length.
+*/
+func (enc *msgpackEncoder) length(n int, fix byte, fixMax int, b8, b16, b32 byte) {
+	switch {
+	case 0 != fix && n <= fixMax:
+		enc.buf.WriteByte(fix | byte(n))
+	case 0 != b8 && n <= math.MaxUint8:
+		enc.buf.WriteByte(b8)
+		enc.buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		enc.buf.WriteByte(b16)
+		enc.buf.Write(binary.BigEndian.AppendUint16(nil, uint16(n)))
+	default:
+		enc.buf.WriteByte(b32)
+		enc.buf.Write(binary.BigEndian.AppendUint32(nil, uint32(n)))
+	}
+}
+
+/*
+encode writes a single value.
+*/
+func (enc *msgpackEncoder) encode(v any) error {
+	switch typed := unwrap(v).(type) {
+	case nil:
+		enc.buf.WriteByte(0xc0)
+	case bool:
+		if typed {
+			enc.buf.WriteByte(0xc3)
+		} else {
+			enc.buf.WriteByte(0xc2)
+		}
+	case int:
+		enc.int(int64(typed))
+	case int8:
+		enc.int(int64(typed))
+	case int16:
+		enc.int(int64(typed))
+	case int32:
+		enc.int(int64(typed))
+	case int64:
+		enc.int(typed)
+	case uint:
+		enc.uint(uint64(typed))
+	case uint8:
+		enc.uint(uint64(typed))
+	case uint16:
+		enc.uint(uint64(typed))
+	case uint32:
+		enc.uint(uint64(typed))
+	case uint64:
+		enc.uint(typed)
+	case float32:
+		enc.buf.WriteByte(0xca)
+		enc.buf.Write(binary.BigEndian.AppendUint32(nil, math.Float32bits(typed)))
+	case float64:
+		enc.buf.WriteByte(0xcb)
+		enc.buf.Write(binary.BigEndian.AppendUint64(nil, math.Float64bits(typed)))
+	case string:
+		enc.length(len(typed), 0xa0, 31, 0xd9, 0xda, 0xdb)
+		enc.buf.WriteString(typed)
+	case []byte:
+		enc.length(len(typed), 0, 0, 0xc4, 0xc5, 0xc6)
+		enc.buf.Write(typed)
+	case time.Time:
+		enc.timestamp(typed)
+	case time.Duration:
+		enc.int(int64(typed))
+	case *Model:
+		return enc.model(typed)
+	case Ref:
+		enc.length(1, 0x80, 15, 0, 0xde, 0xdf)
+		enc.encode(refKey)
+		return enc.encode(typed.ID)
+	default:
+		return encodeOther(typed, enc.encode)
+	}
+	return nil
+}
+
+/*
+timestamp writes a time.Time using the timestamp extension type.
+*/
+func (enc *msgpackEncoder) timestamp(t time.Time) {
+	sec, nsec := t.Unix(), uint32(t.Nanosecond())
+	switch {
+	case 0 == nsec && sec >= 0 && sec <= math.MaxUint32:
+		enc.buf.Write([]byte{0xd6, msgpackTimestamp})
+		enc.buf.Write(binary.BigEndian.AppendUint32(nil, uint32(sec)))
+	case sec >= 0 && sec < 1<<34:
+		enc.buf.Write([]byte{0xd7, msgpackTimestamp})
+		enc.buf.Write(binary.BigEndian.AppendUint64(nil, uint64(nsec)<<34|uint64(sec)))
+	default:
+		enc.buf.Write([]byte{0xc7, 12, msgpackTimestamp})
+		enc.buf.Write(binary.BigEndian.AppendUint32(nil, nsec))
+		enc.buf.Write(binary.BigEndian.AppendUint64(nil, uint64(sec)))
+	}
+}
+
+/*
+model writes a hash model as a map or a list model as an array.
+*/
+func (enc *msgpackEncoder) model(mdl *Model) error {
+	for _, m := range enc.visited {
+		if m == mdl {
+			return errors.WrapE(CircularReference, errors.Errorf("model contains itself"))
+		}
+	}
+	enc.visited = append(enc.visited, mdl)
+	defer func() { enc.visited = enc.visited[:len(enc.visited)-1] }()
+
+	keys, values := mdl.entries()
+	if stdModel.ModelTypeList == mdl.GetType() {
+		enc.length(len(values), 0x90, 15, 0, 0xdc, 0xdd)
+	} else {
+		enc.length(len(values), 0x80, 15, 0, 0xde, 0xdf)
+	}
+	for k, v := range values {
+		if nil != keys {
+			enc.encode(keys[k])
+		}
+		if err := enc.encode(v); nil != err {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+msgpackDecoder reads MessagePack values.
+*/
+type msgpackDecoder struct {
+	data []byte
+	pos  int
+}
+
+/*
+read returns the next n bytes.
+*/
+func (dec *msgpackDecoder) read(n uint64) ([]byte, error) {
+	if n > uint64(len(dec.data)-dec.pos) {
+		return nil, errors.Errorf("unexpected end of data at offset %d", dec.pos)
+	}
+	b := dec.data[dec.pos : dec.pos+int(n)]
+	dec.pos += int(n)
+	return b, nil
+}
+
+/*
+uint reads a big-endian unsigned integer of size bytes.
+*/
+func (dec *msgpackDecoder) uint(size int) (uint64, error) {
+	b, err := dec.read(uint64(size))
+	if nil != err {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return uint64(b[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	}
+	return binary.BigEndian.Uint64(b), nil
+}
+
+/*
+decode reads a single value. If into is not nil, maps and arrays are decoded
+into it instead of a new model.
+*/
+func (dec *msgpackDecoder) decode(into *Model, depth int) (any, error) {
+	if depth > maxDecodeDepth {
+		return nil, errors.Errorf("maximum nesting depth exceeded")
+	}
+	start := dec.pos
+	b, err := dec.read(1)
+	if nil != err {
+		return nil, err
+	}
+
+	switch c := b[0]; {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c >= 0x80 && c <= 0x8f:
+		return dec.hash(into, uint64(c&0x0f), depth)
+	case c >= 0x90 && c <= 0x9f:
+		return dec.list(into, uint64(c&0x0f), depth)
+	case c >= 0xa0 && c <= 0xbf:
+		return dec.str(uint64(c & 0x1f))
+	}
+
+	switch c := b[0]; c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := dec.uint(1 << (c - 0xc4))
+		if nil != err {
+			return nil, err
+		}
+		bin, err := dec.read(n)
+		if nil != err {
+			return nil, err
+		}
+		return append([]byte{}, bin...), nil
+	case 0xc7, 0xc8, 0xc9:
+		n, err := dec.uint(1 << (c - 0xc7))
+		if nil != err {
+			return nil, err
+		}
+		return dec.ext(n)
+	case 0xca:
+		u, err := dec.uint(4)
+		return math.Float32frombits(uint32(u)), err
+	case 0xcb:
+		u, err := dec.uint(8)
+		return math.Float64frombits(u), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		u, err := dec.uint(1 << (c - 0xcc))
+		if nil != err {
+			return nil, err
+		}
+		if u > math.MaxInt64 {
+			return u, nil
+		}
+		return int64(u), nil
+	case 0xd0:
+		u, err := dec.uint(1)
+		return int64(int8(u)), err
+	case 0xd1:
+		u, err := dec.uint(2)
+		return int64(int16(u)), err
+	case 0xd2:
+		u, err := dec.uint(4)
+		return int64(int32(u)), err
+	case 0xd3:
+		u, err := dec.uint(8)
+		return int64(u), err
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return dec.ext(1 << (c - 0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := dec.uint(1 << (c - 0xd9))
+		if nil != err {
+			return nil, err
+		}
+		return dec.str(n)
+	case 0xdc, 0xdd:
+		n, err := dec.uint(2 << (c - 0xdc))
+		if nil != err {
+			return nil, err
+		}
+		return dec.list(into, n, depth)
+	case 0xde, 0xdf:
+		n, err := dec.uint(2 << (c - 0xde))
+		if nil != err {
+			return nil, err
+		}
+		return dec.hash(into, n, depth)
+	}
+	return nil, errors.Errorf("invalid format byte 0x%02x at offset %d", b[0], start)
+}
+
+/*
+str reads a string of n bytes.
+*/
+func (dec *msgpackDecoder) str(n uint64) (any, error) {
+	b, err := dec.read(n)
+	if nil != err {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+/*
+list reads an array of n values.
+*/
+func (dec *msgpackDecoder) list(into *Model, n uint64, depth int) (any, error) {
+	mdl := into
+	if nil == mdl || stdModel.ModelTypeList != mdl.GetType() {
+		mdl = New(stdModel.ModelTypeList)
+	}
+	for a := uint64(0); a < n; a++ {
+		val, err := dec.decode(nil, depth+1)
+		if nil != err {
+			return nil, err
+		}
+		mdl.Push(val)
+	}
+	return mdl, nil
+}
+
+/*
+hash reads a map of n key/value pairs.
+*/
+func (dec *msgpackDecoder) hash(into *Model, n uint64, depth int) (any, error) {
+	mdl := into
+	if nil == mdl || stdModel.ModelTypeHash != mdl.GetType() {
+		mdl = New(stdModel.ModelTypeHash)
+	}
+	for a := uint64(0); a < n; a++ {
+		key, err := dec.decode(nil, depth+1)
+		if nil != err {
+			return nil, err
+		}
+		val, err := dec.decode(nil, depth+1)
+		if nil != err {
+			return nil, err
+		}
+		mdl.Set(cast.To[string](key), val)
+	}
+	if ref, ok := refFromMap(mdl); ok && nil == into {
+		return ref, nil
+	}
+	return mdl, nil
+}
+
+/*
+ext reads an extension value with n bytes of data. Only the timestamp
+extension type is supported.
+*/
+func (dec *msgpackDecoder) ext(n uint64) (any, error) {
+	typ, err := dec.read(1)
+	if nil != err {
+		return nil, err
+	}
+	data, err := dec.read(n)
+	if nil != err {
+		return nil, err
+	}
+	if msgpackTimestamp != typ[0] {
+		return nil, errors.Errorf("unsupported extension type %d", int8(typ[0]))
+	}
+	switch n {
+	case 4:
+		return time.Unix(int64(binary.BigEndian.Uint32(data)), 0).UTC(), nil
+	case 8:
+		u := binary.BigEndian.Uint64(data)
+		return time.Unix(int64(u&(1<<34-1)), int64(u>>34)).UTC(), nil
+	case 12:
+		nsec := binary.BigEndian.Uint32(data[:4])
+		sec := int64(binary.BigEndian.Uint64(data[4:]))
+		return time.Unix(sec, int64(nsec)).UTC(), nil
+	}
+	return nil, errors.Errorf("invalid timestamp length %d", n)
+}
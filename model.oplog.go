@@ -0,0 +1,606 @@
+package model
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"io"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/bdlm/errors/v2"
+	stdModel "github.com/bdlm/std/v2/model"
+)
+
+/*
+Op is a serializable change to a model, recorded by an OpLog.
+
+Ops are encoded as JSON objects, e.g.
+
+	{"op":"set","path":["db","host"],"index":0,"value":"localhost"}
+
+Nested models are encoded as {"$hash":[[key,value],...],"$id":id} or
+{"$list":[value,...],"$id":id} so that their type, key order and ID survive
+a round trip. Other values are encoded as by MarshalJSON; integral numbers are
+decoded as int64 and other numbers as float64.
+*/
+type Op struct {
+	// Type is the kind of change.
+	Type EventType
+	// Path is the path to the changed key, or to the changed model for
+	// EventReorder and EventReplace.
+	Path []any
+	// Index is the position of the changed key, for EventInsert and
+	// EventDelete.
+	Index int
+	// Value is the new value for EventSet and EventInsert, or a model
+	// holding the new data for EventReplace.
+	Value any
+	// Keys is the new key order for EventReorder.
+	Keys []string
+}
+
+/*
+opJSON is the wire form of an Op.
+*/
+type opJSON struct {
+	Op    string          `json:"op"`
+	Path  []any           `json:"path"`
+	Index int             `json:"index,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+	Keys  []string        `json:"keys,omitempty"`
+}
+
+/*
+MarshalJSON implements json.Marshaler.
+*/
+func (op Op) MarshalJSON() ([]byte, error) {
+	return op.marshal(nil)
+}
+
+/*
+marshal implements MarshalJSON. visited holds models the value must not
+contain.
+*/
+func (op Op) marshal(visited []*Model) ([]byte, error) {
+	wire := opJSON{Op: op.Type.String(), Path: op.Path, Index: op.Index, Keys: op.Keys}
+	if nil == wire.Path {
+		wire.Path = []any{}
+	}
+	switch op.Type {
+	case EventSet, EventInsert, EventReplace:
+		buf := &bytes.Buffer{}
+		if err := writeOpValue(buf, op.Value, visited); nil != err {
+			return nil, err
+		}
+		wire.Value = buf.Bytes()
+	}
+	return json.Marshal(wire)
+}
+
+/*
+UnmarshalJSON implements json.Unmarshaler.
+*/
+func (op *Op) UnmarshalJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var wire struct {
+		Op    string   `json:"op"`
+		Path  []any    `json:"path"`
+		Index int      `json:"index"`
+		Value any      `json:"value"`
+		Keys  []string `json:"keys"`
+	}
+	if err := dec.Decode(&wire); nil != err {
+		return errors.WrapE(InvalidFormat, err)
+	}
+
+	typ, ok := parseEventType(wire.Op)
+	if !ok {
+		return errors.WrapE(InvalidFormat, errors.Errorf("unknown op '%s'", wire.Op))
+	}
+	path := make([]any, len(wire.Path))
+	for k, step := range wire.Path {
+		switch typed := step.(type) {
+		case string:
+			path[k] = typed
+		case json.Number:
+			idx, err := strconv.Atoi(typed.String())
+			if nil != err {
+				return errors.WrapE(InvalidFormat, errors.Errorf("invalid list index '%s' in op path", typed))
+			}
+			path[k] = idx
+		default:
+			return errors.WrapE(InvalidFormat, errors.Errorf("invalid op path element '%v'", step))
+		}
+	}
+	value, err := readOpValue(wire.Value)
+	if nil != err {
+		return err
+	}
+	*op = Op{Type: typ, Path: path, Index: wire.Index, Value: value, Keys: wire.Keys}
+	return nil
+}
+
+/*
+Apply applies the change to mdl and notifies its subscribers.
+*/
+func (op Op) Apply(mdl *Model) error {
+	path := op.Path
+	var key any
+	switch op.Type {
+	case EventSet, EventInsert, EventDelete:
+		if 0 == len(path) {
+			return errors.WrapE(InvalidIndex, errors.Errorf("missing key"))
+		}
+		path, key = path[:len(path)-1], path[len(path)-1]
+	}
+
+	node := mdl
+	for _, step := range path {
+		child, err := node.childModel(step)
+		if nil != err {
+			return err
+		}
+		node = child
+	}
+
+	switch op.Type {
+	case EventSet:
+		return node.Set(key, op.Value)
+	case EventInsert:
+		return node.insert(op.Index, key, op.Value)
+	case EventDelete:
+		return node.Delete(key)
+	case EventReplace:
+		data, ok := op.Value.(*Model)
+		if !ok || data.GetType() != node.GetType() {
+			return errors.WrapE(InvalidDataSet, errors.Errorf("invalid data set for replace"))
+		}
+		return node.restore(data)
+	case EventReorder:
+		if stdModel.ModelTypeHash != node.GetType() {
+			return nil
+		}
+		return node.reorder(op.Keys)
+	}
+	return errors.WrapE(InvalidFormat, errors.Errorf("unknown op type '%d'", op.Type))
+}
+
+/*
+OpLog writes every change made to a model, or to any model nested within
+it, to an io.Writer as newline-delimited JSON ops. Each op is written with
+a single call to Write. Replay reads the log back.
+
+Ops are written while the changed model is locked, before the change is
+visible to other goroutines, so the log holds the changes in the order
+they were made. A change that cannot be written is reverted and the error
+returned by the call making it. Once a write has failed, every later change
+fails with the same error.
+*/
+type OpLog struct {
+	mdl *Model
+	seq uint64 // lock order among logs
+
+	mux    sync.Mutex
+	w      io.Writer
+	err    error
+	closed bool
+}
+
+/*
+opLogs counts the open op logs, so that changes need not look for logs when
+there are none. opLogSeq numbers op logs.
+*/
+var (
+	opLogs   atomic.Int64
+	opLogSeq atomic.Uint64
+)
+
+/*
+NewOpLog starts writing the changes made to mdl to w.
+*/
+func NewOpLog(mdl *Model, w io.Writer) *OpLog {
+	log := &OpLog{mdl: mdl, seq: opLogSeq.Add(1), w: w}
+	opLogs.Add(1)
+	mdl.obs.addLog(log)
+	return log
+}
+
+/*
+Err returns the first error encountered writing the log.
+*/
+func (log *OpLog) Err() error {
+	log.mux.Lock()
+	defer log.mux.Unlock()
+	return log.err
+}
+
+/*
+Close stops writing changes and returns the first error encountered writing
+the log. It does not close the underlying writer.
+*/
+func (log *OpLog) Close() error {
+	log.mdl.obs.removeLog(log)
+	log.mux.Lock()
+	defer log.mux.Unlock()
+	if !log.closed {
+		log.closed = true
+		opLogs.Add(-1)
+	}
+	return log.err
+}
+
+/*
+encode returns the log line for a change to mdl, which is locked by the
+caller, at path from the logged model.
+*/
+func (log *OpLog) encode(mdl *Model, evt Event, path []any) ([]byte, error) {
+	op := Op{Type: evt.Type, Path: append(append([]any{}, path...), evt.Path...), Index: evt.index}
+	switch evt.Type {
+	case EventSet, EventInsert:
+		op.Value = evt.New
+	case EventReplace:
+		op.Value = mdl.snapshotLocked()
+	case EventReorder:
+		op.Keys = mdl.keyOrderLocked()
+	}
+	// mdl is locked, and a value containing it could not be encoded anyway.
+	line, err := op.marshal([]*Model{mdl})
+	if nil != err {
+		return nil, errors.Wrap(err, "could not encode %s op at '%s'", evt.Type, Event{Path: op.Path}.PathString())
+	}
+	return append(line, '\n'), nil
+}
+
+/*
+write writes a log line. The caller must hold the log lock.
+*/
+func (log *OpLog) write(line []byte) error {
+	if nil != log.err {
+		return log.err
+	}
+	if _, err := log.w.Write(line); nil != err {
+		log.err = errors.Wrap(err, "could not write op log")
+	}
+	return log.err
+}
+
+/*
+logTarget is an op log receiving the changes made to a model, and the path
+from the logged model to it.
+*/
+type logTarget struct {
+	log  *OpLog
+	path []any
+}
+
+/*
+journal holds the op logs receiving a change, locked in order.
+*/
+type journal struct {
+	logs    []*OpLog
+	targets []logTarget
+}
+
+/*
+lockLogs locks the op logs of this model and of the models containing it.
+Every change to a logged model holds the log locks before the model lock,
+so the paths to this model cannot change until the logs are unlocked.
+*/
+func (mdl *Model) lockLogs() journal {
+	if 0 == opLogs.Load() || !mdl.obs.active() {
+		return journal{}
+	}
+	targets := mdl.logTargets(nil, nil, nil)
+	for {
+		if 0 == len(targets) {
+			return journal{}
+		}
+		jnl := journal{}
+		for _, target := range targets {
+			if !slices.Contains(jnl.logs, target.log) {
+				jnl.logs = append(jnl.logs, target.log)
+			}
+		}
+		slices.SortFunc(jnl.logs, func(a, b *OpLog) int { return cmp.Compare(a.seq, b.seq) })
+		for _, log := range jnl.logs {
+			log.mux.Lock()
+		}
+
+		// The model may have been added to another logged model before the
+		// logs were locked.
+		targets = mdl.logTargets(nil, nil, nil)
+		locked := true
+		for _, target := range targets {
+			locked = locked && slices.Contains(jnl.logs, target.log)
+		}
+		if locked {
+			jnl.targets = targets
+			return jnl
+		}
+		jnl.unlock()
+	}
+}
+
+/*
+logTargets appends the op logs of this model and of the models containing
+it to out. ancestors holds the models on the current path, guarding against
+cycles.
+*/
+func (mdl *Model) logTargets(path []any, ancestors []*Model, out []logTarget) []logTarget {
+	for _, ancestor := range ancestors {
+		if ancestor == mdl {
+			return out
+		}
+	}
+	_, logs, parents := mdl.obs.snapshot()
+	for _, log := range logs {
+		out = append(out, logTarget{log: log, path: path})
+	}
+	for _, parent := range parents {
+		for _, key := range parent.keysOf(mdl) {
+			out = parent.logTargets(append([]any{key}, path...), append(ancestors, mdl), out)
+		}
+	}
+	return out
+}
+
+/*
+write writes a change to mdl, which is locked by the caller, to the logs.
+Closed logs are skipped.
+*/
+func (jnl journal) write(mdl *Model, evt Event) error {
+	lines := make([][]byte, len(jnl.targets))
+	for k, target := range jnl.targets {
+		if target.log.closed {
+			continue
+		}
+		if nil != target.log.err {
+			return target.log.err
+		}
+		line, err := target.log.encode(mdl, evt, target.path)
+		if nil != err {
+			return err
+		}
+		lines[k] = line
+	}
+	for k, target := range jnl.targets {
+		if nil == lines[k] {
+			continue
+		}
+		if err := target.log.write(lines[k]); nil != err {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+unlock unlocks the logs.
+*/
+func (jnl journal) unlock() {
+	for k := len(jnl.logs) - 1; k >= 0; k-- {
+		jnl.logs[k].mux.Unlock()
+	}
+}
+
+/*
+revertLocked undoes the change described by evt. The caller must hold the
+model lock.
+*/
+func (mdl *Model) revertLocked(evt Event) {
+	switch evt.Type {
+	case EventSet:
+		mdl.setLocked(evt.Key, evt.Old)
+	case EventInsert:
+		mdl.deleteLocked(evt.Key)
+	case EventDelete:
+		mdl.insertLocked(evt.index, evt.Key, evt.Old)
+	case EventReplace:
+		if prev, ok := evt.prev.(*Model); ok {
+			mdl.restoreLocked(prev)
+		}
+	case EventReorder:
+		if prev, ok := evt.prev.([]string); ok {
+			mdl.reorderLocked(prev)
+		}
+	}
+}
+
+/*
+ReadOps reads all ops from a log written by OpLog.
+*/
+func ReadOps(r io.Reader) ([]Op, error) {
+	ops := []Op{}
+	dec := json.NewDecoder(r)
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); nil != err {
+			if io.EOF == err {
+				return ops, nil
+			}
+			return ops, errors.WrapE(InvalidFormat, errors.Wrap(err, "could not read op %d", len(ops)))
+		}
+		var op Op
+		if err := op.UnmarshalJSON(raw); nil != err {
+			return ops, errors.Wrap(err, "could not read op %d", len(ops))
+		}
+		ops = append(ops, op)
+	}
+}
+
+/*
+Replay reads a log written by OpLog and applies each op to mdl, which should
+hold the same data as the logged model did when logging started (usually an
+empty model of the same type). If the log cannot be read no ops are applied;
+if an op cannot be applied the ops applied before it are kept.
+*/
+func Replay(r io.Reader, mdl *Model) error {
+	ops, err := ReadOps(r)
+	if nil != err {
+		return err
+	}
+	for k, op := range ops {
+		if err := op.Apply(mdl); nil != err {
+			return errors.Wrap(err, "could not replay op %d", k)
+		}
+	}
+	return nil
+}
+
+/*
+parseEventType is the inverse of EventType.String.
+*/
+func parseEventType(name string) (EventType, bool) {
+	for _, typ := range []EventType{EventSet, EventInsert, EventDelete, EventReorder, EventReplace} {
+		if typ.String() == name {
+			return typ, true
+		}
+	}
+	return 0, false
+}
+
+/*
+writeOpValue writes the op encoding of a value. visited holds the models
+being written, to detect models that contain themselves.
+*/
+func writeOpValue(buf *bytes.Buffer, v any, visited []*Model) error {
+	mdl, ok := unwrap(v).(*Model)
+	if !ok || nil == mdl {
+		return writeJSON(buf, v)
+	}
+	for _, m := range visited {
+		if m == mdl {
+			return errors.WrapE(CircularReference, errors.Errorf("model contains itself; use a Ref"))
+		}
+	}
+	visited = append(visited, mdl)
+
+	keys, values := mdl.entries()
+	if stdModel.ModelTypeHash == mdl.GetType() {
+		buf.WriteString(`{"$hash":[`)
+	} else {
+		buf.WriteString(`{"$list":[`)
+	}
+	for k, val := range values {
+		if k > 0 {
+			buf.WriteByte(',')
+		}
+		if nil != keys {
+			key, _ := json.Marshal(keys[k])
+			buf.WriteByte('[')
+			buf.Write(key)
+			buf.WriteByte(',')
+		}
+		if err := writeOpValue(buf, val, visited); nil != err {
+			return err
+		}
+		if nil != keys {
+			buf.WriteByte(']')
+		}
+	}
+	buf.WriteByte(']')
+	if id := mdl.GetID(); nil != id {
+		buf.WriteString(`,"$id":`)
+		if err := writeJSON(buf, id); nil != err {
+			return err
+		}
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+/*
+readOpValue converts a value decoded with json.Decoder.UseNumber from its op
+encoding.
+*/
+func readOpValue(v any) (any, error) {
+	switch typed := v.(type) {
+	case json.Number:
+		if i, err := typed.Int64(); nil == err {
+			return i, nil
+		}
+		f, err := typed.Float64()
+		if nil != err {
+			return nil, errors.WrapE(InvalidFormat, err)
+		}
+		return f, nil
+
+	case []any:
+		list := make([]any, len(typed))
+		for k, val := range typed {
+			item, err := readOpValue(val)
+			if nil != err {
+				return nil, err
+			}
+			list[k] = item
+		}
+		return list, nil
+
+	case map[string]any:
+		if ref, ok := refFromMap(typed); ok {
+			id, err := readOpValue(ref.ID)
+			return Ref{ID: id}, err
+		}
+		size := len(typed)
+		id, err := readOpValue(typed["$id"])
+		if nil != err {
+			return nil, err
+		}
+		if _, ok := typed["$id"]; ok {
+			size--
+		}
+		if items, ok := typed["$list"].([]any); ok && 1 == size {
+			mdl := New(stdModel.ModelTypeList)
+			mdl.id = id
+			for _, val := range items {
+				item, err := readOpValue(val)
+				if nil != err {
+					return nil, err
+				}
+				mdl.data = append(mdl.data, &Value{item})
+				mdl.adopt(item)
+			}
+			return mdl, nil
+		}
+		if items, ok := typed["$hash"].([]any); ok && 1 == size {
+			mdl := New(stdModel.ModelTypeHash)
+			mdl.id = id
+			for _, val := range items {
+				pair, ok := val.([]any)
+				if !ok || 2 != len(pair) {
+					return nil, errors.WrapE(InvalidFormat, errors.Errorf("invalid hash entry '%v'", val))
+				}
+				key, ok := pair[0].(string)
+				if !ok {
+					return nil, errors.WrapE(InvalidFormat, errors.Errorf("invalid hash key '%v'", pair[0]))
+				}
+				item, err := readOpValue(pair[1])
+				if nil != err {
+					return nil, err
+				}
+				if _, ok := mdl.hashIdx[key]; ok {
+					return nil, errors.WrapE(InvalidFormat, errors.Errorf("duplicate hash key '%s'", key))
+				}
+				mdl.hashIdx[key] = len(mdl.data)
+				mdl.idxHash[len(mdl.data)] = key
+				mdl.data = append(mdl.data, item)
+				mdl.adopt(item)
+			}
+			return mdl, nil
+		}
+		hash := make(map[string]any, len(typed))
+		for key, val := range typed {
+			item, err := readOpValue(val)
+			if nil != err {
+				return nil, err
+			}
+			hash[key] = item
+		}
+		return hash, nil
+	}
+	return v, nil
+}
@@ -0,0 +1,157 @@
+package model_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bdlm/model"
+	stdModel "github.com/bdlm/std/v2/model"
+	stdSorter "github.com/bdlm/std/v2/sorter"
+)
+
+func TestOpLogReplay(t *testing.T) {
+	mdl := model.New(stdModel.ModelTypeHash)
+	buf := &bytes.Buffer{}
+	log := model.NewOpLog(mdl, buf)
+
+	mdl.Set("name", "app")
+	mdl.Set("zeta", 1.5)
+	db := model.New(stdModel.ModelTypeHash)
+	db.Set("port", 5432)
+	db.Set("host", "localhost")
+	mdl.Set("db", db)
+	db.Set("host", "db.internal")
+	tags := model.New(stdModel.ModelTypeList)
+	mdl.Set("tags", tags)
+	tags.Push("a")
+	tags.Push("b")
+	tags.Delete(0)
+	mdl.Delete("name")
+	mdl.Sort(stdSorter.SortByKey)
+	tags.SetData([]any{"x", true, nil})
+	if err := log.Close(); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	mdl.Set("after", "close")
+
+	replayed := model.New(stdModel.ModelTypeHash)
+	if err := model.Replay(bytes.NewReader(buf.Bytes()), replayed); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := `{"db":{"port":5432,"host":"db.internal"},"tags":["x",true,null],"zeta":1.5}`
+	if got := historyJSON(t, replayed); expected != got {
+		t.Errorf("expected %s, received %s", expected, got)
+	}
+	val, _ := replayed.Get("db")
+	if port, _ := val.Model(); nil == port {
+		t.Errorf("expected a nested model")
+	}
+}
+
+func TestOpLogFormat(t *testing.T) {
+	mdl := model.New(stdModel.ModelTypeList)
+	buf := &bytes.Buffer{}
+	model.NewOpLog(mdl, buf)
+	row := model.New(stdModel.ModelTypeHash)
+	row.Set("b", 1)
+	row.Set("a", 2)
+	mdl.Push(row)
+	row.Set("a", 3)
+
+	expected := `{"op":"insert","path":[0],"value":{"$hash":[["b",1],["a",2]]}}
+{"op":"set","path":[0,"a"],"index":1,"value":3}
+`
+	if expected != buf.String() {
+		t.Errorf("expected %s, received %s", expected, buf.String())
+	}
+}
+
+func TestReplayErrors(t *testing.T) {
+	mdl := model.New(stdModel.ModelTypeHash)
+	if err := model.Replay(strings.NewReader(`{"op":"explode","path":["a"]}`), mdl); !errors.Is(err, model.InvalidFormat) {
+		t.Errorf("expected InvalidFormat, received %v", err)
+	}
+	if err := model.Replay(strings.NewReader(`{"op":"set","path":["a"],"value":1}`+"\n"+`{"op":"set"`), mdl); !errors.Is(err, model.InvalidFormat) {
+		t.Errorf("expected InvalidFormat, received %v", err)
+	}
+	if mdl.Has("a") {
+		t.Errorf("expected no ops to be applied")
+	}
+	if err := model.Replay(strings.NewReader(`{"op":"delete","path":["missing"]}`), mdl); !errors.Is(err, model.InvalidIndex) {
+		t.Errorf("expected InvalidIndex, received %v", err)
+	}
+}
+
+var errDiskFull = errors.New("disk full")
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errDiskFull
+}
+
+func TestOpLogWriteError(t *testing.T) {
+	mdl := model.New(stdModel.ModelTypeHash)
+	mdl.Set("a", 1)
+	log := model.NewOpLog(mdl, failingWriter{})
+	if err := mdl.Set("a", 2); !errors.Is(err, errDiskFull) {
+		t.Errorf("expected write error, received %v", err)
+	}
+	if err := mdl.Delete("a"); !errors.Is(err, errDiskFull) {
+		t.Errorf("expected write error, received %v", err)
+	}
+	if val, _ := mdl.Get("a"); 1 != val.Value() {
+		t.Errorf("expected the changes to be reverted, received %v", val.Value())
+	}
+	if err := log.Close(); !errors.Is(err, errDiskFull) {
+		t.Errorf("expected write error, received %v", err)
+	}
+	if err := mdl.Set("a", 3); nil != err {
+		t.Errorf("unexpected error after Close: %v", err)
+	}
+}
+
+func TestOpLogConcurrent(t *testing.T) {
+	mdl := model.New(stdModel.ModelTypeHash)
+	node := model.New(stdModel.ModelTypeList)
+	mdl.Set("node", node)
+	buf := &bytes.Buffer{}
+	log := model.NewOpLog(mdl, buf)
+
+	// Hold back the notification of the first push until a second push has
+	// been made.
+	held, release := make(chan struct{}), make(chan struct{})
+	first := true
+	node.Subscribe(func(model.Event) {
+		if first {
+			first = false
+			close(held)
+			<-release
+		}
+	})
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		node.Push("a")
+	}()
+	<-held
+	node.Push("b")
+	close(release)
+	wg.Wait()
+	if err := log.Close(); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	replayed := model.New(stdModel.ModelTypeHash)
+	replayed.Set("node", model.New(stdModel.ModelTypeList))
+	if err := model.Replay(bytes.NewReader(buf.Bytes()), replayed); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !replayed.Equal(mdl) {
+		t.Errorf("expected %s, received %s", historyJSON(t, mdl), historyJSON(t, replayed))
+	}
+}
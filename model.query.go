@@ -0,0 +1,819 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bdlm/cast/v2"
+	stdModel "github.com/bdlm/std/v2/model"
+)
+
+/*
+Match is a value selected by a query, along with its normalized path, e.g.
+$['items'][0]['name'].
+*/
+type Match struct {
+	Path  string
+	Value *Value
+}
+
+/*
+JSONPath is a compiled JSONPath query as defined by RFC 9535. A JSONPath is
+safe for concurrent use.
+*/
+type JSONPath struct {
+	src   string
+	query *jpQuery
+}
+
+/*
+CompileJSONPath parses a JSONPath query.
+
+Queries support member names, wildcards, indexes, slices, recursive descent
+and filter expressions using the length(), count(), match(), search() and
+value() functions, e.g. "$.items[?@.price < 10].name". As an extension,
+filter comparisons between a number and a numeric string, or a time and an
+RFC 3339 string, compare the cast values.
+*/
+func CompileJSONPath(query string) (*JSONPath, error) {
+	p := &jpParser{src: query}
+	parsed, err := p.parseQuery()
+	if nil != err {
+		return nil, err
+	}
+	return &JSONPath{src: query, query: parsed}, nil
+}
+
+/*
+Query selects the values in mdl matching a JSONPath query. See
+CompileJSONPath.
+*/
+func Query(mdl *Model, query string) ([]Match, error) {
+	path, err := CompileJSONPath(query)
+	if nil != err {
+		return nil, err
+	}
+	return path.Select(mdl), nil
+}
+
+/*
+Select returns the values in mdl matching the query, in document order.
+*/
+func (path *JSONPath) Select(mdl *Model) []Match {
+	nodes := path.query.eval(mdl, mdl, true)
+	matches := make([]Match, len(nodes))
+	for k, node := range nodes {
+		matches[k] = Match{Path: node.path, Value: &Value{node.value}}
+	}
+	return matches
+}
+
+/*
+String returns the source of the query.
+*/
+func (path *JSONPath) String() string {
+	return path.src
+}
+
+/*
+jpNode is a value and its normalized path.
+*/
+type jpNode struct {
+	path  string
+	value any
+}
+
+/*
+jpQuery is a parsed absolute ($) or relative (@) query.
+*/
+type jpQuery struct {
+	relative bool
+	segments []jpSegment
+}
+
+/*
+jpSegment is a child or descendant segment.
+*/
+type jpSegment struct {
+	descendant bool
+	selectors  []jpSelector
+}
+
+/*
+jpSelectorKind identifies the type of a selector.
+*/
+type jpSelectorKind int
+
+const (
+	jpName jpSelectorKind = iota
+	jpWildcard
+	jpIndex
+	jpSlice
+	jpFilter
+)
+
+/*
+jpSelector is a single selector of a segment.
+*/
+type jpSelector struct {
+	kind   jpSelectorKind
+	name   string
+	index  int
+	start  *int
+	end    *int
+	step   *int
+	filter jpLogical
+}
+
+/*
+singular reports whether the query can select at most one node.
+*/
+func (query *jpQuery) singular() bool {
+	for _, seg := range query.segments {
+		if seg.descendant || 1 != len(seg.selectors) {
+			return false
+		}
+		if kind := seg.selectors[0].kind; jpName != kind && jpIndex != kind {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+eval returns the nodes selected by the query. Paths are only tracked when
+withPaths is set.
+*/
+func (query *jpQuery) eval(root, cur any, withPaths bool) []jpNode {
+	start := jpNode{path: "$", value: root}
+	if query.relative {
+		start = jpNode{path: "@", value: cur}
+	}
+	nodes := []jpNode{start}
+	for _, seg := range query.segments {
+		next := []jpNode{}
+		for _, node := range nodes {
+			if seg.descendant {
+				next = seg.descend(root, node, withPaths, next, nil)
+			} else {
+				next = seg.apply(root, node, withPaths, next)
+			}
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+/*
+apply appends the results of each selector applied to node.
+*/
+func (seg jpSegment) apply(root any, node jpNode, withPaths bool, out []jpNode) []jpNode {
+	for _, sel := range seg.selectors {
+		out = sel.apply(root, node, withPaths, out)
+	}
+	return out
+}
+
+/*
+descend applies the segment to node and each of its descendants, in
+document order. visited holds the models on the path to node; a model
+containing itself is not walked again, but a model reached by several paths
+is walked once for each.
+*/
+func (seg jpSegment) descend(root any, node jpNode, withPaths bool, out []jpNode, visited []*Model) []jpNode {
+	if mdl, ok := node.value.(*Model); ok {
+		for _, m := range visited {
+			if m == mdl {
+				return out
+			}
+		}
+		visited = append(visited, mdl)
+	}
+	out = seg.apply(root, node, withPaths, out)
+	keys, values, kind := jpChildren(node.value)
+	for k, val := range values {
+		child := jpNode{value: val}
+		if withPaths {
+			child.path = jpChildPath(node.path, kind, keys, k)
+		}
+		out = seg.descend(root, child, withPaths, out, visited)
+	}
+	return out
+}
+
+/*
+apply appends the nodes selected from node.
+*/
+func (sel jpSelector) apply(root any, node jpNode, withPaths bool, out []jpNode) []jpNode {
+	switch sel.kind {
+	case jpName:
+		if val, ok := jpMember(node.value, sel.name); ok {
+			child := jpNode{value: val}
+			if withPaths {
+				child.path = node.path + jpNormalName(sel.name)
+			}
+			out = append(out, child)
+		}
+		return out
+
+	case jpIndex:
+		if val, idx, ok := jpElement(node.value, sel.index); ok {
+			child := jpNode{value: val}
+			if withPaths {
+				child.path = node.path + "[" + strconv.Itoa(idx) + "]"
+			}
+			out = append(out, child)
+		}
+		return out
+	}
+
+	keys, values, kind := jpChildren(node.value)
+	emit := func(k int) {
+		child := jpNode{value: values[k]}
+		if withPaths {
+			child.path = jpChildPath(node.path, kind, keys, k)
+		}
+		out = append(out, child)
+	}
+
+	switch sel.kind {
+	case jpWildcard:
+		for k := range values {
+			emit(k)
+		}
+
+	case jpSlice:
+		if stdModel.ModelTypeList != kind {
+			break
+		}
+		lower, upper, step := sel.bounds(len(values))
+		if step > 0 {
+			for k := lower; k < upper; k += step {
+				emit(k)
+			}
+		} else if step < 0 {
+			for k := upper; lower < k; k += step {
+				emit(k)
+			}
+		}
+
+	case jpFilter:
+		for k, val := range values {
+			if sel.filter.test(root, val) {
+				emit(k)
+			}
+		}
+	}
+	return out
+}
+
+/*
+bounds computes the normalized bounds of a slice selector for a list of
+length size, following RFC 9535 section 2.3.4.2.2.
+*/
+func (sel jpSelector) bounds(size int) (lower, upper, step int) {
+	step = 1
+	if nil != sel.step {
+		step = *sel.step
+	}
+	if 0 == step {
+		return 0, 0, 0
+	}
+	normalize := func(idx int) int {
+		if idx < 0 {
+			return size + idx
+		}
+		return idx
+	}
+	clamp := func(idx, min, max int) int {
+		if idx < min {
+			return min
+		}
+		if idx > max {
+			return max
+		}
+		return idx
+	}
+
+	var start, end int
+	if step > 0 {
+		start, end = 0, size
+	} else {
+		start, end = size-1, -size-1
+	}
+	if nil != sel.start {
+		start = normalize(*sel.start)
+	}
+	if nil != sel.end {
+		end = normalize(*sel.end)
+	}
+	if step > 0 {
+		return clamp(start, 0, size), clamp(end, 0, size), step
+	}
+	return clamp(end, -1, size-1), clamp(start, -1, size-1), step
+}
+
+/*
+jpLogical is a filter expression producing a boolean.
+*/
+type jpLogical interface {
+	test(root, cur any) bool
+}
+
+/*
+jpOr is a logical-or expression.
+*/
+type jpOr []jpLogical
+
+func (or jpOr) test(root, cur any) bool {
+	for _, expr := range or {
+		if expr.test(root, cur) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+jpAnd is a logical-and expression.
+*/
+type jpAnd []jpLogical
+
+func (and jpAnd) test(root, cur any) bool {
+	for _, expr := range and {
+		if !expr.test(root, cur) {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+jpNot is a logical-not expression.
+*/
+type jpNot struct {
+	expr jpLogical
+}
+
+func (not jpNot) test(root, cur any) bool {
+	return !not.expr.test(root, cur)
+}
+
+/*
+jpTest is an existence test of a query or the result of a logical function.
+*/
+type jpTest struct {
+	operand jpOperand
+}
+
+func (tst jpTest) test(root, cur any) bool {
+	return tst.operand.test(root, cur)
+}
+
+/*
+jpCompare is a comparison expression.
+*/
+type jpCompare struct {
+	op    string
+	left  jpOperand
+	right jpOperand
+}
+
+func (cmp jpCompare) test(root, cur any) bool {
+	a, aOK := cmp.left.value(root, cur)
+	b, bOK := cmp.right.value(root, cur)
+	switch cmp.op {
+	case "==":
+		return jpEqual(a, aOK, b, bOK)
+	case "!=":
+		return !jpEqual(a, aOK, b, bOK)
+	case "<":
+		return aOK && bOK && jpLess(a, b)
+	case "<=":
+		return aOK && bOK && (jpLess(a, b) || jpEqual(a, aOK, b, bOK))
+	case ">":
+		return aOK && bOK && jpLess(b, a)
+	case ">=":
+		return aOK && bOK && (jpLess(b, a) || jpEqual(a, aOK, b, bOK))
+	}
+	return false
+}
+
+/*
+jpOperand is a literal, filter query or function call used in a filter
+expression.
+*/
+type jpOperand struct {
+	literal   any
+	isLiteral bool
+	query     *jpQuery
+	fn        *jpFunc
+}
+
+/*
+comparable reports whether the operand produces a single value.
+*/
+func (op jpOperand) comparable() bool {
+	switch {
+	case op.isLiteral:
+		return true
+	case nil != op.query:
+		return op.query.singular()
+	case nil != op.fn:
+		return !op.fn.logical()
+	}
+	return false
+}
+
+/*
+testable reports whether the operand can be used as a test expression.
+*/
+func (op jpOperand) testable() bool {
+	return nil != op.query || (nil != op.fn && op.fn.logical())
+}
+
+/*
+value returns the value of the operand, or false if it has none.
+*/
+func (op jpOperand) value(root, cur any) (any, bool) {
+	switch {
+	case op.isLiteral:
+		return op.literal, true
+	case nil != op.query:
+		nodes := op.query.eval(root, cur, false)
+		if 1 != len(nodes) {
+			return nil, false
+		}
+		return nodes[0].value, true
+	case nil != op.fn:
+		return op.fn.value(root, cur)
+	}
+	return nil, false
+}
+
+/*
+test returns the result of the operand used as a test expression.
+*/
+func (op jpOperand) test(root, cur any) bool {
+	if nil != op.query {
+		return 0 < len(op.query.eval(root, cur, false))
+	}
+	return op.fn.test(root, cur)
+}
+
+/*
+jpFunc is a function call in a filter expression.
+*/
+type jpFunc struct {
+	name string
+	args []jpOperand
+	re   *regexp.Regexp // precompiled literal pattern
+}
+
+/*
+logical reports whether the function returns a logical result.
+*/
+func (fn *jpFunc) logical() bool {
+	return "match" == fn.name || "search" == fn.name
+}
+
+/*
+value evaluates the length(), count() and value() functions.
+*/
+func (fn *jpFunc) value(root, cur any) (any, bool) {
+	switch fn.name {
+	case "length":
+		val, ok := fn.args[0].value(root, cur)
+		if !ok {
+			return nil, false
+		}
+		if str, ok := val.(string); ok {
+			return int64(utf8.RuneCountInString(str)), true
+		}
+		if _, values, kind := jpChildren(val); jpScalar != kind {
+			return int64(len(values)), true
+		}
+		return nil, false
+
+	case "count":
+		return int64(len(fn.args[0].query.eval(root, cur, false))), true
+
+	case "value":
+		nodes := fn.args[0].query.eval(root, cur, false)
+		if 1 != len(nodes) {
+			return nil, false
+		}
+		return nodes[0].value, true
+	}
+	return nil, false
+}
+
+/*
+test evaluates the match() and search() functions.
+*/
+func (fn *jpFunc) test(root, cur any) bool {
+	val, ok := fn.args[0].value(root, cur)
+	str, isStr := val.(string)
+	if !ok || !isStr {
+		return false
+	}
+	re := fn.re
+	if nil == re {
+		pattern, ok := fn.args[1].value(root, cur)
+		patternStr, isStr := pattern.(string)
+		if !ok || !isStr {
+			return false
+		}
+		compiled := compileIRegexp(patternStr, "match" == fn.name)
+		if nil == compiled {
+			return false
+		}
+		re = compiled
+	}
+	return re.MatchString(str)
+}
+
+/*
+jpScalar is the kind reported by jpChildren for values that are neither
+hashes nor lists.
+*/
+const jpScalar stdModel.ModelType = -1
+
+/*
+jpChildren returns the members of a hash value or the elements of a list
+value.
+*/
+func jpChildren(v any) (keys []string, values []any, kind stdModel.ModelType) {
+	switch typed := v.(type) {
+	case *Model:
+		keys, values = typed.entries()
+		return keys, values, typed.GetType()
+	case map[string]any:
+		keys = make([]string, 0, len(typed))
+		for key := range typed {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		values = make([]any, len(keys))
+		for k, key := range keys {
+			values[k] = unwrap(typed[key])
+		}
+		return keys, values, stdModel.ModelTypeHash
+	case []any:
+		values = make([]any, len(typed))
+		for k, val := range typed {
+			values[k] = unwrap(val)
+		}
+		return nil, values, stdModel.ModelTypeList
+	}
+	return nil, nil, jpScalar
+}
+
+/*
+jpMember returns the member name of a hash value.
+*/
+func jpMember(v any, name string) (any, bool) {
+	switch typed := v.(type) {
+	case *Model:
+		if stdModel.ModelTypeHash != typed.GetType() {
+			return nil, false
+		}
+		typed.mux.Lock()
+		defer typed.mux.Unlock()
+		idx, ok := typed.hashIdx[name]
+		if !ok {
+			return nil, false
+		}
+		return unwrap(typed.data[idx]), true
+	case map[string]any:
+		val, ok := typed[name]
+		return unwrap(val), ok
+	}
+	return nil, false
+}
+
+/*
+jpElement returns the element of a list value at idx, counting from the end
+if idx is negative. It also returns the normalized index.
+*/
+func jpElement(v any, idx int) (any, int, bool) {
+	var values []any
+	switch typed := v.(type) {
+	case *Model:
+		if stdModel.ModelTypeList != typed.GetType() {
+			return nil, 0, false
+		}
+		typed.mux.Lock()
+		defer typed.mux.Unlock()
+		values = typed.data
+	case []any:
+		values = typed
+	default:
+		return nil, 0, false
+	}
+	if idx < 0 {
+		idx += len(values)
+	}
+	if idx < 0 || idx >= len(values) {
+		return nil, 0, false
+	}
+	return unwrap(values[idx]), idx, true
+}
+
+/*
+jpChildPath returns the normalized path of child k of the value at path.
+*/
+func jpChildPath(path string, kind stdModel.ModelType, keys []string, k int) string {
+	if stdModel.ModelTypeHash == kind {
+		return path + jpNormalName(keys[k])
+	}
+	return path + "[" + strconv.Itoa(k) + "]"
+}
+
+/*
+jpNormalName formats a member name as a normalized path element.
+*/
+func jpNormalName(name string) string {
+	var buf strings.Builder
+	buf.WriteString("['")
+	for _, r := range name {
+		switch r {
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\'':
+			buf.WriteString(`\'`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(&buf, `\u%04x`, r)
+				continue
+			}
+			buf.WriteRune(r)
+		}
+	}
+	buf.WriteString("']")
+	return buf.String()
+}
+
+/*
+jpNumber returns the float64 value of numeric types.
+*/
+func jpNumber(v any) (float64, bool) {
+	switch v.(type) {
+	case int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64,
+		float32, float64, json.Number:
+		num, err := cast.ToE[float64](v)
+		return num, nil == err
+	}
+	return 0, false
+}
+
+/*
+jpCast converts a and b to comparable types. Numbers are compared with
+numeric strings, and times with RFC 3339 strings.
+*/
+func jpCast(a, b any) (any, any) {
+	if num, ok := jpNumber(a); ok {
+		a = num
+	}
+	if num, ok := jpNumber(b); ok {
+		b = num
+	}
+	switch typed := a.(type) {
+	case float64:
+		if str, ok := b.(string); ok {
+			if num, err := strconv.ParseFloat(strings.TrimSpace(str), 64); nil == err {
+				b = num
+			}
+		}
+	case string:
+		switch b.(type) {
+		case float64:
+			if num, err := strconv.ParseFloat(strings.TrimSpace(typed), 64); nil == err {
+				a = num
+			}
+		case time.Time:
+			if tm, err := time.Parse(time.RFC3339Nano, typed); nil == err {
+				a = tm
+			}
+		}
+	case time.Time:
+		if str, ok := b.(string); ok {
+			if tm, err := time.Parse(time.RFC3339Nano, str); nil == err {
+				b = tm
+			}
+		}
+	}
+	return a, b
+}
+
+/*
+jpEqual reports whether two comparison operands are equal. Two missing
+values are equal.
+*/
+func jpEqual(a any, aOK bool, b any, bOK bool) bool {
+	if !aOK || !bOK {
+		return !aOK && !bOK
+	}
+	return jpDeepEqual(a, b)
+}
+
+/*
+jpDeepEqual compares two values, descending into models.
+*/
+func jpDeepEqual(a, b any) bool {
+	if x, ok := a.(string); ok {
+		if y, ok := b.(string); ok {
+			return x == y
+		}
+	}
+	if x, ok := jpNumber(a); ok {
+		if y, ok := jpNumber(b); ok {
+			return x == y
+		}
+	}
+	a, b = jpCast(a, b)
+	switch typed := a.(type) {
+	case nil:
+		return nil == b
+	case float64, string, bool:
+		return a == b
+	case time.Time:
+		tm, ok := b.(time.Time)
+		return ok && typed.Equal(tm)
+	case []byte:
+		other, ok := b.([]byte)
+		return ok && bytes.Equal(typed, other)
+	}
+
+	aKeys, aValues, aKind := jpChildren(a)
+	bKeys, bValues, bKind := jpChildren(b)
+	if jpScalar == aKind || jpScalar == bKind {
+		return reflect.DeepEqual(a, b)
+	}
+	if aKind != bKind || len(aValues) != len(bValues) {
+		return false
+	}
+	if stdModel.ModelTypeList == aKind {
+		for k := range aValues {
+			if !jpDeepEqual(aValues[k], bValues[k]) {
+				return false
+			}
+		}
+		return true
+	}
+	members := make(map[string]any, len(bKeys))
+	for k, key := range bKeys {
+		members[key] = bValues[k]
+	}
+	for k, key := range aKeys {
+		val, ok := members[key]
+		if !ok || !jpDeepEqual(aValues[k], val) {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+jpLess reports whether a is less than b. Only numbers, strings and times are
+ordered.
+*/
+func jpLess(a, b any) bool {
+	if x, ok := jpNumber(a); ok {
+		if y, ok := jpNumber(b); ok {
+			return x < y
+		}
+	}
+	a, b = jpCast(a, b)
+	switch typed := a.(type) {
+	case float64:
+		other, ok := b.(float64)
+		return ok && typed < other
+	case string:
+		other, ok := b.(string)
+		return ok && typed < other
+	case time.Time:
+		other, ok := b.(time.Time)
+		return ok && typed.Before(other)
+	}
+	return false
+}
@@ -0,0 +1,644 @@
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/bdlm/errors/v2"
+)
+
+/*
+jpParser parses JSONPath queries as defined by RFC 9535.
+*/
+type jpParser struct {
+	src string
+	pos int
+}
+
+/*
+errorf returns an InvalidQuery error describing a parse failure at the
+current position.
+*/
+func (p *jpParser) errorf(format string, args ...any) error {
+	return errors.WrapE(InvalidQuery, errors.Errorf("%s at offset %d in '%s'", fmt.Sprintf(format, args...), p.pos, p.src))
+}
+
+/*
+eof reports whether the whole query has been consumed.
+*/
+func (p *jpParser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+/*
+peek returns the next byte of the query, or 0 at the end.
+*/
+func (p *jpParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+/*
+consume advances past str if the query continues with it.
+*/
+func (p *jpParser) consume(str string) bool {
+	if strings.HasPrefix(p.src[p.pos:], str) {
+		p.pos += len(str)
+		return true
+	}
+	return false
+}
+
+/*
+skipSpace advances past blank space.
+*/
+func (p *jpParser) skipSpace() {
+	for !p.eof() {
+		switch p.src[p.pos] {
+		case ' ', '\t', '\n', '\r':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+/*
+parseQuery parses a complete query starting with the root identifier.
+*/
+func (p *jpParser) parseQuery() (*jpQuery, error) {
+	if !p.consume("$") {
+		return nil, p.errorf("query must begin with '$'")
+	}
+	segments, err := p.parseSegments()
+	if nil != err {
+		return nil, err
+	}
+	if !p.eof() {
+		return nil, p.errorf("unexpected '%c'", p.peek())
+	}
+	return &jpQuery{segments: segments}, nil
+}
+
+/*
+parseSegments parses the child and descendant segments following an
+identifier.
+*/
+func (p *jpParser) parseSegments() ([]jpSegment, error) {
+	segments := []jpSegment{}
+	for {
+		start := p.pos
+		p.skipSpace()
+
+		var seg jpSegment
+		var err error
+		switch {
+		case p.consume(".."):
+			seg, err = p.parseSegmentBody(true)
+		case p.consume("."):
+			seg, err = p.parseSegmentBody(false)
+		case '[' == p.peek():
+			seg.selectors, err = p.parseBracketed()
+		default:
+			p.pos = start
+			return segments, nil
+		}
+		if nil != err {
+			return nil, err
+		}
+		segments = append(segments, seg)
+	}
+}
+
+/*
+parseSegmentBody parses what follows "." or "..": a wildcard, a member name
+or, for descendant segments, a bracketed selection.
+*/
+func (p *jpParser) parseSegmentBody(descendant bool) (jpSegment, error) {
+	seg := jpSegment{descendant: descendant}
+	switch {
+	case p.consume("*"):
+		seg.selectors = []jpSelector{{kind: jpWildcard}}
+		return seg, nil
+	case descendant && '[' == p.peek():
+		selectors, err := p.parseBracketed()
+		seg.selectors = selectors
+		return seg, err
+	}
+	name := p.parseName()
+	if "" == name {
+		return seg, p.errorf("expected a member name")
+	}
+	seg.selectors = []jpSelector{{kind: jpName, name: name}}
+	return seg, nil
+}
+
+/*
+parseName parses a member name shorthand, returning an empty string if none
+is present.
+*/
+func (p *jpParser) parseName() string {
+	start := p.pos
+	for !p.eof() {
+		r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+		isName := '_' == r || r >= 0x80 || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z')
+		if !isName && (p.pos == start || r < '0' || r > '9') {
+			break
+		}
+		p.pos += size
+	}
+	return p.src[start:p.pos]
+}
+
+/*
+parseBracketed parses a bracketed, comma-separated list of selectors.
+*/
+func (p *jpParser) parseBracketed() ([]jpSelector, error) {
+	if !p.consume("[") {
+		return nil, p.errorf("expected '['")
+	}
+	selectors := []jpSelector{}
+	for {
+		p.skipSpace()
+		sel, err := p.parseSelector()
+		if nil != err {
+			return nil, err
+		}
+		selectors = append(selectors, sel)
+		p.skipSpace()
+		if p.consume("]") {
+			return selectors, nil
+		}
+		if !p.consume(",") {
+			return nil, p.errorf("expected ',' or ']'")
+		}
+	}
+}
+
+/*
+parseSelector parses a single selector inside brackets.
+*/
+func (p *jpParser) parseSelector() (jpSelector, error) {
+	switch p.peek() {
+	case '\'', '"':
+		name, err := p.parseString()
+		return jpSelector{kind: jpName, name: name}, err
+	case '*':
+		p.pos++
+		return jpSelector{kind: jpWildcard}, nil
+	case '?':
+		p.pos++
+		p.skipSpace()
+		filter, err := p.parseOr()
+		return jpSelector{kind: jpFilter, filter: filter}, err
+	}
+
+	sel := jpSelector{kind: jpIndex}
+	start, hasStart, err := p.parseInt()
+	if nil != err {
+		return sel, err
+	}
+	p.skipSpace()
+	if !p.consume(":") {
+		if !hasStart {
+			return sel, p.errorf("expected a selector")
+		}
+		sel.index = start
+		return sel, nil
+	}
+
+	sel.kind = jpSlice
+	if hasStart {
+		sel.start = &start
+	}
+	p.skipSpace()
+	end, hasEnd, err := p.parseInt()
+	if nil != err {
+		return sel, err
+	}
+	if hasEnd {
+		sel.end = &end
+	}
+	p.skipSpace()
+	if p.consume(":") {
+		p.skipSpace()
+		step, hasStep, err := p.parseInt()
+		if nil != err {
+			return sel, err
+		}
+		if hasStep {
+			sel.step = &step
+		}
+	}
+	return sel, nil
+}
+
+/*
+parseInt parses an optional integer. Leading zeros and "-0" are rejected.
+*/
+func (p *jpParser) parseInt() (int, bool, error) {
+	start := p.pos
+	p.consume("-")
+	digits := p.pos
+	for !p.eof() && '0' <= p.peek() && p.peek() <= '9' {
+		p.pos++
+	}
+	if digits == p.pos {
+		if start != digits {
+			return 0, false, p.errorf("expected digits")
+		}
+		return 0, false, nil
+	}
+	str := p.src[start:p.pos]
+	if (p.pos-digits > 1 && '0' == p.src[digits]) || "-0" == str {
+		return 0, false, p.errorf("invalid integer '%s'", str)
+	}
+	val, err := strconv.Atoi(str)
+	if nil != err {
+		return 0, false, p.errorf("invalid integer '%s'", str)
+	}
+	return val, true, nil
+}
+
+/*
+parseString parses a single or double quoted string literal.
+*/
+func (p *jpParser) parseString() (string, error) {
+	quote := p.peek()
+	p.pos++
+	var buf strings.Builder
+	for {
+		if p.eof() {
+			return "", p.errorf("unterminated string")
+		}
+		c := p.src[p.pos]
+		switch {
+		case quote == c:
+			p.pos++
+			return buf.String(), nil
+		case c < 0x20:
+			return "", p.errorf("control character in string")
+		case '\\' != c:
+			buf.WriteByte(c)
+			p.pos++
+			continue
+		}
+
+		p.pos++
+		esc := p.peek()
+		p.pos++
+		switch esc {
+		case 'b':
+			buf.WriteByte('\b')
+		case 'f':
+			buf.WriteByte('\f')
+		case 'n':
+			buf.WriteByte('\n')
+		case 'r':
+			buf.WriteByte('\r')
+		case 't':
+			buf.WriteByte('\t')
+		case '/', '\\':
+			buf.WriteByte(esc)
+		case '\'', '"':
+			if esc != quote {
+				return "", p.errorf("invalid escape '\\%c'", esc)
+			}
+			buf.WriteByte(esc)
+		case 'u':
+			r, err := p.parseHex()
+			if nil != err {
+				return "", err
+			}
+			if utf16.IsSurrogate(r) {
+				if !p.consume(`\u`) {
+					return "", p.errorf("unpaired surrogate")
+				}
+				low, err := p.parseHex()
+				if nil != err {
+					return "", err
+				}
+				if r = utf16.DecodeRune(r, low); utf8.RuneError == r {
+					return "", p.errorf("invalid surrogate pair")
+				}
+			}
+			buf.WriteRune(r)
+		default:
+			return "", p.errorf("invalid escape '\\%c'", esc)
+		}
+	}
+}
+
+/*
+parseHex parses the four hexadecimal digits of a \u escape.
+*/
+func (p *jpParser) parseHex() (rune, error) {
+	if p.pos+4 > len(p.src) {
+		return 0, p.errorf("invalid unicode escape")
+	}
+	val, err := strconv.ParseUint(p.src[p.pos:p.pos+4], 16, 32)
+	if nil != err {
+		return 0, p.errorf("invalid unicode escape")
+	}
+	p.pos += 4
+	return rune(val), nil
+}
+
+/*
+parseOr parses a logical-or expression.
+*/
+func (p *jpParser) parseOr() (jpLogical, error) {
+	expr, err := p.parseAnd()
+	if nil != err {
+		return nil, err
+	}
+	or := jpOr{expr}
+	for {
+		p.skipSpace()
+		if !p.consume("||") {
+			break
+		}
+		p.skipSpace()
+		if expr, err = p.parseAnd(); nil != err {
+			return nil, err
+		}
+		or = append(or, expr)
+	}
+	if 1 == len(or) {
+		return or[0], nil
+	}
+	return or, nil
+}
+
+/*
+parseAnd parses a logical-and expression.
+*/
+func (p *jpParser) parseAnd() (jpLogical, error) {
+	expr, err := p.parseBasic()
+	if nil != err {
+		return nil, err
+	}
+	and := jpAnd{expr}
+	for {
+		start := p.pos
+		p.skipSpace()
+		if !p.consume("&&") {
+			p.pos = start
+			break
+		}
+		p.skipSpace()
+		if expr, err = p.parseBasic(); nil != err {
+			return nil, err
+		}
+		and = append(and, expr)
+	}
+	if 1 == len(and) {
+		return and[0], nil
+	}
+	return and, nil
+}
+
+/*
+parseBasic parses a parenthesized, negated, comparison or test expression.
+*/
+func (p *jpParser) parseBasic() (jpLogical, error) {
+	if p.consume("!") {
+		p.skipSpace()
+		paren := '(' == p.peek()
+		expr, err := p.parseBasic()
+		if nil != err {
+			return nil, err
+		}
+		if _, ok := expr.(jpCompare); ok && !paren {
+			return nil, p.errorf("comparisons cannot be negated without parentheses")
+		}
+		return jpNot{expr}, nil
+	}
+	if p.consume("(") {
+		p.skipSpace()
+		expr, err := p.parseOr()
+		if nil != err {
+			return nil, err
+		}
+		p.skipSpace()
+		if !p.consume(")") {
+			return nil, p.errorf("expected ')'")
+		}
+		return expr, nil
+	}
+
+	left, err := p.parseOperand()
+	if nil != err {
+		return nil, err
+	}
+	start := p.pos
+	p.skipSpace()
+	op := ""
+	for _, candidate := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if p.consume(candidate) {
+			op = candidate
+			break
+		}
+	}
+	if "" == op {
+		p.pos = start
+		if !left.testable() {
+			return nil, p.errorf("expression is not a test or comparison")
+		}
+		return jpTest{left}, nil
+	}
+
+	p.skipSpace()
+	right, err := p.parseOperand()
+	if nil != err {
+		return nil, err
+	}
+	if !left.comparable() || !right.comparable() {
+		return nil, p.errorf("comparison operands must be literals, singular queries or value functions")
+	}
+	return jpCompare{op: op, left: left, right: right}, nil
+}
+
+/*
+parseOperand parses a literal, a filter query or a function call.
+*/
+func (p *jpParser) parseOperand() (jpOperand, error) {
+	switch c := p.peek(); {
+	case '@' == c || '$' == c:
+		p.pos++
+		segments, err := p.parseSegments()
+		if nil != err {
+			return jpOperand{}, err
+		}
+		return jpOperand{query: &jpQuery{relative: '@' == c, segments: segments}}, nil
+
+	case '\'' == c || '"' == c:
+		str, err := p.parseString()
+		return jpOperand{literal: str, isLiteral: true}, err
+
+	case '-' == c || ('0' <= c && c <= '9'):
+		num, err := p.parseNumber()
+		return jpOperand{literal: num, isLiteral: true}, err
+	}
+
+	for lit, val := range map[string]any{"true": true, "false": false, "null": nil} {
+		if strings.HasPrefix(p.src[p.pos:], lit) && !jpIsNameChar(p.src, p.pos+len(lit)) {
+			p.pos += len(lit)
+			return jpOperand{literal: val, isLiteral: true}, nil
+		}
+	}
+
+	return p.parseFunction()
+}
+
+/*
+parseNumber parses a number literal as an int64 or float64.
+*/
+func (p *jpParser) parseNumber() (any, error) {
+	start := p.pos
+	p.consume("-")
+	digits := p.pos
+	for !p.eof() && '0' <= p.peek() && p.peek() <= '9' {
+		p.pos++
+	}
+	if digits == p.pos || (p.pos-digits > 1 && '0' == p.src[digits]) {
+		return nil, p.errorf("invalid number")
+	}
+	isInt := true
+	if p.consume(".") {
+		isInt = false
+		frac := p.pos
+		for !p.eof() && '0' <= p.peek() && p.peek() <= '9' {
+			p.pos++
+		}
+		if frac == p.pos {
+			return nil, p.errorf("invalid number")
+		}
+	}
+	if 'e' == p.peek() || 'E' == p.peek() {
+		isInt = false
+		p.pos++
+		if '+' == p.peek() || '-' == p.peek() {
+			p.pos++
+		}
+		exp := p.pos
+		for !p.eof() && '0' <= p.peek() && p.peek() <= '9' {
+			p.pos++
+		}
+		if exp == p.pos {
+			return nil, p.errorf("invalid number")
+		}
+	}
+	str := p.src[start:p.pos]
+	if isInt {
+		if val, err := strconv.ParseInt(str, 10, 64); nil == err {
+			return val, nil
+		}
+	}
+	val, err := strconv.ParseFloat(str, 64)
+	if nil != err {
+		return nil, p.errorf("invalid number '%s'", str)
+	}
+	return val, nil
+}
+
+/*
+parseFunction parses a function call and checks its arguments.
+*/
+func (p *jpParser) parseFunction() (jpOperand, error) {
+	start := p.pos
+	for !p.eof() {
+		c := p.peek()
+		if ('a' <= c && c <= 'z') || (p.pos > start && ('_' == c || ('0' <= c && c <= '9'))) {
+			p.pos++
+			continue
+		}
+		break
+	}
+	name := p.src[start:p.pos]
+	if "" == name || !p.consume("(") {
+		p.pos = start
+		return jpOperand{}, p.errorf("expected a literal, query or function")
+	}
+	fn := &jpFunc{name: name}
+
+	p.skipSpace()
+	for !p.consume(")") {
+		if 0 < len(fn.args) {
+			if !p.consume(",") {
+				return jpOperand{}, p.errorf("expected ',' or ')'")
+			}
+			p.skipSpace()
+		}
+		arg, err := p.parseOperand()
+		if nil != err {
+			return jpOperand{}, err
+		}
+		fn.args = append(fn.args, arg)
+		p.skipSpace()
+	}
+
+	valueArgs := func(count int) error {
+		if count != len(fn.args) {
+			return p.errorf("%s() requires %d argument(s)", name, count)
+		}
+		for _, arg := range fn.args {
+			if !arg.comparable() {
+				return p.errorf("%s() arguments must be literals, singular queries or value functions", name)
+			}
+		}
+		return nil
+	}
+	switch name {
+	case "length":
+		if err := valueArgs(1); nil != err {
+			return jpOperand{}, err
+		}
+	case "count", "value":
+		if 1 != len(fn.args) || nil == fn.args[0].query {
+			return jpOperand{}, p.errorf("%s() requires a single query argument", name)
+		}
+	case "match", "search":
+		if err := valueArgs(2); nil != err {
+			return jpOperand{}, err
+		}
+		if pattern, ok := fn.args[1].literal.(string); ok && fn.args[1].isLiteral {
+			fn.re = compileIRegexp(pattern, "match" == name)
+		}
+	default:
+		return jpOperand{}, p.errorf("unknown function '%s'", name)
+	}
+	return jpOperand{fn: fn}, nil
+}
+
+/*
+jpIsNameChar reports whether src[pos] continues an identifier.
+*/
+func jpIsNameChar(src string, pos int) bool {
+	if pos >= len(src) {
+		return false
+	}
+	c := src[pos]
+	return '_' == c || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+/*
+compileIRegexp compiles an I-Regexp (RFC 9485) pattern, anchoring it for
+full matches. It returns nil if the pattern is invalid.
+*/
+func compileIRegexp(pattern string, anchor bool) *regexp.Regexp {
+	if anchor {
+		pattern = `\A(?:` + pattern + `)\z`
+	}
+	re, err := regexp.Compile(pattern)
+	if nil != err {
+		return nil
+	}
+	return re
+}
@@ -0,0 +1,135 @@
+package model_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/bdlm/model"
+	stdModel "github.com/bdlm/std/v2/model"
+)
+
+const queryStore = `{"store": {
+	"book": [
+		{"category": "reference", "author": "Nigel Rees", "title": "Sayings of the Century", "price": 8.95},
+		{"category": "fiction", "author": "Evelyn Waugh", "title": "Sword of Honour", "price": 12.99},
+		{"category": "fiction", "author": "Herman Melville", "title": "Moby Dick", "isbn": "0-553-21311-3", "price": 8.99},
+		{"category": "fiction", "author": "J. R. R. Tolkien", "title": "The Lord of the Rings", "isbn": "0-395-19395-8", "price": "22.99"}
+	],
+	"bicycle": {"color": "red", "price": 399}
+}}`
+
+func queryValues(t *testing.T, mdl *model.Model, query string) []any {
+	t.Helper()
+	matches, err := model.Query(mdl, query)
+	if nil != err {
+		t.Fatalf("%s: unexpected error: %v", query, err)
+	}
+	values := []any{}
+	for _, match := range matches {
+		values = append(values, match.Value.Value())
+	}
+	return values
+}
+
+func TestQuery(t *testing.T) {
+	mdl := model.New(stdModel.ModelTypeHash)
+	if err := mdl.UnmarshalJSON([]byte(queryStore)); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		query    string
+		expected []any
+	}{
+		{`$.store.book[*].author`, []any{"Nigel Rees", "Evelyn Waugh", "Herman Melville", "J. R. R. Tolkien"}},
+		{`$..author`, []any{"Nigel Rees", "Evelyn Waugh", "Herman Melville", "J. R. R. Tolkien"}},
+		{`$.store..price`, []any{399.0, 8.95, 12.99, 8.99, "22.99"}},
+		{`$..book[2].title`, []any{"Moby Dick"}},
+		{`$..book[-1].title`, []any{"The Lord of the Rings"}},
+		{`$..book[0,1].title`, []any{"Sayings of the Century", "Sword of Honour"}},
+		{`$..book[:2].title`, []any{"Sayings of the Century", "Sword of Honour"}},
+		{`$..book[::-2].title`, []any{"The Lord of the Rings", "Sword of Honour"}},
+		{`$..book[?@.isbn].title`, []any{"Moby Dick", "The Lord of the Rings"}},
+		{`$..book[?@.price < 10].title`, []any{"Sayings of the Century", "Moby Dick"}},
+		{`$..book[?@.price > 20].title`, []any{"The Lord of the Rings"}},
+		{`$..book[?@.price > $.store.bicycle.price].title`, []any{}},
+		{`$..book[?@.category == 'fiction' && !(@.price < 10)].title`, []any{"Sword of Honour", "The Lord of the Rings"}},
+		{`$..book[?match(@.author, 'H.*') || search(@.title, "Sword")].title`, []any{"Sword of Honour", "Moby Dick"}},
+		{`$..book[?length(@.title) == 9].title`, []any{"Moby Dick"}},
+		{`$.store[?count(@.*) > 2][0].author`, []any{"Nigel Rees"}},
+		{`$["store"]['bicycle'].color`, []any{"red"}},
+		{`$.store.missing`, []any{}},
+	}
+	for _, test := range tests {
+		values := queryValues(t, mdl, test.query)
+		if !reflect.DeepEqual(test.expected, values) {
+			t.Errorf("%s: expected %v, received %v", test.query, test.expected, values)
+		}
+	}
+
+	matches, _ := model.Query(mdl, `$..book[?@.price == 8.99].title`)
+	if 1 != len(matches) || `$['store']['book'][2]['title']` != matches[0].Path {
+		t.Errorf("unexpected matches %v", matches)
+	}
+
+	if matches, _ := model.Query(mdl, `$`); 1 != len(matches) || "$" != matches[0].Path {
+		t.Errorf("expected the root node, received %v", matches)
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	for _, query := range []string{
+		``,
+		`store`,
+		`$.`,
+		`$[`,
+		`$[01]`,
+		`$[?@.a == @..b]`,
+		`$[?1]`,
+		`$[?!@.a == 1]`,
+		`$[?foo(@.a)]`,
+		`$[?length(@.a)]`,
+		`$['a\x']`,
+		`$.a `,
+	} {
+		if _, err := model.CompileJSONPath(query); !errors.Is(err, model.InvalidQuery) {
+			t.Errorf("%q: expected InvalidQuery, received %v", query, err)
+		}
+	}
+}
+
+func TestQueryCycle(t *testing.T) {
+	mdl := model.New(stdModel.ModelTypeHash)
+	mdl.Set("a", 1)
+	child := model.New(stdModel.ModelTypeHash)
+	child.Set("a", 2)
+	child.Set("parent", mdl)
+	mdl.Set("child", child)
+
+	values := queryValues(t, mdl, `$..a`)
+	if !reflect.DeepEqual([]any{1, 2}, values) {
+		t.Errorf("expected [1 2], received %v", values)
+	}
+}
+
+func TestQuerySharedModel(t *testing.T) {
+	shared := model.New(stdModel.ModelTypeHash)
+	shared.Set("x", 1)
+	mdl := model.New(stdModel.ModelTypeHash)
+	mdl.Set("a", shared)
+	mdl.Set("b", shared)
+
+	matches, err := model.Query(mdl, `$..x`)
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	paths := []string{}
+	for _, match := range matches {
+		paths = append(paths, match.Path)
+	}
+	expected := []string{`$['a']['x']`, `$['b']['x']`}
+	if !reflect.DeepEqual(expected, paths) {
+		t.Errorf("expected %v, received %v", expected, paths)
+	}
+}
@@ -0,0 +1,171 @@
+package model
+
+import (
+	"bytes"
+	"reflect"
+	"time"
+
+	stdModel "github.com/bdlm/std/v2/model"
+)
+
+/*
+refKey is the key of the serialized form of a Ref, {"$ref": id}.
+*/
+const refKey = "$ref"
+
+/*
+Ref is a reference to a model by ID. Storing a Ref instead of the model
+itself allows graphs, including cycles, to be built from models and
+serialized: a Ref is encoded as {"$ref": id} and decoded back into a Ref.
+*/
+type Ref struct {
+	ID any
+}
+
+/*
+RefTo returns a reference to mdl.
+*/
+func RefTo(mdl *Model) Ref {
+	return Ref{ID: mdl.GetID()}
+}
+
+/*
+Resolve returns the referenced model, searching root and the models nested
+within it.
+*/
+func (ref Ref) Resolve(root *Model) (*Model, bool) {
+	return root.FindByID(ref.ID)
+}
+
+/*
+Lookup returns the referenced model from a registry.
+*/
+func (ref Ref) Lookup(reg *Registry) (*Model, bool) {
+	return reg.Get(ref.ID)
+}
+
+/*
+MarshalJSON implements json.Marshaler.
+*/
+func (ref Ref) MarshalJSON() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteString(`{"` + refKey + `":`)
+	if err := writeJSON(buf, ref.ID); nil != err {
+		return nil, err
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+/*
+MarshalYAML implements yaml.Marshaler.
+*/
+func (ref Ref) MarshalYAML() (any, error) {
+	return map[string]any{refKey: ref.ID}, nil
+}
+
+/*
+refFromMap returns the Ref encoded by a decoded {"$ref": id} object.
+*/
+func refFromMap(v any) (Ref, bool) {
+	switch typed := v.(type) {
+	case map[string]any:
+		if id, ok := typed[refKey]; ok && 1 == len(typed) {
+			return Ref{ID: id}, true
+		}
+	case *Model:
+		if nil == typed || stdModel.ModelTypeHash != typed.GetType() {
+			return Ref{}, false
+		}
+		keys, values := typed.entries()
+		if 1 == len(keys) && refKey == keys[0] {
+			return Ref{ID: values[0]}, true
+		}
+	}
+	return Ref{}, false
+}
+
+/*
+Equal reports whether this model and other hold equal data. Nested models
+are compared by content and hash keys in any order; numbers are equal if
+their values are, whatever their types; Refs are equal if their IDs are.
+Models that contain themselves are compared without recursing forever.
+*/
+func (mdl *Model) Equal(other *Model) bool {
+	return deepEqual(mdl, other, map[[2]*Model]bool{})
+}
+
+/*
+deepEqual implements Equal. seen holds the pairs of models being compared;
+a pair met again is assumed equal, which holds if the rest of the
+comparison succeeds.
+*/
+func deepEqual(a, b any, seen map[[2]*Model]bool) bool {
+	a, b = unwrap(a), unwrap(b)
+	if x, ok := a.(*Model); ok {
+		y, ok := b.(*Model)
+		if !ok || nil == x || nil == y {
+			return ok && x == y
+		}
+		if x == y || seen[[2]*Model{x, y}] {
+			return true
+		}
+		seen[[2]*Model{x, y}] = true
+		return modelEqual(x, y, seen)
+	}
+	if _, ok := b.(*Model); ok {
+		return false
+	}
+
+	if x, ok := jpNumber(a); ok {
+		y, ok := jpNumber(b)
+		return ok && x == y
+	}
+	switch typed := a.(type) {
+	case nil:
+		return nil == b
+	case Ref:
+		other, ok := b.(Ref)
+		return ok && idComparable(typed.ID) && idComparable(other.ID) && typed.ID == other.ID
+	case time.Time:
+		other, ok := b.(time.Time)
+		return ok && typed.Equal(other)
+	case []byte:
+		other, ok := b.([]byte)
+		return ok && bytes.Equal(typed, other)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+/*
+modelEqual compares the data of two models.
+*/
+func modelEqual(x, y *Model, seen map[[2]*Model]bool) bool {
+	if x.GetType() != y.GetType() {
+		return false
+	}
+	xKeys, xValues := x.entries()
+	yKeys, yValues := y.entries()
+	if len(xValues) != len(yValues) {
+		return false
+	}
+	if stdModel.ModelTypeList == x.GetType() {
+		for k := range xValues {
+			if !deepEqual(xValues[k], yValues[k], seen) {
+				return false
+			}
+		}
+		return true
+	}
+	yIdx := make(map[string]int, len(yKeys))
+	for k, key := range yKeys {
+		yIdx[key] = k
+	}
+	for k, key := range xKeys {
+		pos, ok := yIdx[key]
+		if !ok || !deepEqual(xValues[k], yValues[pos], seen) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,150 @@
+package model_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bdlm/model"
+	stdModel "github.com/bdlm/std/v2/model"
+)
+
+func refGraph() (*model.Model, *model.Model, *model.Model) {
+	root := model.New(stdModel.ModelTypeList)
+	alice := model.New(stdModel.ModelTypeHash)
+	alice.SetID("alice")
+	bob := model.New(stdModel.ModelTypeHash)
+	bob.SetID("bob")
+	alice.Set("name", "Alice")
+	alice.Set("friend", model.RefTo(bob))
+	bob.Set("name", "Bob")
+	bob.Set("friend", model.RefTo(alice))
+	root.Push(alice)
+	root.Push(bob)
+	return root, alice, bob
+}
+
+func TestRefResolve(t *testing.T) {
+	root, alice, bob := refGraph()
+	val, _ := alice.Get("friend")
+	ref, ok := val.Value().(model.Ref)
+	if !ok {
+		t.Fatalf("expected a Ref, received %T", val.Value())
+	}
+	if found, ok := ref.Resolve(root); !ok || found != bob {
+		t.Errorf("expected bob, received %v", found)
+	}
+
+	reg := model.NewRegistry()
+	reg.RegisterTree(root)
+	if found, ok := model.RefTo(alice).Lookup(reg); !ok || found != alice {
+		t.Errorf("expected alice, received %v", found)
+	}
+	if _, ok := (model.Ref{ID: "carol"}).Resolve(root); ok {
+		t.Errorf("expected an unresolved reference")
+	}
+}
+
+func TestRefJSON(t *testing.T) {
+	root, _, _ := refGraph()
+	expected := `[{"name":"Alice","friend":{"$ref":"bob"}},{"name":"Bob","friend":{"$ref":"alice"}}]`
+	if got := historyJSON(t, root); expected != got {
+		t.Errorf("expected %s, received %s", expected, got)
+	}
+
+	loaded := model.New(stdModel.ModelTypeList)
+	if err := loaded.UnmarshalJSON([]byte(expected)); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	val, _ := loaded.Get(0)
+	first, _ := val.Model()
+	friend, _ := first.Get("friend")
+	if (model.Ref{ID: "bob"}) != friend.Value() {
+		t.Errorf("expected a Ref to bob, received %v", friend.Value())
+	}
+}
+
+func TestRefBinary(t *testing.T) {
+	root, _, _ := refGraph()
+	for _, format := range []model.Format{model.FormatCBOR, model.FormatMsgPack, model.FormatYAML} {
+		data, err := model.EncodeAs(root, format)
+		if nil != err {
+			t.Fatalf("%s: unexpected error: %v", format, err)
+		}
+		loaded := model.New(stdModel.ModelTypeList)
+		if err := model.DecodeAs(data, loaded, format); nil != err {
+			t.Fatalf("%s: unexpected error: %v", format, err)
+		}
+		if !loaded.Equal(root) {
+			t.Errorf("%s: expected the graph to round trip, received %s", format, historyJSON(t, loaded))
+		}
+	}
+}
+
+func TestCircularMarshal(t *testing.T) {
+	mdl := model.New(stdModel.ModelTypeHash)
+	mdl.Set("self", mdl)
+	if _, err := mdl.MarshalJSON(); !errors.Is(err, model.CircularReference) {
+		t.Errorf("expected CircularReference, received %v", err)
+	}
+	for _, format := range []model.Format{model.FormatYAML, model.FormatTOML, model.FormatCBOR, model.FormatMsgPack} {
+		if _, err := model.EncodeAs(mdl, format); !errors.Is(err, model.CircularReference) {
+			t.Errorf("%s: expected CircularReference, received %v", format, err)
+		}
+	}
+
+	// A list containing itself is written as an inline TOML array.
+	list := model.New(stdModel.ModelTypeList)
+	list.Push(list)
+	inline := model.New(stdModel.ModelTypeHash)
+	inline.Set("list", list)
+	if _, err := model.EncodeAs(inline, model.FormatTOML); !errors.Is(err, model.CircularReference) {
+		t.Errorf("expected CircularReference, received %v", err)
+	}
+
+	// A model shared by siblings is not a cycle.
+	shared := model.New(stdModel.ModelTypeList)
+	tree := model.New(stdModel.ModelTypeHash)
+	tree.Set("a", shared)
+	tree.Set("b", shared)
+	if got := historyJSON(t, tree); `{"a":[],"b":[]}` != got {
+		t.Errorf(`expected {"a":[],"b":[]}, received %s`, got)
+	}
+}
+
+func TestEqual(t *testing.T) {
+	a := model.New(stdModel.ModelTypeHash)
+	a.Set("x", 1)
+	a.Set("y", "two")
+	b := model.New(stdModel.ModelTypeHash)
+	b.Set("y", "two")
+	b.Set("x", 1.0)
+	if !a.Equal(b) {
+		t.Errorf("expected equal models")
+	}
+	b.Set("x", 2)
+	if a.Equal(b) {
+		t.Errorf("expected different models")
+	}
+
+	// Cyclic models compare without recursing forever.
+	c := model.New(stdModel.ModelTypeHash)
+	c.Set("self", c)
+	d := model.New(stdModel.ModelTypeHash)
+	d.Set("self", d)
+	if !c.Equal(d) {
+		t.Errorf("expected equal cyclic models")
+	}
+	d.Set("extra", true)
+	if c.Equal(d) {
+		t.Errorf("expected different cyclic models")
+	}
+
+	clone := c.Clone()
+	if !clone.Equal(c) {
+		t.Errorf("expected the clone to equal the original")
+	}
+	val, _ := clone.Get("self")
+	if self, _ := val.Model(); self != clone {
+		t.Errorf("expected the clone to keep its cycle")
+	}
+}
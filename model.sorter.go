@@ -3,6 +3,8 @@ package model
 import (
 	"sort"
 
+	"github.com/bdlm/errors/v2"
+
 	stdModel "github.com/bdlm/std/v2/model"
 	stdSorter "github.com/bdlm/std/v2/sorter"
 )
@@ -11,28 +13,81 @@ import (
 Sort sorts the model data.
 */
 func (mdl *Model) Sort(flag stdSorter.SortFlag) error {
-	data := []interface{}{}
-	hashIdx := map[string]int{}
-	idxHash := map[int]string{}
 	switch flag {
 	case stdSorter.SortByKey:
 		if stdModel.ModelTypeHash == mdl.GetType() {
-			order := []string{}
-			for _, v := range mdl.idxHash {
-				order = append(order, v)
+			_, err := mdl.change(func() (Event, error) {
+				prev := mdl.keyOrderLocked()
+				mdl.sortByKeyLocked()
+				return Event{Type: EventReorder, Path: []any{}, prev: prev}, nil
+			})
+			if nil != err {
+				return err
 			}
-			sort.Strings(order)
-			for _, v := range order {
-				hashIdx[v] = len(data)
-				idxHash[len(data)] = v
-				data = append(data, mdl.data[mdl.hashIdx[v]])
-			}
-			mdl.data = data
-			mdl.hashIdx = hashIdx
-			mdl.idxHash = idxHash
 		}
 		if stdModel.ModelTypeList == mdl.GetType() {
 		}
 	}
 	return nil
 }
+
+/*
+sortByKeyLocked sorts hash model data by key. The caller must hold the
+model lock.
+*/
+func (mdl *Model) sortByKeyLocked() {
+	data := []interface{}{}
+	hashIdx := map[string]int{}
+	idxHash := map[int]string{}
+	order := []string{}
+	for _, v := range mdl.idxHash {
+		order = append(order, v)
+	}
+	sort.Strings(order)
+	for _, v := range order {
+		hashIdx[v] = len(data)
+		idxHash[len(data)] = v
+		data = append(data, mdl.data[mdl.hashIdx[v]])
+	}
+	mdl.data = data
+	mdl.hashIdx = hashIdx
+	mdl.idxHash = idxHash
+}
+
+/*
+keyOrderLocked returns the keys of a hash model in storage order. The caller
+must hold the model lock.
+*/
+func (mdl *Model) keyOrderLocked() []string {
+	keys := make([]string, len(mdl.data))
+	for k := range mdl.data {
+		keys[k] = mdl.idxHash[k]
+	}
+	return keys
+}
+
+/*
+reorderLocked stores hash model data in the order given by keys, which must
+hold each key exactly once. The caller must hold the model lock.
+*/
+func (mdl *Model) reorderLocked(keys []string) error {
+	if len(keys) != len(mdl.data) {
+		return errors.WrapE(InvalidIndex, errors.Errorf("key order does not match model"))
+	}
+	data := make([]any, 0, len(keys))
+	hashIdx := make(map[string]int, len(keys))
+	idxHash := make(map[int]string, len(keys))
+	for _, key := range keys {
+		pos, ok := mdl.hashIdx[key]
+		if _, dup := hashIdx[key]; !ok || dup {
+			return errors.WrapE(InvalidIndex, errors.Errorf("key order does not match model"))
+		}
+		hashIdx[key] = len(data)
+		idxHash[len(data)] = key
+		data = append(data, mdl.data[pos])
+	}
+	mdl.data = data
+	mdl.hashIdx = hashIdx
+	mdl.idxHash = idxHash
+	return nil
+}
@@ -0,0 +1,433 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bdlm/errors/v2"
+	stdModel "github.com/bdlm/std/v2/model"
+)
+
+const (
+	storeSnapshot = "snapshot.json"
+	storeLogExt   = ".log"
+	storeLogName  = "ops."
+)
+
+/*
+StoreOptions configures a Store.
+*/
+type StoreOptions struct {
+	// CompactEvery is the number of logged changes after which the log is
+	// compacted into a new snapshot. The default is 1000; a negative value
+	// disables automatic compaction.
+	CompactEvery int
+}
+
+/*
+withDefaults returns a copy of the options with defaults applied.
+*/
+func (opts StoreOptions) withDefaults() StoreOptions {
+	if 0 == opts.CompactEvery {
+		opts.CompactEvery = 1000
+	}
+	return opts
+}
+
+/*
+Store persists a model to a local directory. The directory holds a snapshot
+of the model and append-only logs of the changes made since the snapshot
+was taken, written by an OpLog. Each change is synced to disk before the
+call making it returns; a change that cannot be saved is reverted and the
+call returns the error.
+
+When the log grows past CompactEvery changes, a new log is started and a
+new snapshot is built in the background by applying the finished logs to
+the previous snapshot, so changes are not held up while the snapshot is
+written. Compact does the same in the calling goroutine.
+
+Snapshots are written to a temporary file and renamed into place, and each
+snapshot names the first log that follows it, so a crash at any point
+leaves a consistent snapshot and logs. A change that was only partly
+written when the process crashed is discarded when the store is opened.
+*/
+type Store struct {
+	dir  string
+	typ  stdModel.ModelType
+	opts StoreOptions
+	mdl  *Model
+	log  *OpLog
+
+	compactMux sync.Mutex // serializes compactions
+	base       int        // generation of the snapshot
+	compacting sync.WaitGroup
+
+	mux        sync.Mutex
+	gen        int // generation of the log being written
+	file       *os.File
+	ops        int
+	closed     bool
+	background bool  // a background compaction is running
+	err        error // first background compaction error
+}
+
+/*
+storeSnapshotJSON is the wire form of a snapshot.
+*/
+type storeSnapshotJSON struct {
+	Gen  int `json:"gen"`
+	Data any `json:"data"`
+}
+
+/*
+OpenStore opens the store in dir, creating the directory if needed, and
+loads the model saved there. If the directory holds no snapshot, the model
+is a new model of the given type.
+*/
+func OpenStore(dir string, typ stdModel.ModelType, opts StoreOptions) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); nil != err {
+		return nil, errors.Wrap(err, "could not create store directory '%s'", dir)
+	}
+	store := &Store{dir: dir, typ: typ, opts: opts.withDefaults()}
+
+	mdl, base, err := store.readSnapshot()
+	if nil != err {
+		return nil, err
+	}
+	store.mdl, store.base, store.gen = mdl, base, base
+	for gen := base; ; gen++ {
+		if _, err := os.Stat(store.logPath(gen)); os.IsNotExist(err) {
+			break
+		}
+		ops, err := store.replayLog(mdl, gen, true)
+		if nil != err {
+			return nil, err
+		}
+		store.gen = gen
+		store.ops += ops
+	}
+	if err := store.removeStaleFiles(); nil != err {
+		return nil, err
+	}
+
+	store.file, err = os.OpenFile(store.logPath(store.gen), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if nil != err {
+		return nil, errors.Wrap(err, "could not open store log")
+	}
+	store.log = NewOpLog(store.mdl, storeWriter{store})
+	return store, nil
+}
+
+/*
+Model returns the stored model. Changes made to it, or to models nested
+within it, are saved.
+*/
+func (store *Store) Model() *Model {
+	return store.mdl
+}
+
+/*
+Err returns the first error encountered saving a change or compacting the
+store in the background. Once saving a change has failed, every later
+change fails with the same error.
+*/
+func (store *Store) Err() error {
+	if err := store.log.Err(); nil != err {
+		return err
+	}
+	store.mux.Lock()
+	defer store.mux.Unlock()
+	return store.err
+}
+
+/*
+Compact starts a new log and folds the previous logs into a new snapshot.
+*/
+func (store *Store) Compact() error {
+	return store.compact()
+}
+
+/*
+Close stops saving changes, waits for a background compaction to finish and
+closes the log. It returns the first error encountered saving a change or
+compacting the store, if any.
+*/
+func (store *Store) Close() error {
+	store.log.Close()
+	store.compacting.Wait()
+	err := store.Err()
+	store.mux.Lock()
+	defer store.mux.Unlock()
+	if store.closed {
+		return err
+	}
+	store.closed = true
+	if closeErr := store.file.Close(); nil == err && nil != closeErr {
+		err = errors.Wrap(closeErr, "could not close store log")
+	}
+	return err
+}
+
+/*
+storeWriter is the io.Writer receiving the ops of a Store.
+*/
+type storeWriter struct {
+	store *Store
+}
+
+/*
+Write implements io.Writer. Each call holds one op, which is appended to the
+log and synced to disk. It is called while the changed model is locked, so
+compaction is started in the background.
+*/
+func (w storeWriter) Write(line []byte) (int, error) {
+	store := w.store
+	store.mux.Lock()
+	defer store.mux.Unlock()
+	if store.closed {
+		return 0, errors.WrapE(InvalidMethodContext, errors.Errorf("store is closed"))
+	}
+	n, err := store.file.Write(line)
+	if nil != err {
+		return n, err
+	}
+	if err := store.file.Sync(); nil != err {
+		return n, err
+	}
+	store.ops++
+	if store.opts.CompactEvery > 0 && store.ops >= store.opts.CompactEvery && !store.background {
+		store.background = true
+		store.compacting.Add(1)
+		go func() {
+			defer store.compacting.Done()
+			err := store.compact()
+			store.mux.Lock()
+			defer store.mux.Unlock()
+			store.background = false
+			if nil == store.err && nil != err {
+				store.err = err
+			}
+		}()
+	}
+	return n, nil
+}
+
+/*
+compact implements Compact. Changes are written to a new log while the
+previous logs are applied to the snapshot.
+*/
+func (store *Store) compact() error {
+	store.compactMux.Lock()
+	defer store.compactMux.Unlock()
+	gen, err := store.rotate()
+	if nil != err {
+		return err
+	}
+
+	mdl, _, err := store.readSnapshot()
+	if nil != err {
+		return err
+	}
+	for prev := store.base; prev < gen; prev++ {
+		if _, err := store.replayLog(mdl, prev, false); nil != err {
+			return err
+		}
+	}
+	if err := store.writeSnapshot(mdl, gen); nil != err {
+		return err
+	}
+	for prev := store.base; prev < gen; prev++ {
+		if err := os.Remove(store.logPath(prev)); nil != err && !os.IsNotExist(err) {
+			return errors.Wrap(err, "could not remove store log")
+		}
+	}
+	store.base = gen
+	return nil
+}
+
+/*
+rotate starts a new log and returns its generation.
+*/
+func (store *Store) rotate() (int, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+	if store.closed {
+		return 0, errors.WrapE(InvalidMethodContext, errors.Errorf("store is closed"))
+	}
+	gen := store.gen + 1
+	file, err := os.OpenFile(store.logPath(gen), os.O_WRONLY|os.O_APPEND|os.O_CREATE|os.O_TRUNC, 0o644)
+	if nil != err {
+		return 0, errors.Wrap(err, "could not create store log")
+	}
+	if err := file.Sync(); nil != err {
+		file.Close()
+		return 0, errors.Wrap(err, "could not sync store log")
+	}
+	if err := syncDir(store.dir); nil != err {
+		file.Close()
+		return 0, err
+	}
+	store.file.Close()
+	store.file, store.gen, store.ops = file, gen, 0
+	return gen, nil
+}
+
+/*
+writeSnapshot writes mdl to the snapshot file, replacing it atomically.
+*/
+func (store *Store) writeSnapshot(mdl *Model, gen int) error {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, `{"gen":%d,"data":`, gen)
+	if err := writeOpValue(buf, mdl, nil); nil != err {
+		return errors.Wrap(err, "could not encode store snapshot")
+	}
+	buf.WriteString("}\n")
+
+	path := filepath.Join(store.dir, storeSnapshot)
+	tmp, err := os.CreateTemp(store.dir, storeSnapshot+".*")
+	if nil != err {
+		return errors.Wrap(err, "could not create store snapshot")
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); nil != err {
+		tmp.Close()
+		return errors.Wrap(err, "could not write store snapshot")
+	}
+	if err := tmp.Sync(); nil != err {
+		tmp.Close()
+		return errors.Wrap(err, "could not sync store snapshot")
+	}
+	if err := tmp.Close(); nil != err {
+		return errors.Wrap(err, "could not write store snapshot")
+	}
+	if err := os.Rename(tmp.Name(), path); nil != err {
+		return errors.Wrap(err, "could not replace store snapshot")
+	}
+	return syncDir(store.dir)
+}
+
+/*
+readSnapshot loads the snapshot file, or returns a new model of the store
+type if there is none.
+*/
+func (store *Store) readSnapshot() (*Model, int, error) {
+	data, err := os.ReadFile(filepath.Join(store.dir, storeSnapshot))
+	if os.IsNotExist(err) {
+		return New(store.typ), 0, nil
+	}
+	if nil != err {
+		return nil, 0, errors.Wrap(err, "could not read store snapshot")
+	}
+
+	var snapshot storeSnapshotJSON
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&snapshot); nil != err {
+		return nil, 0, errors.WrapE(InvalidFormat, errors.Wrap(err, "could not decode store snapshot"))
+	}
+	value, err := readOpValue(snapshot.Data)
+	if nil != err {
+		return nil, 0, errors.Wrap(err, "could not decode store snapshot")
+	}
+	mdl, ok := value.(*Model)
+	if !ok || store.typ != mdl.GetType() {
+		return nil, 0, errors.WrapE(InvalidDataSet, errors.Errorf("store snapshot does not hold a model of the requested type"))
+	}
+	return mdl, snapshot.Gen, nil
+}
+
+/*
+replayLog applies the log of the given generation to mdl and returns the
+number of ops applied. A trailing op without a terminating newline was
+interrupted by a crash; it is discarded, and the log is truncated if
+truncate is set.
+*/
+func (store *Store) replayLog(mdl *Model, gen int, truncate bool) (int, error) {
+	path := store.logPath(gen)
+	data, err := os.ReadFile(path)
+	if nil != err {
+		return 0, errors.Wrap(err, "could not read store log")
+	}
+
+	ops := 0
+	complete := bytes.LastIndexByte(data, '\n') + 1
+	for k, line := range bytes.SplitAfter(data[:complete], []byte("\n")) {
+		if 0 == len(bytes.TrimSpace(line)) {
+			continue
+		}
+		var op Op
+		if err := op.UnmarshalJSON(line); nil != err {
+			return ops, errors.Wrap(err, "could not read store log %d entry %d", gen, k)
+		}
+		if err := op.Apply(mdl); nil != err {
+			return ops, errors.Wrap(err, "could not replay store log %d entry %d", gen, k)
+		}
+		ops++
+	}
+	if truncate && complete < len(data) {
+		if err := os.Truncate(path, int64(complete)); nil != err {
+			return ops, errors.Wrap(err, "could not truncate store log")
+		}
+	}
+	return ops, nil
+}
+
+/*
+removeStaleFiles removes logs already folded into the snapshot and
+temporary snapshots left behind by an interrupted compaction.
+*/
+func (store *Store) removeStaleFiles() error {
+	entries, err := os.ReadDir(store.dir)
+	if nil != err {
+		return errors.Wrap(err, "could not read store directory")
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, storeSnapshot+".") {
+			if err := os.Remove(filepath.Join(store.dir, name)); nil != err {
+				return errors.Wrap(err, "could not remove stale store snapshot")
+			}
+			continue
+		}
+		if !strings.HasPrefix(name, storeLogName) || !strings.HasSuffix(name, storeLogExt) {
+			continue
+		}
+		gen, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, storeLogName), storeLogExt))
+		if nil != err || (gen >= store.base && gen <= store.gen) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(store.dir, name)); nil != err {
+			return errors.Wrap(err, "could not remove stale store log")
+		}
+	}
+	return nil
+}
+
+/*
+logPath returns the path of the log following the snapshot of the given
+generation.
+*/
+func (store *Store) logPath(gen int) string {
+	return filepath.Join(store.dir, storeLogName+strconv.Itoa(gen)+storeLogExt)
+}
+
+/*
+syncDir syncs a directory so that renames within it are durable.
+*/
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if nil != err {
+		return errors.Wrap(err, "could not sync store directory")
+	}
+	defer file.Close()
+	if err := file.Sync(); nil != err {
+		return errors.Wrap(err, "could not sync store directory")
+	}
+	return nil
+}
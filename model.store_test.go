@@ -0,0 +1,206 @@
+package model_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/bdlm/model"
+	stdModel "github.com/bdlm/std/v2/model"
+)
+
+func openStore(t *testing.T, dir string, opts model.StoreOptions) *model.Store {
+	t.Helper()
+	store, err := model.OpenStore(dir, stdModel.ModelTypeHash, opts)
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return store
+}
+
+func TestStoreReload(t *testing.T) {
+	dir := t.TempDir()
+	store := openStore(t, dir, model.StoreOptions{})
+	mdl := store.Model()
+	mdl.Set("name", "app")
+	db := model.New(stdModel.ModelTypeHash)
+	db.Set("port", 5432)
+	mdl.Set("db", db)
+	db.Set("host", "localhost")
+	mdl.Delete("name")
+	if err := store.Close(); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	mdl.Set("after", "close")
+
+	store = openStore(t, dir, model.StoreOptions{})
+	defer store.Close()
+	expected := `{"db":{"port":5432,"host":"localhost"}}`
+	if got := historyJSON(t, store.Model()); expected != got {
+		t.Errorf("expected %s, received %s", expected, got)
+	}
+}
+
+func TestStoreCompaction(t *testing.T) {
+	dir := t.TempDir()
+	store := openStore(t, dir, model.StoreOptions{CompactEvery: 3})
+	mdl := store.Model()
+	for k, key := range []string{"a", "b", "c", "d"} {
+		mdl.Set(key, k)
+	}
+	if err := store.Close(); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	logs, _ := filepath.Glob(filepath.Join(dir, "ops.*.log"))
+	if 1 != len(logs) || "ops.1.log" != filepath.Base(logs[0]) {
+		t.Errorf("expected a single compacted log, received %v", logs)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "snapshot.json")); nil != err {
+		t.Errorf("expected a snapshot: %v", err)
+	}
+
+	store = openStore(t, dir, model.StoreOptions{CompactEvery: -1})
+	expected := `{"a":0,"b":1,"c":2,"d":3}`
+	if got := historyJSON(t, store.Model()); expected != got {
+		t.Errorf("expected %s, received %s", expected, got)
+	}
+	store.Model().Set("e", 4)
+	if err := store.Compact(); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	store.Close()
+	if err := store.Compact(); !errors.Is(err, model.InvalidMethodContext) {
+		t.Errorf("expected InvalidMethodContext, received %v", err)
+	}
+
+	store = openStore(t, dir, model.StoreOptions{})
+	defer store.Close()
+	expected = `{"a":0,"b":1,"c":2,"d":3,"e":4}`
+	if got := historyJSON(t, store.Model()); expected != got {
+		t.Errorf("expected %s, received %s", expected, got)
+	}
+}
+
+func TestStoreConcurrentCompaction(t *testing.T) {
+	dir := t.TempDir()
+	store := openStore(t, dir, model.StoreOptions{CompactEvery: 2})
+	mdl := store.Model()
+	node := model.New(stdModel.ModelTypeHash)
+	mdl.Set("node", node)
+
+	// Hold back the event for a change to node, which is delivered to the
+	// subscribers of node before it reaches the store, until another change
+	// has compacted the store.
+	held, release := make(chan struct{}), make(chan struct{})
+	sub := node.Subscribe(func(model.Event) {
+		close(held)
+		<-release
+	})
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		node.Set("a", 1)
+	}()
+	<-held
+	sub.Cancel()
+	mdl.Set("b", 2)
+	close(release)
+	wg.Wait()
+	if err := store.Close(); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	store, err := model.OpenStore(dir, stdModel.ModelTypeHash, model.StoreOptions{})
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer store.Close()
+	if !store.Model().Equal(mdl) {
+		t.Errorf("expected %s, received %s", historyJSON(t, mdl), historyJSON(t, store.Model()))
+	}
+}
+
+func TestStoreBackgroundCompaction(t *testing.T) {
+	dir := t.TempDir()
+	store := openStore(t, dir, model.StoreOptions{CompactEvery: 5})
+	mdl := store.Model()
+	wg := sync.WaitGroup{}
+	for k := 0; k < 4; k++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			node := model.New(stdModel.ModelTypeList)
+			mdl.Set(string(rune('a'+k)), node)
+			for a := 0; a < 50; a++ {
+				if err := node.Push(a); nil != err {
+					t.Errorf("unexpected error: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if err := store.Close(); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	store = openStore(t, dir, model.StoreOptions{})
+	defer store.Close()
+	if !store.Model().Equal(mdl) {
+		t.Errorf("expected %s, received %s", historyJSON(t, mdl), historyJSON(t, store.Model()))
+	}
+}
+
+func TestStoreRecovery(t *testing.T) {
+	dir := t.TempDir()
+	store := openStore(t, dir, model.StoreOptions{})
+	store.Model().Set("a", 1)
+	store.Close()
+
+	// A crash during a write leaves a partial op, and a crash during
+	// compaction leaves the next log, already receiving changes, and a
+	// temporary snapshot.
+	logPath := filepath.Join(dir, "ops.0.log")
+	file, _ := os.OpenFile(logPath, os.O_WRONLY|os.O_APPEND, 0o644)
+	file.WriteString(`{"op":"set","path":["b"],"val`)
+	file.Close()
+	os.WriteFile(filepath.Join(dir, "ops.1.log"), []byte(`{"op":"insert","path":["c"],"index":1,"value":3}`+"\n"), 0o644)
+	os.WriteFile(filepath.Join(dir, "ops.7.log"), []byte(`{"op":"set","path":["x"],"value":0}`+"\n"), 0o644)
+	os.WriteFile(filepath.Join(dir, "snapshot.json.123"), []byte(`{"gen":1`), 0o644)
+
+	store = openStore(t, dir, model.StoreOptions{})
+	if got := historyJSON(t, store.Model()); `{"a":1,"c":3}` != got {
+		t.Errorf(`expected {"a":1,"c":3}, received %s`, got)
+	}
+	store.Model().Set("d", 4)
+	store.Close()
+
+	names := []string{}
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if 2 != len(names) || "ops.0.log" != names[0] || "ops.1.log" != names[1] {
+		t.Errorf("expected stale files to be removed, received %v", names)
+	}
+
+	store = openStore(t, dir, model.StoreOptions{})
+	defer store.Close()
+	if got := historyJSON(t, store.Model()); `{"a":1,"c":3,"d":4}` != got {
+		t.Errorf(`expected {"a":1,"c":3,"d":4}, received %s`, got)
+	}
+}
+
+func TestStoreWrongType(t *testing.T) {
+	dir := t.TempDir()
+	store := openStore(t, dir, model.StoreOptions{})
+	store.Model().Set("a", 1)
+	store.Compact()
+	store.Close()
+	if _, err := model.OpenStore(dir, stdModel.ModelTypeList, model.StoreOptions{}); !errors.Is(err, model.InvalidDataSet) {
+		t.Errorf("expected InvalidDataSet, received %v", err)
+	}
+}
@@ -0,0 +1,406 @@
+package model
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/bdlm/cast/v2"
+	"github.com/bdlm/errors/v2"
+	stdModel "github.com/bdlm/std/v2/model"
+)
+
+/*
+tomlBareKey matches keys that can be written without quotes.
+*/
+var tomlBareKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+/*
+marshalTOML encodes a hash model as a TOML document.
+
+Tables are emitted in model order, within the constraints of TOML: the
+scalar and array values of a table are written before its sub-tables and
+arrays of tables. List models containing only hash models are written as
+arrays of tables. nil values have no TOML representation and are skipped.
+*/
+func marshalTOML(mdl *Model) ([]byte, error) {
+	if stdModel.ModelTypeHash != mdl.GetType() {
+		return nil, errors.WrapE(InvalidDataSet, errors.Errorf("TOML documents require a hash model"))
+	}
+	buf := &bytes.Buffer{}
+	if err := writeTOMLTable(buf, nil, mdl, nil); nil != err {
+		return nil, err
+	}
+	return bytes.TrimLeft(buf.Bytes(), "\n"), nil
+}
+
+/*
+unmarshalTOML decodes a TOML document into a hash model. Tables are imported
+in document order. TOML datetimes are stored as time.Time values; local
+dates, times and datetimes keep the location used by BurntSushi/toml so
+they are written back in their original form.
+*/
+func unmarshalTOML(data []byte, mdl *Model) error {
+	if stdModel.ModelTypeHash != mdl.GetType() {
+		if err := mdl.SetType(stdModel.ModelTypeHash); nil != err {
+			return errors.WrapE(InvalidDataSet, errors.Errorf("cannot unmarshal a TOML document into a list model"))
+		}
+	}
+
+	doc := map[string]any{}
+	meta, err := toml.Decode(string(data), &doc)
+	if nil != err {
+		return errors.Wrap(err, "unmarshaling failed")
+	}
+
+	// Record the document order of each table's keys.
+	order := map[string][]string{}
+	seen := map[string]bool{}
+	for _, key := range meta.Keys() {
+		full := strings.Join(key, "\x00")
+		if seen[full] {
+			continue
+		}
+		seen[full] = true
+		parent := strings.Join(key[:len(key)-1], "\x00")
+		order[parent] = append(order[parent], key[len(key)-1])
+	}
+
+	importTOMLTable(doc, "", order, mdl)
+	return nil
+}
+
+/*
+importTOMLTable imports a decoded TOML table into mdl, using order to
+restore the document key order.
+*/
+func importTOMLTable(table map[string]any, path string, order map[string][]string, mdl *Model) {
+	keys := make([]string, 0, len(table))
+	added := map[string]bool{}
+	for _, key := range order[path] {
+		if _, ok := table[key]; ok && !added[key] {
+			keys = append(keys, key)
+			added[key] = true
+		}
+	}
+	rest := []string{}
+	for key := range table {
+		if !added[key] {
+			rest = append(rest, key)
+		}
+	}
+	sort.Strings(rest)
+	keys = append(keys, rest...)
+
+	for _, key := range keys {
+		childPath := key
+		if "" != path {
+			childPath = path + "\x00" + key
+		}
+		mdl.Set(key, importTOMLValue(table[key], childPath, order))
+	}
+}
+
+/*
+importTOMLValue converts a decoded TOML value into a model value.
+*/
+func importTOMLValue(val any, path string, order map[string][]string) any {
+	if ref, ok := refFromMap(val); ok {
+		return ref
+	}
+	switch typed := val.(type) {
+	case map[string]any:
+		mdl := New(stdModel.ModelTypeHash)
+		importTOMLTable(typed, path, order, mdl)
+		return mdl
+	case []map[string]any:
+		mdl := New(stdModel.ModelTypeList)
+		for _, table := range typed {
+			mdl.Push(importTOMLValue(table, path, order))
+		}
+		return mdl
+	case []any:
+		mdl := New(stdModel.ModelTypeList)
+		for _, item := range typed {
+			mdl.Push(importTOMLValue(item, path, order))
+		}
+		return mdl
+	}
+	return val
+}
+
+/*
+writeTOMLTable writes the contents of the table at path. visited holds the
+models being written, to detect models that contain themselves.
+*/
+func writeTOMLTable(buf *bytes.Buffer, path []string, mdl *Model, visited []*Model) error {
+	visited, err := tomlVisit(mdl, visited)
+	if nil != err {
+		return err
+	}
+	keys, values := mdl.entries()
+	mdl.mux.Lock()
+	comments := make(map[string]string, len(mdl.comments))
+	for k, v := range mdl.comments {
+		comments[k] = v
+	}
+	mdl.mux.Unlock()
+
+	// Key/value pairs first.
+	for k, v := range values {
+		if nil == v || isTOMLTable(v) || isTOMLTableArray(v) {
+			continue
+		}
+		str, err := tomlValue(v, visited)
+		if nil != err {
+			return errors.Wrap(err, "could not encode '%s'", strings.Join(append(path, keys[k]), "."))
+		}
+		writeTOMLComment(buf, comments[keys[k]])
+		fmt.Fprintf(buf, "%s = %s\n", tomlKey(keys[k]), str)
+	}
+
+	// Then tables and arrays of tables.
+	for k, v := range values {
+		childPath := append(append([]string{}, path...), keys[k])
+		header := tomlPath(childPath)
+		switch {
+		case isTOMLTable(v):
+			buf.WriteString("\n")
+			writeTOMLComment(buf, comments[keys[k]])
+			fmt.Fprintf(buf, "[%s]\n", header)
+			if err := writeTOMLTable(buf, childPath, v.(*Model), visited); nil != err {
+				return err
+			}
+		case isTOMLTableArray(v):
+			_, items := v.(*Model).entries()
+			for a, item := range items {
+				buf.WriteString("\n")
+				if 0 == a {
+					writeTOMLComment(buf, comments[keys[k]])
+				}
+				fmt.Fprintf(buf, "[[%s]]\n", header)
+				if err := writeTOMLTable(buf, childPath, item.(*Model), visited); nil != err {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+/*
+tomlVisit returns visited with mdl added, or a CircularReference error if
+mdl is already being written.
+*/
+func tomlVisit(mdl *Model, visited []*Model) ([]*Model, error) {
+	for _, m := range visited {
+		if m == mdl {
+			return nil, errors.WrapE(CircularReference, errors.Errorf("model contains itself; use a Ref"))
+		}
+	}
+	return append(visited, mdl), nil
+}
+
+/*
+writeTOMLComment writes a key comment as TOML comment lines.
+*/
+func writeTOMLComment(buf *bytes.Buffer, comment string) {
+	if "" == comment {
+		return
+	}
+	for _, line := range strings.Split(comment, "\n") {
+		fmt.Fprintf(buf, "# %s\n", line)
+	}
+}
+
+/*
+isTOMLTable reports whether v is written as a TOML table.
+*/
+func isTOMLTable(v any) bool {
+	mdl, ok := v.(*Model)
+	return ok && stdModel.ModelTypeHash == mdl.GetType()
+}
+
+/*
+isTOMLTableArray reports whether v is written as a TOML array of tables.
+*/
+func isTOMLTableArray(v any) bool {
+	mdl, ok := v.(*Model)
+	if !ok || stdModel.ModelTypeList != mdl.GetType() {
+		return false
+	}
+	_, items := mdl.entries()
+	if 0 == len(items) {
+		return false
+	}
+	for _, item := range items {
+		if !isTOMLTable(item) {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+tomlValue formats a value for use on the right hand side of a TOML key/value
+pair. Hash models are written as inline tables. visited holds the models
+being written.
+*/
+func tomlValue(v any, visited []*Model) (string, error) {
+	switch typed := v.(type) {
+	case *Model:
+		visited, err := tomlVisit(typed, visited)
+		if nil != err {
+			return "", err
+		}
+		keys, values := typed.entries()
+		parts := []string{}
+		for k, item := range values {
+			if nil == item {
+				continue
+			}
+			str, err := tomlValue(item, visited)
+			if nil != err {
+				return "", err
+			}
+			if stdModel.ModelTypeHash == typed.GetType() {
+				str = tomlKey(keys[k]) + " = " + str
+			}
+			parts = append(parts, str)
+		}
+		if stdModel.ModelTypeHash == typed.GetType() {
+			return "{" + strings.Join(parts, ", ") + "}", nil
+		}
+		return "[" + strings.Join(parts, ", ") + "]", nil
+	case Ref:
+		str, err := tomlValue(typed.ID, visited)
+		if nil != err {
+			return "", err
+		}
+		return "{" + tomlKey(refKey) + " = " + str + "}", nil
+	case string:
+		return tomlQuote(typed), nil
+	case []byte:
+		return tomlQuote(string(typed)), nil
+	case bool:
+		return strconv.FormatBool(typed), nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32:
+		return fmt.Sprintf("%d", typed), nil
+	case uint64:
+		if typed > math.MaxInt64 {
+			return "", errors.Errorf("integer %d overflows a TOML integer", typed)
+		}
+		return strconv.FormatUint(typed, 10), nil
+	case float32:
+		return tomlFloat(float64(typed)), nil
+	case float64:
+		return tomlFloat(typed), nil
+	case time.Time:
+		return tomlTime(typed), nil
+	case time.Duration:
+		return tomlQuote(typed.String()), nil
+	case fmt.Stringer:
+		return tomlQuote(typed.String()), nil
+	}
+	str, err := cast.ToE[string](v)
+	if nil != err {
+		return "", err
+	}
+	return tomlQuote(str), nil
+}
+
+/*
+tomlFloat formats a float as a TOML float.
+*/
+func tomlFloat(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "nan"
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	}
+	str := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(str, ".eEn") {
+		str += ".0"
+	}
+	return str
+}
+
+/*
+tomlTime formats a time as a TOML datetime. Local dates, times and datetimes
+decoded by BurntSushi/toml are identified by their location name.
+*/
+func tomlTime(t time.Time) string {
+	switch t.Location().String() {
+	case "datetime-local":
+		return t.Format("2006-01-02T15:04:05.999999999")
+	case "date-local":
+		return t.Format("2006-01-02")
+	case "time-local":
+		return t.Format("15:04:05.999999999")
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+/*
+tomlKey formats a single TOML key, quoting it if required.
+*/
+func tomlKey(key string) string {
+	if tomlBareKey.MatchString(key) {
+		return key
+	}
+	return tomlQuote(key)
+}
+
+/*
+tomlPath formats a dotted TOML table header.
+*/
+func tomlPath(path []string) string {
+	parts := make([]string, len(path))
+	for k, key := range path {
+		parts[k] = tomlKey(key)
+	}
+	return strings.Join(parts, ".")
+}
+
+/*
+tomlQuote formats a TOML basic string.
+*/
+func tomlQuote(str string) string {
+	buf := &strings.Builder{}
+	buf.WriteByte('"')
+	for _, r := range str {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\r':
+			buf.WriteString(`\r`)
+		default:
+			if r < 0x20 || 0x7f == r {
+				fmt.Fprintf(buf, `\u%04X`, r)
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
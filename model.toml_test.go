@@ -0,0 +1,90 @@
+package model_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bdlm/model"
+	stdModel "github.com/bdlm/std/v2/model"
+)
+
+func TestTOMLRoundTrip(t *testing.T) {
+	src := `title = "config"
+created = 2024-01-02T03:04:05Z
+day = 2024-01-02
+ports = [8080, 8081]
+point = {y = 2, x = 1}
+
+[server]
+host = "localhost"
+"dotted.key" = true
+
+[server.tls]
+enabled = false
+
+[[products]]
+name = "hammer"
+sku = 738594937
+
+[[products]]
+name = "nail"
+price = 0.5
+`
+	mdl := model.New(stdModel.ModelTypeHash)
+	mdl.SetFormat(model.FormatTOML)
+	if err := mdl.UnmarshalModel([]byte(src)); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	val, err := mdl.Get("created")
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if created, ok := val.Value().(time.Time); !ok || !created.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("expected datetime to be a time.Time, received %#v", val.Value())
+	}
+
+	out, err := mdl.MarshalModel()
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expect := `title = "config"
+created = 2024-01-02T03:04:05Z
+day = 2024-01-02
+ports = [8080, 8081]
+
+[point]
+y = 2
+x = 1
+
+[server]
+host = "localhost"
+"dotted.key" = true
+
+[server.tls]
+enabled = false
+
+[[products]]
+name = "hammer"
+sku = 738594937
+
+[[products]]
+name = "nail"
+price = 0.5
+`
+	if expect != string(out) {
+		t.Errorf("unexpected TOML output:\n%s", out)
+	}
+
+	mdl.SetComment("title", "document title")
+	out, _ = mdl.MarshalModel()
+	if "# document title\ntitle" != string(out[:22]) {
+		t.Errorf("expected key comment, received:\n%s", out)
+	}
+
+	list := model.New(stdModel.ModelTypeList)
+	list.SetFormat(model.FormatTOML)
+	if _, err := list.MarshalModel(); nil == err {
+		t.Errorf("expected an error marshaling a list model as TOML")
+	}
+}
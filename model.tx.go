@@ -0,0 +1,285 @@
+package model
+
+import (
+	"github.com/bdlm/cast/v2"
+	"github.com/bdlm/errors/v2"
+	stdModel "github.com/bdlm/std/v2/model"
+)
+
+/*
+Tx is a transaction on a model, created by Begin. Changes made through a Tx,
+including changes to models nested within it, are staged on a private copy
+of the model and are not visible outside the transaction until Commit.
+
+A Tx is not safe for concurrent use.
+*/
+type Tx struct {
+	mdl  *Model
+	work *Model // private copy receiving staged changes
+	ops  []txOp
+	sub  *Subscription
+	done bool
+}
+
+/*
+txOp is a staged change.
+*/
+type txOp struct {
+	typ   EventType
+	path  []any // path to the changed key, or to the model for EventReplace and EventReorder
+	index int   // position of the inserted value in a list model
+	value any   // copy of the new value
+}
+
+/*
+Begin starts a transaction on this model.
+*/
+func (mdl *Model) Begin() *Tx {
+	tx := &Tx{mdl: mdl, work: mdl.copy()}
+	tx.sub = tx.work.Subscribe(tx.record)
+	return tx
+}
+
+/*
+Model returns the transaction's copy of the model. Changes made to it, or to
+models nested within it, are staged in the transaction.
+*/
+func (tx *Tx) Model() *Model {
+	return tx.work
+}
+
+/*
+Get returns the specified data value as seen inside the transaction.
+*/
+func (tx *Tx) Get(key any) (stdModel.Value, error) {
+	return tx.work.Get(key)
+}
+
+/*
+Has tests to see if a specified data element exists inside the transaction.
+*/
+func (tx *Tx) Has(key any) bool {
+	return tx.work.Has(key)
+}
+
+/*
+Set stages storing a value. Models are copied, so later changes to value do
+not affect the transaction.
+*/
+func (tx *Tx) Set(key any, value any) error {
+	if err := tx.check(); nil != err {
+		return err
+	}
+	return tx.work.Set(key, txCopy(value))
+}
+
+/*
+Push stages pushing a value to the end of a list model. Models are copied,
+so later changes to value do not affect the transaction.
+*/
+func (tx *Tx) Push(value any) error {
+	if err := tx.check(); nil != err {
+		return err
+	}
+	return tx.work.Push(txCopy(value))
+}
+
+/*
+Delete stages removing a value.
+*/
+func (tx *Tx) Delete(key any) error {
+	if err := tx.check(); nil != err {
+		return err
+	}
+	return tx.work.Delete(key)
+}
+
+/*
+SetData stages replacing all data.
+*/
+func (tx *Tx) SetData(data any) error {
+	if err := tx.check(); nil != err {
+		return err
+	}
+	return tx.work.SetData(txCopyData(data))
+}
+
+/*
+Commit applies the staged changes to the model in order, notifying
+subscribers of each. If a change cannot be applied, for example because the
+model was changed concurrently and a staged key no longer exists, the
+changes already applied are reverted and an error is returned. Other
+goroutines may see the changes while they are applied and reverted. The
+transaction is closed in either case.
+*/
+func (tx *Tx) Commit() error {
+	if err := tx.close(); nil != err {
+		return err
+	}
+
+	undo := make([]*historyOp, 0, len(tx.ops))
+	for _, op := range tx.ops {
+		evt, err := op.apply(tx.mdl)
+		if nil != err {
+			err = errors.Wrap(err, "could not commit transaction")
+			for k := len(undo) - 1; k >= 0; k-- {
+				if undoErr := undo[k].undo(); nil != undoErr {
+					return errors.Wrap(undoErr, "could not roll back transaction: %s", err)
+				}
+			}
+			return err
+		}
+		if inverse := historyInverse(evt); nil != inverse {
+			undo = append(undo, inverse)
+		}
+	}
+	return nil
+}
+
+/*
+Rollback discards the staged changes and closes the transaction.
+*/
+func (tx *Tx) Rollback() error {
+	return tx.close()
+}
+
+/*
+check returns an error if the transaction is closed.
+*/
+func (tx *Tx) check() error {
+	if tx.done {
+		return errors.WrapE(InvalidMethodContext, errors.Errorf("transaction is closed"))
+	}
+	return nil
+}
+
+/*
+close closes the transaction.
+*/
+func (tx *Tx) close() error {
+	if err := tx.check(); nil != err {
+		return err
+	}
+	tx.done = true
+	tx.sub.Cancel()
+	return nil
+}
+
+/*
+record stages a change made to the transaction's copy of the model.
+*/
+func (tx *Tx) record(evt Event) {
+	op := txOp{typ: evt.Type, path: append([]any{}, evt.Path...), index: evt.index}
+	switch evt.Type {
+	case EventSet, EventInsert:
+		op.value = txCopy(evt.New)
+	case EventReplace:
+		op.value = txCopyData(evt.New)
+	}
+	tx.ops = append(tx.ops, op)
+}
+
+/*
+apply applies the change to root and returns the change event.
+*/
+func (op txOp) apply(root *Model) (Event, error) {
+	path := op.path
+	var key any
+	switch op.typ {
+	case EventSet, EventInsert, EventDelete:
+		if 0 == len(path) {
+			return Event{}, errors.WrapE(InvalidIndex, errors.Errorf("missing key"))
+		}
+		path, key = path[:len(path)-1], path[len(path)-1]
+	}
+
+	node := root
+	for _, step := range path {
+		child, err := node.childModel(step)
+		if nil != err {
+			return Event{}, err
+		}
+		node = child
+	}
+
+	return node.change(func() (Event, error) {
+		switch op.typ {
+		case EventSet:
+			return node.setLocked(key, op.value)
+		case EventInsert:
+			if stdModel.ModelTypeList == node.GetType() {
+				return node.insertLocked(op.index, key, op.value)
+			}
+			return node.setLocked(key, op.value)
+		case EventDelete:
+			return node.deleteLocked(key)
+		case EventReplace:
+			prev, err := node.setDataLocked(op.value)
+			if nil != err {
+				return Event{}, err
+			}
+			return Event{Type: EventReplace, Path: []any{}, prev: prev, New: op.value}, nil
+		}
+		evt := Event{Type: EventReorder, Path: []any{}}
+		if stdModel.ModelTypeHash == node.GetType() {
+			evt.prev = node.keyOrderLocked()
+			node.sortByKeyLocked()
+		}
+		return evt, nil
+	})
+}
+
+/*
+childModel returns the nested model stored at key.
+*/
+func (mdl *Model) childModel(key any) (*Model, error) {
+	mdl.mux.Lock()
+	defer mdl.mux.Unlock()
+	idx := -1
+	if stdModel.ModelTypeHash == mdl.GetType() {
+		if pos, ok := mdl.hashIdx[cast.To[string](key)]; ok {
+			idx = pos
+		}
+	} else if pos, err := cast.ToE[int](key); nil == err && pos >= 0 && pos < len(mdl.data) {
+		idx = pos
+	}
+	if idx < 0 {
+		return nil, errors.WrapE(InvalidIndex, errors.Errorf("key '%v' does not exist", key))
+	}
+	child, ok := unwrap(mdl.data[idx]).(*Model)
+	if !ok || nil == child {
+		return nil, errors.WrapE(InvalidIndex, errors.Errorf("key '%v' is not a model", key))
+	}
+	return child, nil
+}
+
+/*
+txCopy copies model values.
+*/
+func txCopy(value any) any {
+	if mdl, ok := unwrap(value).(*Model); ok && nil != mdl {
+		return mdl.copy()
+	}
+	return value
+}
+
+/*
+txCopyData copies the models in a data set passed to SetData.
+*/
+func txCopyData(data any) any {
+	switch typed := data.(type) {
+	case []any:
+		copied := make([]any, len(typed))
+		for k, v := range typed {
+			copied[k] = txCopy(v)
+		}
+		return copied
+	case map[string]any:
+		copied := make(map[string]any, len(typed))
+		for k, v := range typed {
+			copied[k] = txCopy(v)
+		}
+		return copied
+	}
+	return data
+}
@@ -0,0 +1,119 @@
+package model_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bdlm/model"
+	stdModel "github.com/bdlm/std/v2/model"
+)
+
+func txModel(t *testing.T) *model.Model {
+	t.Helper()
+	mdl := model.New(stdModel.ModelTypeHash)
+	if err := mdl.UnmarshalJSON([]byte(`{"db": {"host": "localhost", "port": 5432}, "tags": ["a"], "debug": false}`)); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return mdl
+}
+
+func TestTxCommit(t *testing.T) {
+	mdl := txModel(t)
+	events := []string{}
+	mdl.Subscribe(func(evt model.Event) {
+		events = append(events, evt.Type.String()+" "+evt.PathString())
+	})
+
+	tx := mdl.Begin()
+	tx.Set("debug", true)
+	tx.Delete("tags")
+	val, _ := tx.Get("db")
+	db, _ := val.Model()
+	db.Set("host", "db.internal")
+	list := model.New(stdModel.ModelTypeList)
+	tx.Set("extra", list)
+	list.Push("outside")
+	extra, _ := tx.Get("extra")
+	staged, _ := extra.Model()
+	staged.Push("inside")
+
+	if val, _ := mdl.Get("debug"); false != val.Value() {
+		t.Errorf("expected staged changes to be invisible, received %v", val.Value())
+	}
+	if !mdl.Has("tags") || 0 != len(events) {
+		t.Errorf("expected the model to be unchanged before Commit")
+	}
+	if val, _ := tx.Get("debug"); true != val.Value() {
+		t.Errorf("expected staged changes to be visible in the transaction")
+	}
+
+	if err := tx.Commit(); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, _ := mdl.MarshalJSON()
+	if `{"db":{"host":"db.internal","port":5432},"debug":true,"extra":["inside"]}` != string(data) {
+		t.Errorf("unexpected data %s", data)
+	}
+	expected := []string{"set debug", "delete tags", "set db.host", "insert extra", "insert extra[0]"}
+	if len(expected) != len(events) {
+		t.Fatalf("expected events %v, received %v", expected, events)
+	}
+	for k := range expected {
+		if expected[k] != events[k] {
+			t.Errorf("expected event %q, received %q", expected[k], events[k])
+		}
+	}
+
+	if err := tx.Commit(); !errors.Is(err, model.InvalidMethodContext) {
+		t.Errorf("expected InvalidMethodContext, received %v", err)
+	}
+	if err := tx.Set("a", 1); !errors.Is(err, model.InvalidMethodContext) {
+		t.Errorf("expected InvalidMethodContext, received %v", err)
+	}
+}
+
+func TestTxRollback(t *testing.T) {
+	mdl := txModel(t)
+	tx := mdl.Begin()
+	tx.Set("debug", true)
+	tx.Delete("db")
+	if err := tx.Rollback(); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if val, _ := mdl.Get("debug"); false != val.Value() || !mdl.Has("db") {
+		t.Errorf("expected the model to be unchanged")
+	}
+}
+
+func TestTxConflict(t *testing.T) {
+	mdl := txModel(t)
+	tx := mdl.Begin()
+	tx.Set("debug", true)
+	val, _ := tx.Get("db")
+	db, _ := val.Model()
+	db.Set("host", "db.internal")
+
+	mdl.Delete("db")
+	if err := tx.Commit(); !errors.Is(err, model.InvalidIndex) {
+		t.Errorf("expected InvalidIndex, received %v", err)
+	}
+	if val, _ := mdl.Get("debug"); false != val.Value() {
+		t.Errorf("expected no changes to be applied")
+	}
+}
+
+func TestTxInsert(t *testing.T) {
+	mdl := txModel(t)
+	tx := mdl.Begin()
+	insert := model.Op{Type: model.EventInsert, Path: []any{"tags", 0}, Index: 0, Value: "z"}
+	if err := insert.Apply(tx.Model()); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := tx.Commit(); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := `{"db":{"host":"localhost","port":5432},"debug":false,"tags":["z","a"]}`
+	if data, _ := mdl.MarshalJSON(); expected != string(data) {
+		t.Errorf("expected %s, received %s", expected, data)
+	}
+}
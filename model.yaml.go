@@ -0,0 +1,265 @@
+package model
+
+import (
+	"strings"
+
+	"github.com/bdlm/errors/v2"
+	stdModel "github.com/bdlm/std/v2/model"
+	"gopkg.in/yaml.v3"
+)
+
+/*
+MarshalYAML implements yaml.Marshaler.
+
+Hash models are emitted as mappings in model order with any key comments
+attached, list models are emitted as sequences.
+*/
+func (mdl *Model) MarshalYAML() (any, error) {
+	return mdl.yamlNode(nil, false)
+}
+
+/*
+UnmarshalYAML implements yaml.Unmarshaler.
+
+Mappings are imported as hash models in document order and sequences as list
+models. Aliases are resolved and merge keys ("<<") are applied. Head
+comments on mapping keys are stored as key comments, see Comment.
+*/
+func (mdl *Model) UnmarshalYAML(node *yaml.Node) error {
+	if yaml.DocumentNode == node.Kind && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	node = resolveAlias(node)
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		if stdModel.ModelTypeHash != mdl.GetType() {
+			if err := mdl.SetType(stdModel.ModelTypeHash); nil != err {
+				return errors.WrapE(InvalidDataSet, errors.Errorf("cannot unmarshal a YAML mapping into a list model"))
+			}
+		}
+	case yaml.SequenceNode:
+		if stdModel.ModelTypeList != mdl.GetType() {
+			if err := mdl.SetType(stdModel.ModelTypeList); nil != err {
+				return errors.WrapE(InvalidDataSet, errors.Errorf("cannot unmarshal a YAML sequence into a hash model"))
+			}
+		}
+	case yaml.ScalarNode:
+		if "!!null" == node.ShortTag() {
+			return nil
+		}
+		return errors.WrapE(InvalidDataSet, errors.Errorf("cannot unmarshal a YAML scalar into a model (line %d)", node.Line))
+	default:
+		return errors.WrapE(InvalidDataSet, errors.Errorf("cannot unmarshal YAML node (line %d)", node.Line))
+	}
+
+	return importYAML(node, mdl, map[*yaml.Node]bool{})
+}
+
+/*
+yamlNode builds the YAML node tree for this model. visited holds the models
+being built, to detect models that contain themselves. If omitNull is set,
+or set on a model with SetOmitNull, null hash values are left out.
+*/
+func (mdl *Model) yamlNode(visited []*Model, omitNull bool) (*yaml.Node, error) {
+	for _, m := range visited {
+		if m == mdl {
+			return nil, errors.WrapE(CircularReference, errors.Errorf("model contains itself; use a Ref"))
+		}
+	}
+	visited = append(visited, mdl)
+	omitNull = omitNull || mdl.omitNull
+	keys, values := mdl.entries()
+	mdl.mux.Lock()
+	comments := make(map[string]string, len(mdl.comments))
+	for k, v := range mdl.comments {
+		comments[k] = v
+	}
+	mdl.mux.Unlock()
+
+	node := &yaml.Node{Kind: yaml.SequenceNode}
+	if stdModel.ModelTypeHash == mdl.GetType() {
+		node.Kind = yaml.MappingNode
+	}
+	for k, v := range values {
+		if omitNull && yaml.MappingNode == node.Kind && isNull(v) {
+			continue
+		}
+		valNode, err := yamlValueNode(v, visited, omitNull)
+		if nil != err {
+			return nil, err
+		}
+		if yaml.MappingNode == node.Kind {
+			keyNode := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: keys[k]}
+			if comment, ok := comments[keys[k]]; ok {
+				keyNode.HeadComment = yamlComment(comment)
+			}
+			node.Content = append(node.Content, keyNode)
+		}
+		node.Content = append(node.Content, valNode)
+	}
+	return node, nil
+}
+
+/*
+yamlValueNode builds the YAML node for a single model value.
+*/
+func yamlValueNode(v any, visited []*Model, omitNull bool) (*yaml.Node, error) {
+	if mdl, ok := v.(*Model); ok {
+		return mdl.yamlNode(visited, omitNull)
+	}
+	node := &yaml.Node{}
+	if err := node.Encode(v); nil != err {
+		return nil, errors.Wrap(err, "could not encode value '%v'", v)
+	}
+	return node, nil
+}
+
+/*
+yamlComment formats a key comment as YAML comment lines.
+*/
+func yamlComment(comment string) string {
+	lines := strings.Split(comment, "\n")
+	for k, line := range lines {
+		lines[k] = "# " + line
+	}
+	return strings.Join(lines, "\n")
+}
+
+/*
+importYAML imports the contents of a mapping or sequence node into mdl.
+active tracks aliased nodes currently being imported to prevent infinite
+recursion.
+*/
+func importYAML(node *yaml.Node, mdl *Model, active map[*yaml.Node]bool) error {
+	if active[node] {
+		return errors.WrapE(CircularReference, errors.Errorf("YAML alias refers to itself (line %d)", node.Line))
+	}
+	active[node] = true
+	defer delete(active, node)
+
+	if yaml.SequenceNode == node.Kind {
+		for _, item := range node.Content {
+			val, err := yamlValue(item, active)
+			if nil != err {
+				return err
+			}
+			mdl.Push(val)
+		}
+		return nil
+	}
+
+	// Explicit keys take precedence over merged keys.
+	explicit := map[string]bool{}
+	for a := 0; a+1 < len(node.Content); a += 2 {
+		if "!!merge" != node.Content[a].ShortTag() {
+			explicit[node.Content[a].Value] = true
+		}
+	}
+
+	for a := 0; a+1 < len(node.Content); a += 2 {
+		keyNode, valNode := node.Content[a], node.Content[a+1]
+		if yaml.ScalarNode != keyNode.Kind {
+			return errors.WrapE(InvalidIndexType, errors.Errorf("YAML mapping keys must be scalars (line %d)", keyNode.Line))
+		}
+
+		if "!!merge" == keyNode.ShortTag() {
+			if err := mergeYAML(valNode, mdl, explicit, active); nil != err {
+				return err
+			}
+			continue
+		}
+
+		val, err := yamlValue(valNode, active)
+		if nil != err {
+			return err
+		}
+		mdl.Set(keyNode.Value, val)
+		if comment := strings.TrimSpace(keyNode.HeadComment); "" != comment {
+			mdl.SetComment(keyNode.Value, parseYAMLComment(comment))
+		}
+	}
+	return nil
+}
+
+/*
+mergeYAML applies a merge key value, a mapping or a sequence of mappings, to
+mdl. Keys already present, explicitly or from an earlier merge, are not
+overwritten.
+*/
+func mergeYAML(node *yaml.Node, mdl *Model, explicit map[string]bool, active map[*yaml.Node]bool) error {
+	node = resolveAlias(node)
+	sources := []*yaml.Node{node}
+	if yaml.SequenceNode == node.Kind {
+		sources = node.Content
+	}
+	for _, src := range sources {
+		src = resolveAlias(src)
+		if yaml.MappingNode != src.Kind {
+			return errors.WrapE(InvalidDataSet, errors.Errorf("YAML merge value must be a mapping (line %d)", src.Line))
+		}
+		merged := New(stdModel.ModelTypeHash)
+		if err := importYAML(src, merged, active); nil != err {
+			return err
+		}
+		keys, values := merged.entries()
+		for k, key := range keys {
+			if explicit[key] || mdl.Has(key) {
+				continue
+			}
+			mdl.Set(key, values[k])
+		}
+	}
+	return nil
+}
+
+/*
+yamlValue converts a YAML node into a model value.
+*/
+func yamlValue(node *yaml.Node, active map[*yaml.Node]bool) (any, error) {
+	node = resolveAlias(node)
+	switch node.Kind {
+	case yaml.MappingNode:
+		if 2 == len(node.Content) && refKey == node.Content[0].Value && yaml.ScalarNode == node.Content[1].Kind {
+			var id any
+			if err := node.Content[1].Decode(&id); nil != err {
+				return nil, errors.Wrap(err, "could not decode YAML reference (line %d)", node.Line)
+			}
+			return Ref{ID: id}, nil
+		}
+		mdl := New(stdModel.ModelTypeHash)
+		return mdl, importYAML(node, mdl, active)
+	case yaml.SequenceNode:
+		mdl := New(stdModel.ModelTypeList)
+		return mdl, importYAML(node, mdl, active)
+	}
+
+	var val any
+	if err := node.Decode(&val); nil != err {
+		return nil, errors.Wrap(err, "could not decode YAML value (line %d)", node.Line)
+	}
+	return val, nil
+}
+
+/*
+resolveAlias returns the node an alias refers to.
+*/
+func resolveAlias(node *yaml.Node) *yaml.Node {
+	for yaml.AliasNode == node.Kind && nil != node.Alias {
+		node = node.Alias
+	}
+	return node
+}
+
+/*
+parseYAMLComment strips comment markers from YAML comment lines.
+*/
+func parseYAMLComment(comment string) string {
+	lines := strings.Split(comment, "\n")
+	for k, line := range lines {
+		line = strings.TrimSpace(line)
+		line = strings.TrimPrefix(line, "#")
+		lines[k] = strings.TrimPrefix(line, " ")
+	}
+	return strings.Join(lines, "\n")
+}
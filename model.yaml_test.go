@@ -0,0 +1,86 @@
+package model_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bdlm/model"
+	stdModel "github.com/bdlm/std/v2/model"
+	"gopkg.in/yaml.v3"
+)
+
+func TestYAMLRoundTrip(t *testing.T) {
+	src := `# service name
+name: api
+defaults: &defaults
+  timeout: 30
+  retries: 3
+zeta: last
+db:
+  <<: *defaults
+  retries: 5
+  hosts:
+    - a
+    - b
+`
+	mdl := model.New(stdModel.ModelTypeHash)
+	mdl.SetFormat(model.FormatYAML)
+	if err := mdl.UnmarshalModel([]byte(src)); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var key, val interface{}
+	order := []string{}
+	for mdl.Next(&key, &val) {
+		order = append(order, key.(string))
+	}
+	if "name,defaults,zeta,db" != strings.Join(order, ",") {
+		t.Errorf("expected document order, received %v", order)
+	}
+	if "service name" != mdl.Comment("name") {
+		t.Errorf("expected key comment, received '%s'", mdl.Comment("name"))
+	}
+
+	val, _ = mdl.Get("db")
+	db, _ := val.(stdModel.Value).Model()
+	retries, _ := db.Get("retries")
+	if n, _ := retries.Int(); 5 != n {
+		t.Errorf("expected explicit key to override merge key, received %v", retries.Value())
+	}
+	timeout, err := db.Get("timeout")
+	if nil != err {
+		t.Fatalf("expected merged key 'timeout': %v", err)
+	}
+	if n, _ := timeout.Int(); 30 != n {
+		t.Errorf("expected merged timeout 30, received %v", timeout.Value())
+	}
+
+	out, err := mdl.MarshalModel()
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expect := `# service name
+name: api
+defaults:
+    timeout: 30
+    retries: 3
+zeta: last
+db:
+    timeout: 30
+    retries: 5
+    hosts:
+        - a
+        - b
+`
+	if expect != string(out) {
+		t.Errorf("unexpected YAML output:\n%s", out)
+	}
+
+	list := model.New(stdModel.ModelTypeList)
+	if err := yaml.Unmarshal([]byte("- 1\n- [2, 3]\n"), list); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := yaml.Unmarshal([]byte("a: 1\n"), list); nil == err {
+		t.Errorf("expected an error unmarshaling a mapping into a non-empty list model")
+	}
+}
@@ -0,0 +1,173 @@
+package model
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/bdlm/cast/v2"
+	"github.com/bdlm/errors/v2"
+)
+
+/*
+structField describes a single exported struct field and the model key it
+maps to.
+*/
+type structField struct {
+	name      string       // model key
+	index     []int        // reflect field index path, including embedded structs
+	typ       reflect.Type // field type
+	omitEmpty bool         // omit zero values when encoding
+	tagged    bool         // name was provided by a struct tag
+}
+
+/*
+fieldCache caches the structField list for each struct type.
+*/
+var fieldCache sync.Map // map[reflect.Type][]structField
+
+/*
+parseTag reads the model key and options for a struct field. The `model`
+tag is preferred, falling back to the `json` tag.
+*/
+func parseTag(fld reflect.StructField) (name string, omitEmpty, skip bool) {
+	tag, ok := fld.Tag.Lookup("model")
+	if !ok {
+		tag, ok = fld.Tag.Lookup("json")
+	}
+	if !ok {
+		return "", false, false
+	}
+	if "-" == tag {
+		return "", false, true
+	}
+	parts := strings.Split(tag, ",")
+	for _, opt := range parts[1:] {
+		if "omitempty" == opt {
+			omitEmpty = true
+		}
+	}
+	return parts[0], omitEmpty, false
+}
+
+/*
+structFields returns the model fields of the struct type t. Fields of
+untagged embedded structs are promoted to the parent, with shallower fields
+taking precedence over deeper ones.
+*/
+func structFields(t reflect.Type) []structField {
+	if cached, ok := fieldCache.Load(t); ok {
+		return cached.([]structField)
+	}
+
+	fields := []structField{}
+	depth := map[string]int{}
+	var walk func(t reflect.Type, index []int, level int, visited map[reflect.Type]bool)
+	walk = func(t reflect.Type, index []int, level int, visited map[reflect.Type]bool) {
+		if visited[t] {
+			return
+		}
+		visited[t] = true
+		defer delete(visited, t)
+
+		for a := 0; a < t.NumField(); a++ {
+			fld := t.Field(a)
+			name, omitEmpty, skip := parseTag(fld)
+			if skip {
+				continue
+			}
+			idx := append(append([]int{}, index...), a)
+
+			ft := fld.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if fld.Anonymous && "" == name && ft.Kind() == reflect.Struct {
+				walk(ft, idx, level+1, visited)
+				continue
+			}
+			if !fld.IsExported() {
+				continue
+			}
+
+			tagged := "" != name
+			if !tagged {
+				name = fld.Name
+			}
+			if lvl, ok := depth[name]; ok {
+				if lvl <= level {
+					continue
+				}
+				for b := range fields {
+					if fields[b].name == name {
+						fields = append(fields[:b], fields[b+1:]...)
+						break
+					}
+				}
+			}
+			depth[name] = level
+			fields = append(fields, structField{
+				name:      name,
+				index:     idx,
+				typ:       fld.Type,
+				omitEmpty: omitEmpty,
+				tagged:    tagged,
+			})
+		}
+	}
+	walk(t, nil, 0, map[reflect.Type]bool{})
+
+	fieldCache.Store(t, fields)
+	return fields
+}
+
+/*
+castScalar converts src to the scalar type t using bdlm/cast.
+*/
+func castScalar(src any, t reflect.Type) (reflect.Value, error) {
+	var val any
+	var err error
+
+	switch t.Kind() {
+	case reflect.Bool:
+		val, err = cast.ToE[bool](src)
+	case reflect.Int:
+		val, err = cast.ToE[int](src)
+	case reflect.Int8:
+		val, err = cast.ToE[int8](src)
+	case reflect.Int16:
+		val, err = cast.ToE[int16](src)
+	case reflect.Int32:
+		val, err = cast.ToE[int32](src)
+	case reflect.Int64:
+		val, err = cast.ToE[int64](src)
+	case reflect.Uint:
+		val, err = cast.ToE[uint](src)
+	case reflect.Uint8:
+		val, err = cast.ToE[uint8](src)
+	case reflect.Uint16:
+		val, err = cast.ToE[uint16](src)
+	case reflect.Uint32:
+		val, err = cast.ToE[uint32](src)
+	case reflect.Uint64:
+		val, err = cast.ToE[uint64](src)
+	case reflect.Uintptr:
+		val, err = cast.ToE[uintptr](src)
+	case reflect.Float32:
+		val, err = cast.ToE[float32](src)
+	case reflect.Float64:
+		val, err = cast.ToE[float64](src)
+	case reflect.Complex64:
+		val, err = cast.ToE[complex64](src)
+	case reflect.Complex128:
+		val, err = cast.ToE[complex128](src)
+	case reflect.String:
+		val, err = cast.ToE[string](src)
+	default:
+		return reflect.Value{}, errors.Errorf("unsupported type %s", t)
+	}
+	if nil != err {
+		return reflect.Value{}, err
+	}
+	return reflect.ValueOf(val).Convert(t), nil
+}
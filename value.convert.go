@@ -0,0 +1,542 @@
+package model
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/bdlm/cast/v2"
+	"github.com/bdlm/errors/v2"
+)
+
+/*
+Int8 returns the int8 representation of the value of this node, or an error
+if the type conversion is not possible or the value overflows an int8.
+*/
+func (val *Value) Int8() (int8, error) {
+	return valueInt[int8](val)
+}
+
+/*
+Int16 returns the int16 representation of the value of this node, or an
+error if the type conversion is not possible or the value overflows an
+int16.
+*/
+func (val *Value) Int16() (int16, error) {
+	return valueInt[int16](val)
+}
+
+/*
+Int32 returns the int32 representation of the value of this node, or an
+error if the type conversion is not possible or the value overflows an
+int32.
+*/
+func (val *Value) Int32() (int32, error) {
+	return valueInt[int32](val)
+}
+
+/*
+Int64 returns the int64 representation of the value of this node, or an
+error if the type conversion is not possible or the value overflows an
+int64.
+*/
+func (val *Value) Int64() (int64, error) {
+	return valueInt[int64](val)
+}
+
+/*
+Uint returns the uint representation of the value of this node, or an error
+if the type conversion is not possible, the value is negative or it
+overflows a uint.
+*/
+func (val *Value) Uint() (uint, error) {
+	return valueUint[uint](val)
+}
+
+/*
+Uint8 returns the uint8 representation of the value of this node, or an
+error if the type conversion is not possible, the value is negative or it
+overflows a uint8.
+*/
+func (val *Value) Uint8() (uint8, error) {
+	return valueUint[uint8](val)
+}
+
+/*
+Uint16 returns the uint16 representation of the value of this node, or an
+error if the type conversion is not possible, the value is negative or it
+overflows a uint16.
+*/
+func (val *Value) Uint16() (uint16, error) {
+	return valueUint[uint16](val)
+}
+
+/*
+Uint32 returns the uint32 representation of the value of this node, or an
+error if the type conversion is not possible, the value is negative or it
+overflows a uint32.
+*/
+func (val *Value) Uint32() (uint32, error) {
+	return valueUint[uint32](val)
+}
+
+/*
+Uint64 returns the uint64 representation of the value of this node, or an
+error if the type conversion is not possible or the value is negative.
+*/
+func (val *Value) Uint64() (uint64, error) {
+	return valueUint[uint64](val)
+}
+
+/*
+Time returns the time.Time value of this node. Strings are parsed with the
+given layouts, tried in order, or by default with RFC 3339 with
+nanoseconds, RFC 3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05" and
+"2006-01-02". Numbers are read as seconds since the Unix epoch.
+*/
+func (val *Value) Time(layouts ...string) (time.Time, error) {
+	if val.IsNull() {
+		return time.Time{}, val.nullError()
+	}
+	if 0 == len(layouts) {
+		layouts = timeLayouts
+	}
+	switch typed := val.data.(type) {
+	case time.Time:
+		return typed, nil
+	case *time.Time:
+		return *typed, nil
+	case string:
+		for _, layout := range layouts {
+			if t, err := time.Parse(layout, typed); nil == err {
+				return t, nil
+			}
+		}
+		return time.Time{}, errors.Errorf("could not parse '%s' as a time", typed)
+	}
+	switch kindOf(val.data) {
+	case KindInt:
+		sec, err := val.Int64()
+		if nil != err {
+			return time.Time{}, err
+		}
+		return time.Unix(sec, 0).UTC(), nil
+	case KindFloat:
+		sec, err := val.Float64()
+		if nil != err {
+			return time.Time{}, err
+		}
+		whole, frac := math.Modf(sec)
+		return time.Unix(int64(whole), int64(frac*1e9)).UTC(), nil
+	}
+	return time.Time{}, errors.Errorf("could not convert value '%v' to a time", val.data)
+}
+
+/*
+Duration returns the time.Duration value of this node. Strings are parsed
+with time.ParseDuration and numbers are read as nanoseconds.
+*/
+func (val *Value) Duration() (time.Duration, error) {
+	if val.IsNull() {
+		return 0, val.nullError()
+	}
+	if str, ok := val.data.(string); ok {
+		d, err := time.ParseDuration(str)
+		if nil != err {
+			err = errors.Wrap(err, "could not convert value '%v' to a duration", val.data)
+		}
+		return d, err
+	}
+	if KindInt != kindOf(val.data) && KindFloat != kindOf(val.data) {
+		return 0, errors.Errorf("could not convert value '%v' to a duration", val.data)
+	}
+	ns, err := val.Int64()
+	return time.Duration(ns), err
+}
+
+/*
+Bytes returns the []byte value of this node. Strings are decoded as base64,
+standard or URL-safe and padded or not, the way encoding/json encodes byte
+slices.
+*/
+func (val *Value) Bytes() ([]byte, error) {
+	if val.IsNull() {
+		return nil, val.nullError()
+	}
+	switch typed := val.data.(type) {
+	case []byte:
+		return typed, nil
+	case string:
+		for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+			if data, err := enc.DecodeString(typed); nil == err {
+				return data, nil
+			}
+		}
+		return nil, errors.Errorf("could not decode value '%v' as base64", val.data)
+	}
+	return nil, errors.Errorf("could not convert value '%v' to bytes", val.data)
+}
+
+/*
+BigInt returns the *big.Int representation of the value of this node, or an
+error if the type conversion is not possible. Floats must be integral.
+*/
+func (val *Value) BigInt() (*big.Int, error) {
+	if val.IsNull() {
+		return nil, val.nullError()
+	}
+	switch typed := val.data.(type) {
+	case *big.Int:
+		return new(big.Int).Set(typed), nil
+	case *big.Float:
+		if i, acc := typed.Int(nil); big.Exact == acc {
+			return i, nil
+		}
+	case string, json.Number:
+		str := cast.To[string](typed)
+		if i, ok := new(big.Int).SetString(str, 10); ok {
+			return i, nil
+		}
+		if f, _, err := big.ParseFloat(str, 10, 0, big.ToNearestEven); nil == err {
+			if i, acc := f.Int(nil); big.Exact == acc {
+				return i, nil
+			}
+		}
+	default:
+		rv := reflect.ValueOf(typed)
+		switch kindOf(typed) {
+		case KindInt:
+			if rv.CanUint() {
+				return new(big.Int).SetUint64(rv.Uint()), nil
+			}
+			return big.NewInt(rv.Int()), nil
+		case KindFloat:
+			if f := rv.Float(); !math.IsInf(f, 0) && !math.IsNaN(f) {
+				if i, acc := big.NewFloat(f).Int(nil); big.Exact == acc {
+					return i, nil
+				}
+			}
+		}
+	}
+	return nil, errors.Errorf("could not convert value '%v' to a big.Int", val.data)
+}
+
+/*
+BigFloat returns the *big.Float representation of the value of this node,
+or an error if the type conversion is not possible.
+*/
+func (val *Value) BigFloat() (*big.Float, error) {
+	if val.IsNull() {
+		return nil, val.nullError()
+	}
+	switch typed := val.data.(type) {
+	case *big.Float:
+		return new(big.Float).Copy(typed), nil
+	case *big.Int:
+		return new(big.Float).SetInt(typed), nil
+	case string, json.Number:
+		if f, _, err := big.ParseFloat(cast.To[string](typed), 10, 0, big.ToNearestEven); nil == err {
+			return f, nil
+		}
+	default:
+		rv := reflect.ValueOf(typed)
+		switch kindOf(typed) {
+		case KindInt:
+			if rv.CanUint() {
+				return new(big.Float).SetUint64(rv.Uint()), nil
+			}
+			return new(big.Float).SetInt64(rv.Int()), nil
+		case KindFloat:
+			if f := rv.Float(); !math.IsNaN(f) {
+				return big.NewFloat(f), nil
+			}
+		}
+	}
+	return nil, errors.Errorf("could not convert value '%v' to a big.Float", val.data)
+}
+
+/*
+Number returns the json.Number representation of the value of this node.
+json.Number values are passed through unchanged, so numbers decoded with
+json.Decoder.UseNumber keep their full precision.
+*/
+func (val *Value) Number() (json.Number, error) {
+	if val.IsNull() {
+		return "", val.nullError()
+	}
+	switch typed := val.data.(type) {
+	case json.Number:
+		return typed, nil
+	case string:
+		if _, err := strconv.ParseFloat(typed, 64); nil == err {
+			return json.Number(typed), nil
+		}
+	case *big.Int:
+		return json.Number(typed.String()), nil
+	case *big.Float:
+		return json.Number(typed.Text('g', -1)), nil
+	default:
+		rv := reflect.ValueOf(typed)
+		switch kindOf(typed) {
+		case KindInt:
+			if rv.CanUint() {
+				return json.Number(strconv.FormatUint(rv.Uint(), 10)), nil
+			}
+			return json.Number(strconv.FormatInt(rv.Int(), 10)), nil
+		case KindFloat:
+			if f := rv.Float(); !math.IsInf(f, 0) && !math.IsNaN(f) {
+				return json.Number(strconv.FormatFloat(f, 'g', -1, rv.Type().Bits())), nil
+			}
+		}
+	}
+	return "", errors.Errorf("could not convert value '%v' to a number", val.data)
+}
+
+/*
+BoolOr returns the boolean representation of the value of this node, or def
+if the type conversion is not possible.
+*/
+func (val *Value) BoolOr(def bool) bool {
+	return or(val.Bool, def)
+}
+
+/*
+FloatOr returns the float64 representation of the value of this node, or def
+if the type conversion is not possible.
+*/
+func (val *Value) FloatOr(def float64) float64 {
+	return or(val.Float, def)
+}
+
+/*
+Float32Or returns the float32 representation of the value of this node, or
+def if the type conversion is not possible.
+*/
+func (val *Value) Float32Or(def float32) float32 {
+	return or(val.Float32, def)
+}
+
+/*
+Float64Or returns the float64 representation of the value of this node, or
+def if the type conversion is not possible.
+*/
+func (val *Value) Float64Or(def float64) float64 {
+	return or(val.Float64, def)
+}
+
+/*
+IntOr returns the int representation of the value of this node, or def if
+the type conversion is not possible.
+*/
+func (val *Value) IntOr(def int) int {
+	return or(val.Int, def)
+}
+
+/*
+Int8Or returns the int8 representation of the value of this node, or def if
+the type conversion is not possible.
+*/
+func (val *Value) Int8Or(def int8) int8 {
+	return or(val.Int8, def)
+}
+
+/*
+Int16Or returns the int16 representation of the value of this node, or def
+if the type conversion is not possible.
+*/
+func (val *Value) Int16Or(def int16) int16 {
+	return or(val.Int16, def)
+}
+
+/*
+Int32Or returns the int32 representation of the value of this node, or def
+if the type conversion is not possible.
+*/
+func (val *Value) Int32Or(def int32) int32 {
+	return or(val.Int32, def)
+}
+
+/*
+Int64Or returns the int64 representation of the value of this node, or def
+if the type conversion is not possible.
+*/
+func (val *Value) Int64Or(def int64) int64 {
+	return or(val.Int64, def)
+}
+
+/*
+UintOr returns the uint representation of the value of this node, or def if
+the type conversion is not possible.
+*/
+func (val *Value) UintOr(def uint) uint {
+	return or(val.Uint, def)
+}
+
+/*
+Uint8Or returns the uint8 representation of the value of this node, or def
+if the type conversion is not possible.
+*/
+func (val *Value) Uint8Or(def uint8) uint8 {
+	return or(val.Uint8, def)
+}
+
+/*
+Uint16Or returns the uint16 representation of the value of this node, or def
+if the type conversion is not possible.
+*/
+func (val *Value) Uint16Or(def uint16) uint16 {
+	return or(val.Uint16, def)
+}
+
+/*
+Uint32Or returns the uint32 representation of the value of this node, or def
+if the type conversion is not possible.
+*/
+func (val *Value) Uint32Or(def uint32) uint32 {
+	return or(val.Uint32, def)
+}
+
+/*
+Uint64Or returns the uint64 representation of the value of this node, or def
+if the type conversion is not possible.
+*/
+func (val *Value) Uint64Or(def uint64) uint64 {
+	return or(val.Uint64, def)
+}
+
+/*
+StringOr returns the string representation of the value of this node, or def
+if the type conversion is not possible.
+*/
+func (val *Value) StringOr(def string) string {
+	return or(val.String, def)
+}
+
+/*
+TimeOr returns the time.Time value of this node, parsed as by Time, or def if
+the type conversion is not possible.
+*/
+func (val *Value) TimeOr(def time.Time, layouts ...string) time.Time {
+	return or(func() (time.Time, error) { return val.Time(layouts...) }, def)
+}
+
+/*
+DurationOr returns the time.Duration value of this node, or def if the type
+conversion is not possible.
+*/
+func (val *Value) DurationOr(def time.Duration) time.Duration {
+	return or(val.Duration, def)
+}
+
+/*
+BytesOr returns the []byte value of this node, or def if the type conversion
+is not possible.
+*/
+func (val *Value) BytesOr(def []byte) []byte {
+	return or(val.Bytes, def)
+}
+
+/*
+BigIntOr returns the *big.Int representation of the value of this node, or
+def if the type conversion is not possible.
+*/
+func (val *Value) BigIntOr(def *big.Int) *big.Int {
+	return or(val.BigInt, def)
+}
+
+/*
+BigFloatOr returns the *big.Float representation of the value of this node,
+or def if the type conversion is not possible.
+*/
+func (val *Value) BigFloatOr(def *big.Float) *big.Float {
+	return or(val.BigFloat, def)
+}
+
+/*
+NumberOr returns the json.Number representation of the value of this node,
+or def if the type conversion is not possible.
+*/
+func (val *Value) NumberOr(def json.Number) json.Number {
+	return or(val.Number, def)
+}
+
+/*
+or returns the result of a conversion, or def if it fails.
+*/
+func or[T any](convert func() (T, error), def T) T {
+	if result, err := convert(); nil == err {
+		return result
+	}
+	return def
+}
+
+/*
+valueInt converts a value to a signed integer type, checking for overflow.
+*/
+func valueInt[T int | int8 | int16 | int32 | int64](val *Value) (T, error) {
+	name := reflect.TypeFor[T]().Name()
+	if val.IsNull() {
+		return 0, val.nullError()
+	}
+	if bi, err := val.BigInt(); nil == err {
+		if !bi.IsInt64() || int64(T(bi.Int64())) != bi.Int64() {
+			return 0, errors.Errorf("value '%v' overflows %s", val.data, name)
+		}
+		return T(bi.Int64()), nil
+	}
+	if err := integralCheck(val, name); nil != err {
+		return 0, err
+	}
+	result, err := cast.ToE[int64](val.data)
+	if nil != err {
+		return 0, errors.Wrap(err, "could not convert value '%v' to %s", val.data, name)
+	}
+	if int64(T(result)) != result {
+		return 0, errors.Errorf("value '%v' overflows %s", val.data, name)
+	}
+	return T(result), nil
+}
+
+/*
+valueUint converts a value to an unsigned integer type, checking for
+negative values and overflow.
+*/
+func valueUint[T uint | uint8 | uint16 | uint32 | uint64](val *Value) (T, error) {
+	name := reflect.TypeFor[T]().Name()
+	if val.IsNull() {
+		return 0, val.nullError()
+	}
+	if bi, err := val.BigInt(); nil == err {
+		if !bi.IsUint64() || uint64(T(bi.Uint64())) != bi.Uint64() {
+			return 0, errors.Errorf("value '%v' overflows %s", val.data, name)
+		}
+		return T(bi.Uint64()), nil
+	}
+	if err := integralCheck(val, name); nil != err {
+		return 0, err
+	}
+	result, err := cast.ToE[uint64](val.data)
+	if nil != err {
+		return 0, errors.Wrap(err, "could not convert value '%v' to %s", val.data, name)
+	}
+	if uint64(T(result)) != result {
+		return 0, errors.Errorf("value '%v' overflows %s", val.data, name)
+	}
+	return T(result), nil
+}
+
+/*
+integralCheck returns an error for a float or string value that BigInt
+could not convert, rather than letting cast truncate it, e.g. 1.5 to 1.
+*/
+func integralCheck(val *Value, name string) error {
+	switch kindOf(val.data) {
+	case KindFloat, KindString:
+		return errors.Errorf("could not convert value '%v' to %s: not an integer", val.data, name)
+	}
+	return nil
+}
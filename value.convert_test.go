@@ -0,0 +1,246 @@
+package model_test
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/bdlm/model"
+	stdModel "github.com/bdlm/std/v2/model"
+)
+
+func value(v any) *model.Value {
+	mdl := model.New(stdModel.ModelTypeList)
+	mdl.Push(v)
+	val, _ := mdl.Get(0)
+	return val.(*model.Value)
+}
+
+func TestValueIntegers(t *testing.T) {
+	if i, err := value("127").Int8(); nil != err || 127 != i {
+		t.Errorf("expected 127, received %d (%v)", i, err)
+	}
+	if _, err := value(128).Int8(); nil == err {
+		t.Errorf("expected an overflow error converting 128 to int8")
+	}
+	if i, err := value(json.Number("-32768")).Int16(); nil != err || -32768 != i {
+		t.Errorf("expected -32768, received %d (%v)", i, err)
+	}
+	if i, err := value(json.Number("9007199254740993")).Int64(); nil != err || 9007199254740993 != i {
+		t.Errorf("expected 9007199254740993, received %d (%v)", i, err)
+	}
+	if _, err := value(uint64(1 << 63)).Int64(); nil == err {
+		t.Errorf("expected an overflow error converting 1<<63 to int64")
+	}
+	if i, err := value(1.0).Int32(); nil != err || 1 != i {
+		t.Errorf("expected 1, received %d (%v)", i, err)
+	}
+	for _, v := range []any{1.5, float32(-0.25), "1.7", json.Number("2.5")} {
+		if i, err := value(v).Int64(); nil == err {
+			t.Errorf("%#v: expected an error for a non-integral value, received %d", v, i)
+		}
+		if u, err := value(v).Uint64(); nil == err {
+			t.Errorf("%#v: expected an error for a non-integral value, received %d", v, u)
+		}
+	}
+	if i, err := value("2e3").Int64(); nil != err || 2000 != i {
+		t.Errorf("expected 2000, received %d (%v)", i, err)
+	}
+
+	if u, err := value("18446744073709551615").Uint64(); nil != err || 18446744073709551615 != u {
+		t.Errorf("expected max uint64, received %d (%v)", u, err)
+	}
+	if _, err := value(-1).Uint(); nil == err {
+		t.Errorf("expected an error converting -1 to uint")
+	}
+	if _, err := value(256).Uint8(); nil == err {
+		t.Errorf("expected an overflow error converting 256 to uint8")
+	}
+	if u, err := value(int64(65535)).Uint16(); nil != err || 65535 != u {
+		t.Errorf("expected 65535, received %d (%v)", u, err)
+	}
+	if _, err := value("abc").Uint32(); nil == err {
+		t.Errorf("expected an error converting 'abc' to uint32")
+	}
+	if _, err := value(nil).Int64(); !errors.Is(err, model.NullValue) {
+		t.Errorf("expected a NullValue error, received %v", err)
+	}
+}
+
+func TestValueTime(t *testing.T) {
+	expect := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	tests := []struct {
+		value   any
+		layouts []string
+	}{
+		{expect, nil},
+		{"2024-05-06T07:08:09Z", nil},
+		{"2024-05-06 07:08:09", nil},
+		{"06/05/2024 07:08:09", []string{"02/01/2006 15:04:05"}},
+		{expect.Unix(), nil},
+		{json.Number("1714979289"), nil},
+		{float64(expect.Unix()), nil},
+	}
+	for _, test := range tests {
+		received, err := value(test.value).Time(test.layouts...)
+		if nil != err {
+			t.Errorf("%#v: unexpected error: %v", test.value, err)
+		} else if !expect.Equal(received) {
+			t.Errorf("%#v: expected %s, received %s", test.value, expect, received)
+		}
+	}
+
+	if received, err := value(1.5).Time(); nil != err || 500*time.Millisecond != time.Duration(received.Nanosecond()) {
+		t.Errorf("expected half a second, received %s (%v)", received, err)
+	}
+	if _, err := value("2024-05-06").Time("15:04"); nil == err {
+		t.Errorf("expected an error parsing a date with a time layout")
+	}
+	if _, err := value(true).Time(); nil == err {
+		t.Errorf("expected an error converting a boolean to a time")
+	}
+}
+
+func TestValueDuration(t *testing.T) {
+	if d, err := value("1m30s").Duration(); nil != err || 90*time.Second != d {
+		t.Errorf("expected 1m30s, received %s (%v)", d, err)
+	}
+	if d, err := value(int64(time.Second)).Duration(); nil != err || time.Second != d {
+		t.Errorf("expected 1s, received %s (%v)", d, err)
+	}
+	if d, err := value(time.Minute).Duration(); nil != err || time.Minute != d {
+		t.Errorf("expected 1m, received %s (%v)", d, err)
+	}
+	if _, err := value("soon").Duration(); nil == err {
+		t.Errorf("expected an error parsing 'soon'")
+	}
+}
+
+func TestValueBytes(t *testing.T) {
+	expect := []byte{0xfb, 0xff, 0x01}
+	for _, str := range []string{"+/8B", "-_8B"} {
+		if b, err := value(str).Bytes(); nil != err || string(expect) != string(b) {
+			t.Errorf("%s: expected %v, received %v (%v)", str, expect, b, err)
+		}
+	}
+	if b, err := value("aGk").Bytes(); nil != err || "hi" != string(b) {
+		t.Errorf("expected 'hi', received %q (%v)", b, err)
+	}
+	if b, err := value([]byte("hi")).Bytes(); nil != err || "hi" != string(b) {
+		t.Errorf("expected 'hi', received %q (%v)", b, err)
+	}
+
+	// A []byte round trips through JSON as a base64 string.
+	src := model.New(stdModel.ModelTypeHash)
+	src.Set("data", expect)
+	jsn, _ := json.Marshal(src)
+	dst := model.New(stdModel.ModelTypeHash)
+	if err := json.Unmarshal(jsn, dst); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	val, _ := dst.Get("data")
+	if b, err := val.(*model.Value).Bytes(); nil != err || string(expect) != string(b) {
+		t.Errorf("expected %v, received %v (%v)", expect, b, err)
+	}
+
+	if _, err := value("not base64!").Bytes(); nil == err {
+		t.Errorf("expected an error decoding invalid base64")
+	}
+	if _, err := value(1).Bytes(); nil == err {
+		t.Errorf("expected an error converting an int to bytes")
+	}
+}
+
+func TestValueBigNumbers(t *testing.T) {
+	huge := "123456789012345678901234567890"
+	if i, err := value(huge).BigInt(); nil != err || huge != i.String() {
+		t.Errorf("expected %s, received %v (%v)", huge, i, err)
+	}
+	if i, err := value(json.Number(huge)).BigInt(); nil != err || huge != i.String() {
+		t.Errorf("expected %s, received %v (%v)", huge, i, err)
+	}
+	if i, err := value(uint64(1 << 63)).BigInt(); nil != err || "9223372036854775808" != i.String() {
+		t.Errorf("expected 9223372036854775808, received %v (%v)", i, err)
+	}
+	if _, err := value(1.5).BigInt(); nil == err {
+		t.Errorf("expected an error converting 1.5 to a big.Int")
+	}
+
+	src := big.NewInt(5)
+	i, _ := value(src).BigInt()
+	i.SetInt64(6)
+	if 5 != src.Int64() {
+		t.Errorf("expected the stored big.Int to be copied")
+	}
+
+	if f, err := value("1.25").BigFloat(); nil != err || "1.25" != f.Text('g', -1) {
+		t.Errorf("expected 1.25, received %v (%v)", f, err)
+	}
+	if f, err := value(big.NewInt(3)).BigFloat(); nil != err || "3" != f.Text('g', -1) {
+		t.Errorf("expected 3, received %v (%v)", f, err)
+	}
+	if _, err := value("x").BigFloat(); nil == err {
+		t.Errorf("expected an error converting 'x' to a big.Float")
+	}
+}
+
+func TestValueNumber(t *testing.T) {
+	tests := []struct {
+		value  any
+		expect json.Number
+	}{
+		{json.Number("1.000000000000000000001"), "1.000000000000000000001"},
+		{42, "42"},
+		{uint8(7), "7"},
+		{1.5, "1.5"},
+		{float32(0.1), "0.1"},
+		{"-3e2", "-3e2"},
+	}
+	for _, test := range tests {
+		if n, err := value(test.value).Number(); nil != err || test.expect != n {
+			t.Errorf("%#v: expected %s, received %s (%v)", test.value, test.expect, n, err)
+		}
+	}
+	if _, err := value("ten").Number(); nil == err {
+		t.Errorf("expected an error converting 'ten' to a number")
+	}
+}
+
+func TestValueDefaults(t *testing.T) {
+	bad := value("bad")
+	null := value(nil)
+
+	if 5 != bad.IntOr(5) || 5 != null.IntOr(5) || 3 != value("3").IntOr(5) {
+		t.Errorf("unexpected IntOr result")
+	}
+	if 5 != value(300).Int8Or(5) {
+		t.Errorf("expected Int8Or to return the default on overflow")
+	}
+	if 7 != bad.Uint64Or(7) || 7 != value(-1).UintOr(7) {
+		t.Errorf("unexpected UintOr result")
+	}
+	if !bad.BoolOr(true) || 1.5 != bad.FloatOr(1.5) || 1.5 != bad.Float32Or(1.5) {
+		t.Errorf("unexpected BoolOr or FloatOr result")
+	}
+	if "x" != null.StringOr("x") || "bad" != bad.StringOr("x") {
+		t.Errorf("unexpected StringOr result")
+	}
+	def := time.Unix(0, 0)
+	if !def.Equal(bad.TimeOr(def)) {
+		t.Errorf("unexpected TimeOr result")
+	}
+	if time.Second != bad.DurationOr(time.Second) {
+		t.Errorf("unexpected DurationOr result")
+	}
+	if "d" != string(value(1).BytesOr([]byte("d"))) {
+		t.Errorf("unexpected BytesOr result")
+	}
+	if 1 != bad.BigIntOr(big.NewInt(1)).Int64() {
+		t.Errorf("unexpected BigIntOr result")
+	}
+	if "0" != bad.NumberOr("0") || "12" != value(12).NumberOr("0") {
+		t.Errorf("unexpected NumberOr result")
+	}
+}
@@ -18,6 +18,9 @@ Bool returns the boolean representation of the value of this node, or an
 error if the type conversion is not possible.
 */
 func (val *Value) Bool() (bool, error) {
+	if val.IsNull() {
+		return false, val.nullError()
+	}
 	result, err := cast.ToE[bool](val.data)
 	if nil != err {
 		err = errors.Wrap(err, "could not convert value '%v' to a boolean", val.data)
@@ -30,6 +33,9 @@ Float returns the float64 representation of the value of this node, or an
 error if the type conversion is not possible.
 */
 func (val *Value) Float() (float64, error) {
+	if val.IsNull() {
+		return 0, val.nullError()
+	}
 	result, err := cast.ToE[float64](val.data)
 	if nil != err {
 		err = errors.Wrap(err, "could not convert value '%v' to a float64", val.data)
@@ -42,6 +48,9 @@ Float32 returns the float32 representation of the value of this node, or an
 error if the type conversion is not possible.
 */
 func (val *Value) Float32() (float32, error) {
+	if val.IsNull() {
+		return 0, val.nullError()
+	}
 	result, err := cast.ToE[float32](val.data)
 	if nil != err {
 		err = errors.Wrap(err, "could not convert value '%v' to a float32", val.data)
@@ -54,6 +63,9 @@ Float64 returns the float64 representation of the value of this node, or an
 error if the type conversion is not possible.
 */
 func (val *Value) Float64() (float64, error) {
+	if val.IsNull() {
+		return 0, val.nullError()
+	}
 	result, err := cast.ToE[float64](val.data)
 	if nil != err {
 		err = errors.Wrap(err, "could not convert value '%v' to a float64", val.data)
@@ -66,6 +78,9 @@ Int returns the int representation of the value of this node, or an error if
 the type conversion is not possible.
 */
 func (val *Value) Int() (int, error) {
+	if val.IsNull() {
+		return 0, val.nullError()
+	}
 	result, err := cast.ToE[int](val.data)
 	if nil != err {
 		err = errors.Wrap(err, "could not convert value '%v' to an int", val.data)
@@ -75,28 +90,52 @@ func (val *Value) Int() (int, error) {
 
 /*
 List returns the array of Values stored in this node, or an error if the
-type conversion is not possible.
+type conversion is not possible. Nested list models and []any slices are
+converted: each element is wrapped in a Value, without copying nested data,
+so nested lists and hashes are converted only when List or Map is called on
+them.
 */
 func (val *Value) List() ([]stdModel.Value, error) {
-	var err error
-	result, ok := val.data.([]stdModel.Value)
-	if !ok {
-		err = errors.Errorf("could not convert value '%v' to an array", val.data)
+	switch typed := unwrap(val.data).(type) {
+	case []stdModel.Value:
+		return typed, nil
+	case []any:
+		return wrapValues(typed), nil
+	case *Model:
+		if nil != typed && stdModel.ModelTypeList == typed.GetType() {
+			_, values := typed.entries()
+			return wrapValues(values), nil
+		}
 	}
-	return result, err
+	return nil, errors.Errorf("could not convert value '%v' to an array", val.data)
 }
 
 /*
 Map returns the map[string]Value data stored in this node, or an error if
-the type conversion is not possible.
+the type conversion is not possible. Nested hash models and map[string]any
+maps are converted the same way as in List.
 */
 func (val *Value) Map() (map[string]stdModel.Value, error) {
-	var err error
-	result, ok := val.data.(map[string]stdModel.Value)
-	if !ok {
-		err = errors.Errorf("could not convert value '%v' to a map", val.data)
+	switch typed := unwrap(val.data).(type) {
+	case map[string]stdModel.Value:
+		return typed, nil
+	case map[string]any:
+		result := make(map[string]stdModel.Value, len(typed))
+		for k, v := range typed {
+			result[k] = &Value{v}
+		}
+		return result, nil
+	case *Model:
+		if nil != typed && stdModel.ModelTypeHash == typed.GetType() {
+			keys, values := typed.entries()
+			result := make(map[string]stdModel.Value, len(keys))
+			for k, key := range keys {
+				result[key] = &Value{values[k]}
+			}
+			return result, nil
+		}
 	}
-	return result, err
+	return nil, errors.Errorf("could not convert value '%v' to a map", val.data)
 }
 
 /*
@@ -117,6 +156,9 @@ String returns the boolean representation of the value, or an error if the
 type conversion is not possible.
 */
 func (val *Value) String() (string, error) {
+	if val.IsNull() {
+		return "", val.nullError()
+	}
 	result, err := cast.ToE[string](val.data)
 	if nil != err {
 		err = errors.Wrap(err, "could not convert value '%v' to a string", val.data)
@@ -124,9 +166,54 @@ func (val *Value) String() (string, error) {
 	return result, err
 }
 
+/*
+IsNull reports whether the value is null: nil, or a nil pointer, map or
+slice. Conversion methods return a NullValue error for null values.
+*/
+func (val *Value) IsNull() bool {
+	return isNull(unwrap(val.data))
+}
+
+/*
+nullError returns the error returned when converting a null value.
+*/
+func (val *Value) nullError() error {
+	return errors.WrapE(NullValue, errors.Errorf("cannot convert a null value"))
+}
+
 /*
 Value returns the untyped value.
 */
 func (val *Value) Value() interface{} {
 	return val.data
 }
+
+/*
+wrapValues wraps each element of values in a Value.
+*/
+func wrapValues(values []any) []stdModel.Value {
+	result := make([]stdModel.Value, len(values))
+	for k, v := range values {
+		result[k] = &Value{v}
+	}
+	return result
+}
+
+/*
+unwrap returns the raw data stored in v, removing any Value wrappers.
+*/
+func unwrap(v any) any {
+	for {
+		switch typed := v.(type) {
+		case *Value:
+			if nil == typed {
+				return nil
+			}
+			v = typed.data
+		case stdModel.Value:
+			v = typed.Value()
+		default:
+			return v
+		}
+	}
+}
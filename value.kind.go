@@ -0,0 +1,137 @@
+package model
+
+import (
+	"encoding/json"
+	"reflect"
+	"time"
+
+	stdModel "github.com/bdlm/std/v2/model"
+)
+
+/*
+Kind identifies the type of data held by a Value.
+*/
+type Kind int
+
+const (
+	// KindNull - nil, or a nil pointer, map or slice.
+	KindNull Kind = iota
+	// KindBool - A boolean.
+	KindBool
+	// KindInt - A signed or unsigned integer, including time.Duration and
+	// integral json.Number values.
+	KindInt
+	// KindFloat - A floating point number, including other json.Number
+	// values.
+	KindFloat
+	// KindString - A string.
+	KindString
+	// KindList - A list model or a slice.
+	KindList
+	// KindHash - A hash model or a map.
+	KindHash
+	// KindModel - Another stdModel.Model implementation, or a Ref.
+	KindModel
+	// KindBytes - A byte slice.
+	KindBytes
+	// KindTime - A time.Time.
+	KindTime
+	// KindOther - Any other type, e.g. a struct.
+	KindOther
+)
+
+/*
+String implements fmt.Stringer.
+*/
+func (kind Kind) String() string {
+	switch kind {
+	case KindNull:
+		return "null"
+	case KindBool:
+		return "bool"
+	case KindInt:
+		return "int"
+	case KindFloat:
+		return "float"
+	case KindString:
+		return "string"
+	case KindList:
+		return "list"
+	case KindHash:
+		return "hash"
+	case KindModel:
+		return "model"
+	case KindBytes:
+		return "bytes"
+	case KindTime:
+		return "time"
+	}
+	return "other"
+}
+
+/*
+Kind returns the kind of data held by this value.
+*/
+func (val *Value) Kind() Kind {
+	return kindOf(val.data)
+}
+
+/*
+kindOf returns the kind of a raw value.
+*/
+func kindOf(v any) Kind {
+	v = unwrap(v)
+	if isNull(v) {
+		return KindNull
+	}
+	switch typed := v.(type) {
+	case *Model:
+		if stdModel.ModelTypeList == typed.GetType() {
+			return KindList
+		}
+		return KindHash
+	case stdModel.Model, Ref:
+		return KindModel
+	case json.Number:
+		if _, err := typed.Int64(); nil == err {
+			return KindInt
+		}
+		return KindFloat
+	case []byte:
+		return KindBytes
+	case time.Time:
+		return KindTime
+	}
+
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.Bool:
+		return KindBool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return KindInt
+	case reflect.Float32, reflect.Float64:
+		return KindFloat
+	case reflect.String:
+		return KindString
+	case reflect.Slice, reflect.Array:
+		return KindList
+	case reflect.Map:
+		return KindHash
+	}
+	return KindOther
+}
+
+/*
+isNull reports whether v is nil, or a nil pointer, map or slice.
+*/
+func isNull(v any) bool {
+	if nil == v {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Interface:
+		return rv.IsNil()
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package model_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bdlm/model"
+	stdModel "github.com/bdlm/std/v2/model"
+)
+
+func TestValueKind(t *testing.T) {
+	var nilMap map[string]any
+	tests := []struct {
+		value any
+		kind  model.Kind
+	}{
+		{nil, model.KindNull},
+		{nilMap, model.KindNull},
+		{true, model.KindBool},
+		{int8(1), model.KindInt},
+		{uint64(1), model.KindInt},
+		{time.Second, model.KindInt},
+		{json.Number("12"), model.KindInt},
+		{json.Number("1.5"), model.KindFloat},
+		{1.5, model.KindFloat},
+		{"a", model.KindString},
+		{[]any{1}, model.KindList},
+		{model.New(stdModel.ModelTypeList), model.KindList},
+		{map[string]any{}, model.KindHash},
+		{model.New(stdModel.ModelTypeHash), model.KindHash},
+		{model.Ref{ID: "a"}, model.KindModel},
+		{[]byte("a"), model.KindBytes},
+		{time.Now(), model.KindTime},
+		{struct{}{}, model.KindOther},
+	}
+	for _, test := range tests {
+		mdl := model.New(stdModel.ModelTypeList)
+		mdl.Push(test.value)
+		val, _ := mdl.Get(0)
+		if kind := val.(*model.Value).Kind(); test.kind != kind {
+			t.Errorf("%#v: expected %s, received %s", test.value, test.kind, kind)
+		}
+	}
+}
+
+func TestWrappedNull(t *testing.T) {
+	mdl := model.New(stdModel.ModelTypeList)
+	mdl.Push([]any{&model.Value{}})
+	val, _ := mdl.Get(0)
+	items, _ := val.List()
+	wrapped := items[0].(*model.Value)
+	if model.KindNull != wrapped.Kind() || !wrapped.IsNull() {
+		t.Errorf("expected a wrapped nil to be null, received %s %v", wrapped.Kind(), wrapped.IsNull())
+	}
+	if _, err := wrapped.String(); !errors.Is(err, model.NullValue) {
+		t.Errorf("expected a NullValue error, received %v", err)
+	}
+}
+
+func TestNullPresence(t *testing.T) {
+	mdl := model.New(stdModel.ModelTypeHash)
+	if err := mdl.UnmarshalJSON([]byte(`{"a":null,"b":1,"c":{"d":null}}`)); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !mdl.Has("a") || !mdl.IsNull("a") {
+		t.Errorf("expected key 'a' to be present and null")
+	}
+	if mdl.Has("missing") || mdl.IsNull("missing") {
+		t.Errorf("expected key 'missing' to be absent")
+	}
+	if mdl.IsNull("b") {
+		t.Errorf("expected key 'b' not to be null")
+	}
+
+	val, err := mdl.Get("a")
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	null := val.(*model.Value)
+	if !null.IsNull() || model.KindNull != null.Kind() {
+		t.Errorf("expected a null value")
+	}
+	if _, err := null.Int(); !errors.Is(err, model.NullValue) {
+		t.Errorf("expected NullValue, received %v", err)
+	}
+	if _, err := null.String(); !errors.Is(err, model.NullValue) {
+		t.Errorf("expected NullValue, received %v", err)
+	}
+	if _, err := mdl.Get("missing"); !errors.Is(err, model.InvalidIndex) {
+		t.Errorf("expected InvalidIndex, received %v", err)
+	}
+
+	if got := historyJSON(t, mdl); `{"a":null,"b":1,"c":{"d":null}}` != got {
+		t.Errorf(`expected nulls to be kept, received %s`, got)
+	}
+	mdl.SetOmitNull(true)
+	if got := historyJSON(t, mdl); `{"b":1,"c":{}}` != got {
+		t.Errorf(`expected {"b":1,"c":{}}, received %s`, got)
+	}
+	data, err := model.EncodeAs(mdl, model.FormatYAML)
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if "b: 1\nc: {}\n" != string(data) {
+		t.Errorf("expected nulls to be omitted from YAML, received %q", data)
+	}
+}
+
+func TestListKeys(t *testing.T) {
+	mdl := model.New(stdModel.ModelTypeList)
+	mdl.Push(nil)
+	if !mdl.Has(int64(0)) || !mdl.IsNull(uint8(0)) {
+		t.Errorf("expected index 0 to be present and null")
+	}
+	if mdl.Has(-1) || mdl.Has(1) {
+		t.Errorf("expected out of range indexes to be absent")
+	}
+	if _, err := mdl.Get(int32(0)); nil != err {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := mdl.Get(-1); !errors.Is(err, model.InvalidIndex) {
+		t.Errorf("expected InvalidIndex, received %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/bdlm/model"
+	stdModel "github.com/bdlm/std/v2/model"
+)
+
+func TestValueListMap(t *testing.T) {
+	mdl := model.New(stdModel.ModelTypeHash)
+	if err := mdl.UnmarshalJSON([]byte(`{"list":[1,{"a":"b"},[2,3]],"hash":{"x":[4],"y":null}}`)); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	val, _ := mdl.Get("list")
+	list, err := val.List()
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if 3 != len(list) {
+		t.Fatalf("expected 3 values, received %d", len(list))
+	}
+	if i, err := list[0].Int(); nil != err || 1 != i {
+		t.Errorf("expected 1, received %d (%v)", i, err)
+	}
+	nested, err := list[1].Map()
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s, err := nested["a"].String(); nil != err || "b" != s {
+		t.Errorf("expected 'b', received '%s' (%v)", s, err)
+	}
+	inner, err := list[2].List()
+	if nil != err || 2 != len(inner) {
+		t.Fatalf("expected 2 values, received %d (%v)", len(inner), err)
+	}
+	if _, err := list[2].Map(); nil == err {
+		t.Errorf("expected an error converting a list to a map")
+	}
+
+	val, _ = mdl.Get("hash")
+	hash, err := val.Map()
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if 2 != len(hash) || !hash["y"].(*model.Value).IsNull() {
+		t.Errorf("expected 2 values including a null, received %v", hash)
+	}
+	if _, err := val.List(); nil == err {
+		t.Errorf("expected an error converting a hash to a list")
+	}
+
+	// Nested data is not copied.
+	x, _ := hash["x"].Model()
+	x.(*model.Model).Push(5)
+	sub, _ := mdl.Get("hash")
+	xs, _ := sub.(*model.Value).Map()
+	if items, _ := xs["x"].List(); 2 != len(items) {
+		t.Errorf("expected the nested list to be shared, received %d items", len(items))
+	}
+}
+
+func TestValueListMapRaw(t *testing.T) {
+	mdl := model.New(stdModel.ModelTypeList)
+	mdl.Push([]any{"a", map[string]any{"b": 1}})
+	mdl.Push(map[string]any{"c": []any{2}})
+
+	val, _ := mdl.Get(0)
+	list, err := val.List()
+	if nil != err || 2 != len(list) {
+		t.Fatalf("expected 2 values, received %d (%v)", len(list), err)
+	}
+	if m, err := list[1].Map(); nil != err || 1 != len(m) {
+		t.Errorf("expected 1 value, received %d (%v)", len(m), err)
+	}
+
+	val, _ = mdl.Get(1)
+	hash, err := val.Map()
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if items, err := hash["c"].List(); nil != err || 1 != len(items) {
+		t.Errorf("expected 1 value, received %d (%v)", len(items), err)
+	}
+
+	val, _ = mdl.Get(0)
+	if _, err := val.Map(); nil == err {
+		t.Errorf("expected an error converting a slice to a map")
+	}
+}